@@ -1,6 +1,12 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"syncedpz/pkg/utils"
 
 	"github.com/charmbracelet/log"
@@ -9,24 +15,113 @@ import (
 
 var (
 	FirstTimeSetup bool
-	DB             *badger.DB
+	// Nil while the database is closed, see OpenDB
+	DB *badger.DB
+
+	dbMu    sync.Mutex
+	dbUsers int
+	dbLock  *utils.FileLock
 )
 
-func InitDB(path string) {
+// ErrDBInUse is returned when another SyncedPZ process has the database open
+var ErrDBInUse = errors.New("the database is in use by another SyncedPZ process")
+
+// getDBLockPath returns the path of the file locked while a process has the database open. Badger only
+// allows one process at a time, the lock lets the others wait for it
+func getDBLockPath() string {
+	return filepath.Join(DataPath, "db.lock")
+}
+
+// InitDB opens the database at the path
+func InitDB(path string) error {
 	var err error
 
-	FirstTimeSetup = !utils.EnsureDir(path)
+	if _, statErr := os.Stat(path + "/badger"); os.IsNotExist(statErr) {
+		FirstTimeSetup = true
+	}
 
 	opts := badger.DefaultOptions(path + "/badger")
 	opts.Logger = nil
 	opts.Truncate = true
 
 	DB, err = badger.Open(opts)
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("BadgerDB initialized")
+	return nil
+}
+
+// OpenDB opens the database, waiting until the context is done while another SyncedPZ process has it open.
+// The goroutines of the process share it, it's closed once every OpenDB is paired with a CloseDB.
+// The long-running commands only keep it open while they use it, so the other processes can use it
+// meanwhile
+func OpenDB(ctx context.Context) error {
+	return openDB(func() (*utils.FileLock, error) {
+		lock, err := utils.TryLockFile(getDBLockPath())
+		if err == utils.ErrLocked {
+			log.Info("The database is in use by another SyncedPZ process, waiting for it")
+			lock, err = utils.LockFile(ctx, getDBLockPath())
+			if err != nil && ctx.Err() != nil {
+				return nil, fmt.Errorf("%w: %w", ErrDBInUse, err)
+			}
+		}
+		return lock, err
+	})
+}
 
-	log.Info("BadgerDB initialized")
+// TryOpenDB is OpenDB returning ErrDBInUse right away if another SyncedPZ process has the database open
+func TryOpenDB() error {
+	return openDB(func() (*utils.FileLock, error) {
+		lock, err := utils.TryLockFile(getDBLockPath())
+		if err == utils.ErrLocked {
+			return nil, ErrDBInUse
+		}
+		return lock, err
+	})
 }
 
-func init() {
-	InitDB(DataPath)
+func openDB(lockDB func() (*utils.FileLock, error)) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	if dbUsers > 0 {
+		dbUsers++
+		return nil
+	}
+
+	lock, err := lockDB()
+	if err != nil {
+		return err
+	}
+	if err := InitDB(DataPath); err != nil {
+		lock.Unlock()
+		return err
+	}
+	dbLock = lock
+	dbUsers = 1
+	return nil
+}
+
+// CloseDB releases the database opened with OpenDB, closing it when no goroutine uses it anymore
+func CloseDB() {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	if dbUsers == 0 {
+		return
+	}
+	dbUsers--
+	if dbUsers > 0 {
+		return
+	}
+
+	if err := DB.Close(); err != nil {
+		log.Error(err)
+	}
+	DB = nil
+	dbLock.Unlock()
+	dbLock = nil
+	log.Debug("BadgerDB closed")
 }
@@ -2,4 +2,17 @@ package config
 
 const (
 	DataPath = "data"
+
+	DefaultBackupMaxCount   = 10
+	DefaultBackupMaxAgeDays = 30
+	DefaultBackupMaxSizeMB  = 5 * 1024
+
+	DefaultNetworkTimeoutSeconds = 10 * 60
+	DefaultNetworkRetries        = 3
+	DefaultNetworkBackoffSeconds = 2
+
+	DefaultAgentIntervalMinutes = 10
+
+	DefaultLogMaxSizeMB = 10
+	DefaultLogMaxFiles  = 5
 )
@@ -38,7 +38,6 @@ func init() {
 	ptbrDict := make(map[string]string)
 
 	ptbrDict["Press any key to exit..."] = "Pressione qualquer tecla para sair..."
-	ptbrDict["Press any key to continue..."] = "Pressione qualquer tecla para continuar..."
 	ptbrDict["First time setup"] = "Configuração inicial"
 	ptbrDict["Type of servers to list"] = "Tipo de servidores para listar"
 	ptbrDict["No argument for config"] = "Nenhum foi argumento para config"
@@ -48,24 +47,11 @@ func init() {
 	ptbrDict["  syncedpz config [setup | list] = sets up or list the syncedpz configuration"] = "  syncedpz config [setup | list] = configura ou lista a configuração do syncedpz"
 	ptbrDict["  syncedpz list -type [local | synced] = list servers according to its type (default is local))"] = "  syncedpz list -type [local | synced] = lista servidores de acordo com seu tipo (padrão é local))"
 	ptbrDict["  syncedpz add = adds a new synced PZ server from your local files"] = "  syncedpz add = adiciona um novo servidor PZ sincronizado a partir de seus arquivos locais"
-	ptbrDict["  syncedpz delete = deletes a synced PZ server from the database only"] = "  syncedpz delete = exclui um servidor PZ sincronizado apenas do banco de dados"
+	ptbrDict["  syncedpz delete [-force] = deletes a synced PZ server from the database only"] = "  syncedpz delete [-force] = exclui um servidor PZ sincronizado apenas do banco de dados"
 	ptbrDict["  syncedpz clone = adds a new synced PZ server from a git repository"] = "  syncedpz clone = adiciona um novo servidor PZ sincronizado de um repositório git"
 	ptbrDict["  syncedpz sync = syncs all servers"] = "  syncedpz sync = sincroniza todos os servidores"
 	ptbrDict["  syncedpz play = syncs all servers at the start, every 5 minutes and at the end. And starts Project Zomboid"] = "  syncedpz play = sincroniza todo servidor no início, a cada 5 minutos e no final. E inicia o Project Zomboid"
 	ptbrDict["  syncedpz language = sets the language of the application"] = "  syncedpz language = define o idioma da aplicação"
-	ptbrDict["Menu:"] = "Menu:"
-	ptbrDict["  [0] Help"] = "  [0] Ajuda"
-	ptbrDict["  [1] Setup config"] = "  [1] Configuração"
-	ptbrDict["  [2] List config"] = "  [2] Listar configuração"
-	ptbrDict["  [3] List local servers"] = "  [3] Listar servidores locais"
-	ptbrDict["  [4] List synced servers"] = "  [4] Listar servidores sincronizados"
-	ptbrDict["  [5] Add synced server"] = "  [5] Adicionar servidor sincronizado"
-	ptbrDict["  [6] Delete synced server"] = "  [6] Excluir servidor sincronizado"
-	ptbrDict["  [7] Clone synced server"] = "  [7] Clonar servidor sincronizado"
-	ptbrDict["  [8] Sync servers"] = "  [8] Sincronizar servidores"
-	ptbrDict["  [9] Play"] = "  [9] Jogar"
-	ptbrDict["  [10] Set language"] = "  [10] Definir idioma"
-	ptbrDict["  [11] Exit"] = "  [11] Sair"
 	ptbrDict["Enter the number of the option you want to choose: "] = "Digite o número da opção que deseja escolher: "
 	ptbrDict["Invalid choice"] = "Escolha inválida"
 	ptbrDict["Leave the field empty to use the previous value (if it exists)"] = "Deixe o campo vazio para usar o valor anterior (se existir)"
@@ -92,6 +78,219 @@ func init() {
 	ptbrDict["Server cloned successfully"] = "Servidor clonado com sucesso"
 	ptbrDict["Enter the number of the language you want to choose: "] = "Digite o número do idioma que deseja escolher: "
 	ptbrDict["WARNING: Commiting and pushing can take a while, please wait..."] = "AVISO: Comitar e fazer push pode demorar um pouco, por favor aguarde..."
+	ptbrDict["Name of the synced server"] = "Nome do servidor sincronizado"
+	ptbrDict["  syncedpz resolve [-server NAME] = resolves the config conflicts found when syncing"] = "  syncedpz resolve [-server NOME] = resolve os conflitos de configuração encontrados ao sincronizar"
+	ptbrDict["(not set)"] = "(não definido)"
+	ptbrDict["Conflict in %s (%s) at %s:\n"] = "Conflito em %s (%s) em %s:\n"
+	ptbrDict["  Last synced: "] = "  Última sincronização: "
+	ptbrDict["  Mine:        "] = "  Meu:                  "
+	ptbrDict["  Theirs:      "] = "  Deles:                "
+	ptbrDict["Enter 1 to keep mine or 2 to keep theirs: "] = "Digite 1 para manter o meu ou 2 para manter o deles: "
+	ptbrDict["No conflicts to resolve"] = "Nenhum conflito para resolver"
+	ptbrDict["Your values will be sent to the other players on the next sync"] = "Seus valores serão enviados para os outros jogadores na próxima sincronização"
+	ptbrDict["  syncedpz settings -server NAME [list | get KEY | set KEY VALUE] = shows or changes the server settings"] = "  syncedpz settings -server NOME [list | get CHAVE | set CHAVE VALOR] = mostra ou altera as configurações do servidor"
+	ptbrDict["Missing mods for %s, install them before playing:\n"] = "Mods faltando para %s, instale-os antes de jogar:\n"
+	ptbrDict["  Workshop item %s: https://steamcommunity.com/sharedfiles/filedetails/?id=%s\n"] = "  Item da oficina %s: https://steamcommunity.com/sharedfiles/filedetails/?id=%s\n"
+	ptbrDict["  Mod %s\n"] = "  Mod %s\n"
+	ptbrDict["Number of snapshots to show (0 shows all)"] = "Número de snapshots para mostrar (0 mostra todos)"
+	ptbrDict["  syncedpz status [-server NAME] = shows the status of the synced servers"] = "  syncedpz status [-server NOME] = mostra o estado dos servidores sincronizados"
+	ptbrDict["  syncedpz history -server NAME [-n 20] = shows the last snapshots of a synced server"] = "  syncedpz history -server NOME [-n 20] = mostra os últimos snapshots de um servidor sincronizado"
+	ptbrDict["  Players:"] = "  Jogadores:"
+	ptbrDict["  Last snapshot:"] = "  Último snapshot:"
+	ptbrDict["  %d config conflicts, use syncedpz resolve to solve them\n"] = "  %d conflitos de configuração, use syncedpz resolve para resolvê-los\n"
+	ptbrDict["Pushes the save even if it fails the verification"] = "Envia o save mesmo se ele falhar na verificação"
+	ptbrDict["  syncedpz [sync | play] -force = pushes the saves even if they fail the verification"] = "  syncedpz [sync | play] -force = envia os saves mesmo se eles falharem na verificação"
+	ptbrDict["Maximum number of backups kept per server (0 is unlimited)"] = "Número máximo de backups mantidos por servidor (0 é ilimitado)"
+	ptbrDict["Maximum age of the backups in days (0 is unlimited)"] = "Idade máxima dos backups em dias (0 é ilimitado)"
+	ptbrDict["Maximum size of the backups of a server in MB (0 is unlimited)"] = "Tamanho máximo dos backups de um servidor em MB (0 é ilimitado)"
+	ptbrDict["  syncedpz backups [-server NAME] [list | restore ID | prune] = manages the local backups taken before the saves are overwritten"] = "  syncedpz backups [-server NOME] [list | restore ID | prune] = gerencia os backups locais feitos antes dos saves serem sobrescritos"
+	ptbrDict["  syncedpz backups [-count N] [-days N] [-size-mb N] policy = shows or sets how many backups are kept"] = "  syncedpz backups [-count N] [-days N] [-size-mb N] policy = mostra ou define quantos backups são mantidos"
+	ptbrDict["Backup restored, it will be pushed on the next sync if there are no new changes in the server"] = "Backup restaurado, ele será enviado na próxima sincronização se não houver novas mudanças no servidor"
+	ptbrDict["%s: %d backups removed\n"] = "%s: %d backups removidos\n"
+	ptbrDict["Maximum number of backups per server:"] = "Número máximo de backups por servidor:"
+	ptbrDict["Maximum age of the backups in days:"] = "Idade máxima dos backups em dias:"
+	ptbrDict["Maximum size of the backups of a server in MB:"] = "Tamanho máximo dos backups de um servidor em MB:"
+	ptbrDict["Path of the archive to create"] = "Caminho do arquivo a ser criado"
+	ptbrDict["Git repository to publish the imported server to (optional)"] = "Repositório git para publicar o servidor importado (opcional)"
+	ptbrDict["  syncedpz export -server NAME -o world.tar.zst = exports a synced server to an archive that can be shared"] = "  syncedpz export -server NOME -o world.tar.zst = exporta um servidor sincronizado para um arquivo que pode ser compartilhado"
+	ptbrDict["  syncedpz import world.tar.zst [-url URL] = installs an exported server and optionally publishes it to a git repository"] = "  syncedpz import world.tar.zst [-url URL] = instala um servidor exportado e opcionalmente o publica em um repositório git"
+	ptbrDict["Server exported to %s\n"] = "Servidor exportado para %s\n"
+	ptbrDict["Server %s imported, exported by %s at %s\n"] = "Servidor %s importado, exportado por %s em %s\n"
+	ptbrDict["  Workshop items:"] = "  Itens da oficina:"
+	ptbrDict["The server was installed as a local server only, use syncedpz add to sync it"] = "O servidor foi instalado apenas como servidor local, use syncedpz add para sincronizá-lo"
+	ptbrDict["New name of the server"] = "Novo nome do servidor"
+	ptbrDict["  syncedpz rename -server OLD -to NEW = renames a synced server for every player"] = "  syncedpz rename -server ANTIGO -to NOVO = renomeia um servidor sincronizado para todos os jogadores"
+	ptbrDict["Server renamed to %s, the other players will follow it on their next sync\n"] = "Servidor renomeado para %s, os outros jogadores o seguirão na próxima sincronização\n"
+	ptbrDict["  syncedpz remote set-url -server NAME URL = changes the git repository of a synced server"] = "  syncedpz remote set-url -server NOME URL = muda o repositório git de um servidor sincronizado"
+	ptbrDict["  syncedpz remote migrate -server NAME URL = pushes the whole history of a synced server to a new git repository and uses it"] = "  syncedpz remote migrate -server NOME URL = envia todo o histórico de um servidor sincronizado para um novo repositório git e passa a usá-lo"
+	ptbrDict["Repository of %s changed to %s\n"] = "Repositório de %s alterado para %s\n"
+	ptbrDict["%s migrated to %s, the other players must run: syncedpz remote set-url -server \"%s\" %s\n"] = "%s migrado para %s, os outros jogadores devem executar: syncedpz remote set-url -server \"%s\" %s\n"
+	ptbrDict["  syncedpz remote [list | add URL | remove URL] -server NAME = manages the mirrors of a synced server, every repository is pushed and the freshest one is pulled"] = "  syncedpz remote [list | add URL | remove URL] -server NOME = gerencia os espelhos de um servidor sincronizado, todos os repositórios recebem as mudanças e o mais atualizado é baixado"
+	ptbrDict["Mirror %s added to %s\n"] = "Espelho %s adicionado a %s\n"
+	ptbrDict["Mirror %s removed from %s\n"] = "Espelho %s removido de %s\n"
+	ptbrDict["not used yet"] = "ainda não utilizado"
+	ptbrDict["ok (last success %s)\n"] = "ok (último sucesso %s)\n"
+	ptbrDict["failed %d times in a row, last at %s: %s\n"] = "falhou %d vezes seguidas, a última em %s: %s\n"
+	ptbrDict["  Repositories:"] = "  Repositórios:"
+	ptbrDict["WARNING: you are offline, your progress will be pushed when the connection is back"] = "AVISO: você está offline, seu progresso será enviado quando a conexão voltar"
+	ptbrDict["Other players won't see it and may play an older version of the world meanwhile"] = "Os outros jogadores não o verão e podem jogar uma versão mais antiga do mundo enquanto isso"
+	ptbrDict["  %d snapshots waiting to be pushed\n"] = "  %d snapshots aguardando envio\n"
+	ptbrDict["Timeout of each network operation in seconds"] = "Tempo limite de cada operação de rede em segundos"
+	ptbrDict["Number of retries of the network operations that fail temporarily"] = "Número de novas tentativas das operações de rede que falham temporariamente"
+	ptbrDict["Seconds to wait before the first retry, doubled on each one"] = "Segundos de espera antes da primeira nova tentativa, dobrados a cada uma"
+	ptbrDict["  syncedpz config [-timeout 600] [-retries 3] [-backoff 2] network = shows or sets the timeout and retries of the network operations"] = "  syncedpz config [-timeout 600] [-retries 3] [-backoff 2] network = mostra ou define o tempo limite e as novas tentativas das operações de rede"
+	ptbrDict["Network timeout: "] = "Tempo limite de rede: "
+	ptbrDict["Network retries: "] = "Novas tentativas de rede: "
+	ptbrDict["Network backoff: "] = "Espera entre tentativas de rede: "
+	ptbrDict["failing, retrying won't help: %s\n"] = "falhando, tentar novamente não vai ajudar: %s\n"
+	ptbrDict["Resolves the divergences without asking: mine, theirs or fork"] = "Resolve as divergências sem perguntar: mine (minha), theirs (deles) ou fork (ramificar)"
+	ptbrDict["  syncedpz [sync | play] -conflict [mine | theirs | fork] = resolves without asking when the save changed locally and in the server"] = "  syncedpz [sync | play] -conflict [mine | theirs | fork] = resolve sem perguntar quando o save mudou localmente e no servidor"
+	ptbrDict["%s changed locally and in the server since the last sync:\n"] = "%s mudou localmente e no servidor desde a última sincronização:\n"
+	ptbrDict["  Last sync:"] = "  Última sincronização:"
+	ptbrDict["  Mine:     "] = "  Minha:    "
+	ptbrDict["  Theirs:   "] = "  Deles:    "
+	ptbrDict["  [1] Keep mine, replacing theirs"] = "  [1] Manter a minha, substituindo a deles"
+	ptbrDict["  [2] Keep theirs, mine is kept in the local backups"] = "  [2] Manter a deles, a minha fica nos backups locais"
+	ptbrDict["  [3] Fork mine into a new branch and keep theirs"] = "  [3] Ramificar a minha em um novo branch e manter a deles"
+	ptbrDict["  [4] Decide on the next sync"] = "  [4] Decidir na próxima sincronização"
+	ptbrDict["  syncedpz branch [list | create NAME | switch NAME | merge NAME] -server NAME = manages alternate timelines of a synced server, merging replaces the current world with the one of the branch"] = "  syncedpz branch [list | create NOME | switch NOME | merge NOME] -server NOME = gerencia linhas do tempo alternativas de um servidor sincronizado, mesclar substitui o mundo atual pelo do branch"
+	ptbrDict["Branch %s created, use syncedpz branch switch to play on it\n"] = "Branch %s criado, use syncedpz branch switch para jogar nele\n"
+	ptbrDict["%s is now on the branch %s\n"] = "%s agora está no branch %s\n"
+	ptbrDict["Branch %s merged\n"] = "Branch %s mesclado\n"
+	ptbrDict["  Branch:"] = "  Branch:"
+	ptbrDict["  syncedpz tag -server NAME [TAG] = tags the current snapshot of a synced server as a milestone, or lists the tags"] = "  syncedpz tag -server NOME [TAG] = marca o snapshot atual de um servidor sincronizado como um marco, ou lista as tags"
+	ptbrDict["  syncedpz restore -server NAME [TAG | SNAPSHOT] = makes an older snapshot of a synced server the current one for every player"] = "  syncedpz restore -server NOME [TAG | SNAPSHOT] = torna um snapshot antigo de um servidor sincronizado o atual para todos os jogadores"
+	ptbrDict["Snapshot tagged as %s, restore it with syncedpz restore -server \"%s\" %s\n"] = "Snapshot marcado como %s, restaure-o com syncedpz restore -server \"%s\" %s\n"
+	ptbrDict["%s restored to %s, the other players will get it on their next sync\n"] = "%s restaurado para %s, os outros jogadores o receberão na próxima sincronização\n"
+	ptbrDict["  syncedpz serve [-addr 127.0.0.1:8765] [-token TOKEN] = serves a JSON API to control SyncedPZ from other programs, every request must send the token"] = "  syncedpz serve [-addr 127.0.0.1:8765] [-token TOKEN] = serve uma API JSON para controlar o SyncedPZ de outros programas, toda requisição deve enviar o token"
+	ptbrDict["Address the API listens on, keep it on 127.0.0.1 to only allow this computer"] = "Endereço em que a API escuta, mantenha em 127.0.0.1 para permitir apenas este computador"
+	ptbrDict["Token of the API, the saved one is used if empty"] = "Token da API, o salvo é usado se vazio"
+	ptbrDict["Send the header Authorization: Bearer %s in every request\n"] = "Envie o cabeçalho Authorization: Bearer %s em toda requisição\n"
+	ptbrDict["  syncedpz ui [-addr 127.0.0.1:8765] = opens a dashboard in the browser to see, sync, play and restore the synced servers"] = "  syncedpz ui [-addr 127.0.0.1:8765] = abre um painel no navegador para ver, sincronizar, jogar e restaurar os servidores sincronizados"
+	ptbrDict["Dashboard running at %s, close this window to stop it\n"] = "Painel rodando em %s, feche esta janela para pará-lo\n"
+	ptbrDict["tab next field • ←/→ change option • enter confirm • esc cancel"] = "tab próximo campo • ←/→ muda a opção • enter confirma • esc cancela"
+	ptbrDict["Setup config"] = "Configuração"
+	ptbrDict["Path to the pz executable (.bat file)"] = "Caminho para o executável do pz (arquivo .bat)"
+	ptbrDict["Path to the pz data directory"] = "Caminho para o diretório de dados do pz"
+	ptbrDict["Steam ID"] = "Steam ID"
+	ptbrDict["Git username (empty keeps the current credentials)"] = "Usuário do git (vazio mantém as credenciais atuais)"
+	ptbrDict["Git password or token"] = "Senha ou token do git"
+	ptbrDict["%q does not exist"] = "%q não existe"
+	ptbrDict["Steam ID cannot be empty"] = "O Steam ID não pode ser vazio"
+	ptbrDict["Enter both the git username and password, or none to keep the current ones"] = "Informe o usuário e a senha do git, ou nenhum para manter os atuais"
+	ptbrDict["Config saved"] = "Configuração salva"
+	ptbrDict["Every local server is already synced"] = "Todos os servidores locais já estão sincronizados"
+	ptbrDict["Add synced server"] = "Adicionar servidor sincronizado"
+	ptbrDict["Local server"] = "Servidor local"
+	ptbrDict["Git repository link"] = "Link do repositório git"
+	ptbrDict["The git repository link cannot be empty"] = "O link do repositório git não pode ser vazio"
+	ptbrDict["Clone synced server"] = "Clonar servidor sincronizado"
+	ptbrDict["Syncing servers"] = "Sincronizando servidores"
+	ptbrDict["Servers synced"] = "Servidores sincronizados"
+	ptbrDict["You are offline, your progress will be pushed when the connection is back"] = "Você está offline, seu progresso será enviado quando a conexão voltar"
+	ptbrDict["Syncing %s"] = "Sincronizando %s"
+	ptbrDict["%s synced"] = "%s sincronizado"
+	ptbrDict["Resolving %s"] = "Resolvendo %s"
+	ptbrDict["%s resolved"] = "%s resolvido"
+	ptbrDict["Checking the git repository"] = "Verificando o repositório git"
+	ptbrDict["  [y] Yes"] = "  [y] Sim"
+	ptbrDict["  [n] No"] = "  [n] Não"
+	ptbrDict["Cloning server"] = "Clonando servidor"
+	ptbrDict["Delete %s from the synced servers? Your local save is kept"] = "Excluir %s dos servidores sincronizados? Seu save local é mantido"
+	ptbrDict["Deleting %s"] = "Excluindo %s"
+	ptbrDict["%s deleted"] = "%s excluído"
+	ptbrDict["Playing"] = "Jogando"
+	ptbrDict["Missing mods, install them before playing"] = "Faltam mods, instale-os antes de jogar"
+	ptbrDict["Interrupted, the final sync was skipped. Run syncedpz sync to push your progress"] = "Interrompido, a sincronização final foi pulada. Execute syncedpz sync para enviar seu progresso"
+	ptbrDict["Game closed and servers synced"] = "Jogo fechado e servidores sincronizados"
+	ptbrDict["Synced servers"] = "Servidores sincronizados"
+	ptbrDict["No synced servers, press a to add one or c to clone one"] = "Nenhum servidor sincronizado, pressione a para adicionar um ou c para clonar um"
+	ptbrDict["History"] = "Histórico"
+	ptbrDict["ctrl+c stops at the next safe point"] = "ctrl+c para no próximo ponto seguro"
+	ptbrDict["↑/↓ select • s sync • S sync all • p play • a add • c clone • x delete • e setup • l language • r refresh • q quit"] = "↑/↓ seleciona • s sincroniza • S sincroniza todos • p joga • a adiciona • c clona • x exclui • e configura • l idioma • r atualiza • q sai"
+	ptbrDict["Time between the syncs of the agent"] = "Tempo entre as sincronizações do agente"
+	ptbrDict["  syncedpz agent [-interval 10m] [-conflict mine | theirs | fork] = keeps syncing the servers in the background while the game is closed, including the changes of servers hosted without syncedpz play"] = "  syncedpz agent [-interval 10m] [-conflict mine | theirs | fork] = mantém os servidores sincronizados em segundo plano enquanto o jogo está fechado, incluindo as mudanças de servidores hospedados sem o syncedpz play"
+	ptbrDict["  syncedpz agent status = shows what the running agent did"] = "  syncedpz agent status = mostra o que o agente em execução fez"
+	ptbrDict["The interval of the agent must be at least 1 minute"] = "O intervalo do agente deve ser de pelo menos 1 minuto"
+	ptbrDict["Agent running, close this window to stop it"] = "Agente rodando, feche esta janela para pará-lo"
+	ptbrDict["The agent is not running, start it with syncedpz agent"] = "O agente não está rodando, inicie-o com syncedpz agent"
+	ptbrDict["Agent running since %s (pid %d), syncing every %s\n"] = "Agente rodando desde %s (pid %d), sincronizando a cada %s\n"
+	ptbrDict["  Last cycle:"] = "  Último ciclo:"
+	ptbrDict["  Next cycle:"] = "  Próximo ciclo:"
+	ptbrDict["  Project Zomboid is running, the servers are synced once it closes"] = "  O Project Zomboid está rodando, os servidores são sincronizados quando ele fechar"
+	ptbrDict["    Last update:"] = "    Última atualização:"
+	ptbrDict["Payload of the webhook: json, discord or slack"] = "Formato do webhook: json, discord ou slack"
+	ptbrDict["Comma separated events notified to the webhook, empty notifies the sessions, pushes, conflicts and failures"] = "Eventos notificados ao webhook separados por vírgula, vazio notifica as sessões, envios, conflitos e falhas"
+	ptbrDict["  syncedpz webhook [list | add URL | remove URL | test URL] [-format json | discord | slack] [-events EVENT,...] = notifies URLs when players start or finish playing, push snapshots, or syncs conflict or fail"] = "  syncedpz webhook [list | add URL | remove URL | test URL] [-format json | discord | slack] [-events EVENTO,...] = notifica URLs quando jogadores começam ou terminam de jogar, enviam snapshots, ou sincronizações têm conflitos ou falham"
+	ptbrDict["Events:"] = "Eventos:"
+	ptbrDict["Webhook %s added, check it with syncedpz webhook test %s\n"] = "Webhook %s adicionado, teste-o com syncedpz webhook test %s\n"
+	ptbrDict["Webhook %s removed\n"] = "Webhook %s removido\n"
+	ptbrDict["Test notification sent to %s\n"] = "Notificação de teste enviada para %s\n"
+	ptbrDict["Test notification from %s"] = "Notificação de teste de %s"
+	ptbrDict["%s and the server changed %s at the same time, someone has to choose which world to keep"] = "%s e o servidor mudaram %s ao mesmo tempo, alguém precisa escolher qual mundo manter"
+	ptbrDict["The sync of %s by %s failed: %s"] = "A sincronização de %s por %s falhou: %s"
+	ptbrDict["%s finished syncing %s"] = "%s terminou de sincronizar %s"
+	ptbrDict["%s is syncing %s"] = "%s está sincronizando %s"
+	ptbrDict["%s pushed a new snapshot of %s"] = "%s enviou um novo snapshot de %s"
+	ptbrDict["%s started playing"] = "%s começou a jogar"
+	ptbrDict["%s finished playing"] = "%s terminou de jogar"
+	ptbrDict["%s and the server changed the same settings of %s in %s: %s"] = "%s e o servidor mudaram as mesmas configurações de %s em %s: %s"
+	ptbrDict["Shows the syncs of this period, like 12h or 7d"] = "Mostra as sincronizações deste período, como 12h ou 7d"
+	ptbrDict["Prints each sync as a JSON line"] = "Imprime cada sincronização como uma linha JSON"
+	ptbrDict["  syncedpz log [-server NAME] [-since 7d] [-json] = shows the syncs of the servers, what they pulled or pushed and their errors"] = "  syncedpz log [-server NOME] [-since 7d] [-json] = mostra as sincronizações dos servidores, o que elas baixaram ou enviaram e seus erros"
+	ptbrDict["Invalid period %s, use something like 7d or 12h"] = "Período inválido %s, use algo como 7d ou 12h"
+	ptbrDict["  %d files changed, %.1f MB\n"] = "  %d arquivos alterados, %.1f MB\n"
+	ptbrDict["  Error: %s\n"] = "  Erro: %s\n"
+	ptbrDict["No syncs in this period"] = "Nenhuma sincronização neste período"
+	ptbrDict["Zip archive to create with the log files and the syncs, to attach to bug reports"] = "Arquivo zip a criar com os arquivos de log e as sincronizações, para anexar a relatórios de bugs"
+	ptbrDict["  syncedpz log [-since 7d] -bundle logs.zip = creates an archive with the log files and the syncs to attach to bug reports"] = "  syncedpz log [-since 7d] -bundle logs.zip = cria um arquivo com os arquivos de log e as sincronizações para anexar a relatórios de bugs"
+	ptbrDict["  syncedpz [-log-level debug | info | warn | error] [-log-format text | json] COMMAND = changes the logs, also written to data/logs"] = "  syncedpz [-log-level debug | info | warn | error] [-log-format text | json] COMANDO = muda os logs, também escritos em data/logs"
+	ptbrDict["Logs saved to %s, attach it to the bug report\n"] = "Logs salvos em %s, anexe-o ao relatório de bug\n"
+
+	ptbrDict["  syncedpz doctor = checks the setup, the repositories and the mods and explains how to fix the problems"] = "  syncedpz doctor = verifica a configuração, os repositórios e os mods e explica como corrigir os problemas"
+	ptbrDict["Checking SyncedPZ, the repositories may take a while to answer..."] = "Verificando o SyncedPZ, os repositórios podem demorar para responder..."
+	ptbrDict["       Fix: %s\n"] = "       Correção: %s\n"
+	ptbrDict["Everything looks fine"] = "Tudo parece certo"
+	ptbrDict["%d problems and %d warnings found\n"] = "%d problemas e %d avisos encontrados\n"
+	ptbrDict["Git"] = "Git"
+	ptbrDict["Install git from https://git-scm.com/downloads and open a new terminal"] = "Instale o git de https://git-scm.com/downloads e abra um novo terminal"
+	ptbrDict["Database"] = "Banco de dados"
+	ptbrDict["Close every other SyncedPZ window and run syncedpz doctor again. If it keeps failing, back up the data folder and report it with syncedpz log -bundle logs.zip"] = "Feche todas as outras janelas do SyncedPZ e execute syncedpz doctor de novo. Se continuar falhando, faça backup da pasta data e reporte com syncedpz log -bundle logs.zip"
+	ptbrDict["Project Zomboid paths"] = "Caminhos do Project Zomboid"
+	ptbrDict["not configured"] = "não configurado"
+	ptbrDict["Run syncedpz config setup"] = "Execute syncedpz config setup"
+	ptbrDict["Project Zomboid executable"] = "Executável do Project Zomboid"
+	ptbrDict["Find ProjectZomboid64.bat in the game folder (Steam > Project Zomboid > Manage > Browse local files) and set it with syncedpz config setup"] = "Encontre o ProjectZomboid64.bat na pasta do jogo (Steam > Project Zomboid > Gerenciar > Navegar pelos arquivos locais) e defina-o com syncedpz config setup"
+	ptbrDict["%s is a folder, not the executable"] = "%s é uma pasta, não o executável"
+	ptbrDict["Project Zomboid data folder"] = "Pasta de dados do Project Zomboid"
+	ptbrDict["It's the Zomboid folder of your user, like C:\\Users\\NAME\\Zomboid, set it with syncedpz config setup"] = "É a pasta Zomboid do seu usuário, como C:\\Users\\NOME\\Zomboid, defina-a com syncedpz config setup"
+	ptbrDict["%s is not a folder"] = "%s não é uma pasta"
+	ptbrDict["%s has no Saves folder, it may not be the Zomboid folder"] = "%s não tem uma pasta Saves, pode não ser a pasta Zomboid"
+	ptbrDict["Your Steam ID has 17 digits and starts with 7656119, find it at https://steamid.io and set it with syncedpz config setup"] = "Seu Steam ID tem 17 dígitos e começa com 7656119, encontre-o em https://steamid.io e defina-o com syncedpz config setup"
+	ptbrDict["%s is not a Steam ID"] = "%s não é um Steam ID"
+	ptbrDict["Git credentials"] = "Credenciais do git"
+	ptbrDict["Run syncedpz config setup with your git username and a token that can push to the repositories"] = "Execute syncedpz config setup com seu usuário do git e um token que possa enviar para os repositórios"
+	ptbrDict["Repository %s of %s"] = "Repositório %s de %s"
+	ptbrDict["The repository refused your git credentials, set a valid username and token with syncedpz config setup"] = "O repositório recusou suas credenciais do git, defina um usuário e token válidos com syncedpz config setup"
+	ptbrDict["Your git user can't access the repository, ask its owner to give you access"] = "Seu usuário do git não tem acesso ao repositório, peça acesso ao dono dele"
+	ptbrDict["Check the URL, if the repository moved change it with syncedpz remote set-url -server \"%s\" URL"] = "Verifique a URL, se o repositório mudou de lugar altere-a com syncedpz remote set-url -server \"%s\" URL"
+	ptbrDict["The repository can't be reached, check your internet connection and if its host is up"] = "O repositório não pode ser acessado, verifique sua conexão com a internet e se o host dele está no ar"
+	ptbrDict["Repository integrity of %s"] = "Integridade do repositório de %s"
+	ptbrDict["Back up your world with syncedpz export -server \"%s\" -o world.tar.zst, then get a fresh copy with syncedpz delete -force and syncedpz clone"] = "Faça backup do seu mundo com syncedpz export -server \"%s\" -o world.tar.zst, depois obtenha uma cópia nova com syncedpz delete -force e syncedpz clone"
+	ptbrDict["Mods of %s"] = "Mods de %s"
+	ptbrDict["Sync the server with syncedpz sync to get its config"] = "Sincronize o servidor com syncedpz sync para obter a configuração dele"
+	ptbrDict["%d workshop items and %d mods missing"] = "%d itens da oficina e %d mods faltando"
+	ptbrDict["Subscribe to the missing workshop items and start the game once to download them"] = "Inscreva-se nos itens da oficina faltando e inicie o jogo uma vez para baixá-los"
+	ptbrDict["Mods not found: %s"] = "Mods não encontrados: %s"
+	ptbrDict["%d mods are installed from other workshop items than the ones of the server"] = "%d mods estão instalados de itens da oficina diferentes dos do servidor"
+	ptbrDict["Their versions may differ from the ones of the other players, subscribe to the workshop items of the server"] = "As versões deles podem ser diferentes das dos outros jogadores, inscreva-se nos itens da oficina do servidor"
+	ptbrDict["Disk space"] = "Espaço em disco"
+	ptbrDict["%.1f GB free on the disk of %s, %.1f GB are needed"] = "%.1f GB livres no disco de %s, são necessários %.1f GB"
+	ptbrDict["Free some space, older backups can be removed with syncedpz backups prune"] = "Libere espaço, os backups mais antigos podem ser removidos com syncedpz backups prune"
+	ptbrDict["Close the other SyncedPZ windows, including syncedpz agent, serve and ui, and run syncedpz doctor again"] = "Feche as outras janelas do SyncedPZ, incluindo syncedpz agent, serve e ui, e execute syncedpz doctor de novo"
+	ptbrDict["Back up %s and report the error with the log files of %s"] = "Faça backup de %s e reporte o erro com os arquivos de log de %s"
+	ptbrDict["Deletes the server even if some of its snapshots couldn't be pushed, losing them"] = "Exclui o servidor mesmo se alguns de seus snapshots não puderam ser enviados, perdendo-os"
+	ptbrDict["Nothing was deleted. Sync the server once the repositories are reachable, or use -force to delete it anyway and lose the snapshots"] = "Nada foi excluído. Sincronize o servidor quando os repositórios estiverem acessíveis, ou use -force para excluí-lo mesmo assim e perder os snapshots"
 
 	dict[LANG_PTBR] = ptbrDict
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os/exec"
 	"syncedpz/pkg/utils"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -21,22 +23,46 @@ var (
 	PZ_SteamID  string
 	GitAuth     transport.AuthMethod
 	ServersPath = DataPath + "/servers"
+	BackupsPath = DataPath + "/backups"
+	LocksPath   = DataPath + "/locks"
+	LogsPath    = DataPath + "/logs"
 	Launguage   int
+	// Push saves even if they fail the verification
+	SkipVerify bool
+	// How the divergences found when syncing are resolved: mine, theirs or fork. Empty asks the player
+	ConflictResolution string
+	// Retention policy of the local backups, 0 means unlimited
+	BackupMaxCount   = DefaultBackupMaxCount
+	BackupMaxAgeDays = DefaultBackupMaxAgeDays
+	BackupMaxSizeMB  = DefaultBackupMaxSizeMB
+	// Network operations: timeout of each attempt, retries of transient failures and the first delay
+	// between them, doubled on each retry
+	NetworkTimeout = DefaultNetworkTimeoutSeconds * time.Second
+	NetworkRetries = DefaultNetworkRetries
+	NetworkBackoff = DefaultNetworkBackoffSeconds * time.Second
+	// Socket the agent answers its state on
+	AgentSocketPath = DataPath + "/agent.sock"
+	// Token the clients of the local API send in the Authorization header
+	APIToken string
 )
 
 func IsLanguageValid(lang int) bool {
 	return lang > LANG_START && lang < LANG_END
 }
 
-func checkExistenceOfGit() {
-	_, err := exec.LookPath("git")
-	if err != nil {
-		log.Fatal("Git is not installed. Install it")
+// CheckExistenceOfGit returns an error if git is not installed
+func CheckExistenceOfGit() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git is not installed")
 	}
+	return nil
 }
 
 func init() {
 	utils.EnsureDir(DataPath)
 	utils.EnsureDir(ServersPath)
-	checkExistenceOfGit()
+	utils.EnsureDir(BackupsPath)
+	if err := CheckExistenceOfGit(); err != nil {
+		log.Warn("Git is not installed, run syncedpz doctor for help")
+	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syncedpz/config"
@@ -12,15 +13,20 @@ import (
 
 func main() {
 	defer os.Exit(0)
-	defer func() {
-		config.DB.Close()
-		log.Info("BadgerDB closed")
-	}()
+	defer config.CloseDB()
 
-	// Gracefully shutdown
+	// Gracefully shutdown, the first interrupt stops the running command at a safe point
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-	go cli.Run(ch)
+	go cli.Run(ctx, ch)
 
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		// A second interrupt kills the process right away
+		stop()
+		log.Warn("Interrupted, stopping at the next safe point. Interrupt again to exit right away")
+		<-ch
+	}
 }
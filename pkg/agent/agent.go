@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syncedpz/config"
+	"syncedpz/pkg/syncedpz"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ErrNotRunning is returned by Query when no agent answers on the socket
+var ErrNotRunning = errors.New("the agent is not running")
+
+// ServerState is the result of the last check of a server by the agent
+type ServerState struct {
+	Name      string    `json:"name"`
+	LastCheck time.Time `json:"last_check"`
+	// synced, updated, offline, diverged, failed or skipped
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// Last time the agent pulled or pushed a snapshot of the server
+	LastUpdate time.Time `json:"last_update,omitempty"`
+}
+
+// State is the state of the agent, answered on its socket
+type State struct {
+	PID             int           `json:"pid"`
+	StartedAt       time.Time     `json:"started_at"`
+	IntervalSeconds int           `json:"interval_seconds"`
+	LastCycle       time.Time     `json:"last_cycle"`
+	NextCycle       time.Time     `json:"next_cycle"`
+	GameRunning     bool          `json:"game_running"`
+	Servers         []ServerState `json:"servers"`
+}
+
+// Agent syncs every server periodically in the background
+type Agent struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	state State
+}
+
+// New returns an agent that syncs the servers every interval
+func New(interval time.Duration) *Agent {
+	return &Agent{
+		interval: interval,
+		state: State{
+			PID:             os.Getpid(),
+			StartedAt:       time.Now(),
+			IntervalSeconds: int(interval / time.Second),
+			Servers:         []ServerState{},
+		},
+	}
+}
+
+// State returns a copy of the state of the agent
+func (a *Agent) State() State {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	state := a.state
+	state.Servers = append([]ServerState{}, a.state.Servers...)
+	return state
+}
+
+// checkServer syncs the server unless it's being synced by another process. The sync pulls the changes
+// of the repository or pushes the local ones, like the ones made by hosting without syncedpz play
+func checkServer(ctx context.Context, ss *syncedpz.SyncedServer, previous ServerState) ServerState {
+	state := ServerState{Name: ss.Name, LastCheck: time.Now(), Result: "synced", LastUpdate: previous.LastUpdate}
+	if ss.IsLocked() {
+		state.Result = "skipped"
+		log.Infof("%s is being synced by another SyncedPZ process, skipping it", ss.Name)
+		return state
+	}
+
+	before := ss.GetLastSync()
+	err := ss.Sync(ctx)
+	var divergence *syncedpz.DivergenceError
+	if errors.As(err, &divergence) && config.ConflictResolution != "" {
+		var resolution syncedpz.Resolution
+		if resolution, err = syncedpz.ParseResolution(config.ConflictResolution); err == nil {
+			err = ss.ResolveDivergence(ctx, resolution)
+		}
+	}
+
+	switch {
+	case err == nil:
+		if after := ss.GetLastSync(); after != nil && (before == nil || before.Commit != after.Commit) {
+			state.Result = "updated"
+			state.LastUpdate = state.LastCheck
+		}
+	case errors.Is(err, syncedpz.ErrOffline):
+		state.Result = "offline"
+	case errors.As(err, &divergence):
+		// Nobody can be asked, it waits for syncedpz sync
+		state.Result = "diverged"
+		state.Error = err.Error()
+		log.Warnf("%s, run syncedpz sync to resolve it", err)
+	default:
+		state.Result = "failed"
+		state.Error = err.Error()
+		log.Errorf("Could not sync %s: %s", ss.Name, err)
+	}
+	return state
+}
+
+// cycle syncs every server, unless Project Zomboid is running: the saves are being written and syncedpz
+// play syncs them meanwhile. The database is only open during the cycle, so the other commands can use it
+// between the cycles
+func (a *Agent) cycle(ctx context.Context) {
+	running := syncedpz.IsGameRunning()
+
+	a.mu.Lock()
+	a.state.GameRunning = running
+	previous := make(map[string]ServerState)
+	for _, state := range a.state.Servers {
+		previous[state.Name] = state
+	}
+	a.mu.Unlock()
+
+	if running {
+		log.Info("Project Zomboid is running, the servers will be synced once it closes")
+	} else if err := config.TryOpenDB(); err != nil {
+		// Another command is using the servers, they are checked in the next cycle
+		log.Infof("Could not open the database, the servers will be synced in the next cycle: %s", err)
+	} else {
+		defer config.CloseDB()
+		states := []ServerState{}
+		for _, ss := range syncedpz.GetSyncedServers() {
+			if ctx.Err() != nil {
+				return
+			}
+			states = append(states, checkServer(ctx, ss, previous[ss.Name]))
+		}
+
+		a.mu.Lock()
+		a.state.Servers = states
+		a.mu.Unlock()
+	}
+
+	a.mu.Lock()
+	a.state.LastCycle = time.Now()
+	a.state.NextCycle = a.state.LastCycle.Add(a.interval)
+	a.mu.Unlock()
+}
+
+// Run syncs the servers every interval and answers the state on the socket until the context is done
+func (a *Agent) Run(ctx context.Context) error {
+	if _, err := Query(ctx); err == nil {
+		return errors.New("an agent is already running")
+	}
+	// Left by an agent that didn't stop cleanly
+	os.Remove(config.AgentSocketPath)
+
+	ln, err := net.Listen("unix", config.AgentSocketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(config.AgentSocketPath)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(a.State()); err != nil {
+			log.Error(err)
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	log.Infof("Agent started, syncing the servers every %s", a.interval)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		a.cycle(ctx)
+		select {
+		case <-ctx.Done():
+			log.Info("Agent stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Query returns the state of the running agent, ErrNotRunning if there's none
+func Query(ctx context.Context) (*State, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", config.AgentSocketPath)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://agent/state", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the agent answered %s", res.Status)
+	}
+
+	state := &State{}
+	if err := json.NewDecoder(res.Body).Decode(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
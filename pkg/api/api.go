@@ -0,0 +1,462 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syncedpz/config"
+	"syncedpz/pkg/syncedpz"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// DefaultAddr is the address the API listens on by default, only reachable from this computer
+const DefaultAddr = "127.0.0.1:8765"
+
+// Files of the web dashboard, served at the root. They hold no data, so they are served without the token
+//
+//go:embed web
+var webFS embed.FS
+
+// SyncResult is the result of syncing a server
+type SyncResult struct {
+	Server string `json:"server"`
+	// synced, offline, diverged or failed
+	Result     string                    `json:"result"`
+	Error      string                    `json:"error,omitempty"`
+	Divergence *syncedpz.DivergenceError `json:"divergence,omitempty"`
+}
+
+// PlayState is the state of the game started by the API
+type PlayState struct {
+	Playing   bool       `json:"playing"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// Results of the last sync of every server since the game was started
+	LastSync []SyncResult `json:"last_sync,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Server serves the JSON API of SyncedPZ
+type Server struct {
+	// Done when the API stops, long operations keep running if their request is cancelled
+	ctx   context.Context
+	token string
+
+	mu     sync.Mutex
+	play   PlayState
+	game   sync.WaitGroup
+	events broker
+}
+
+// NewServer returns the API server. Every request must send the token in the Authorization header
+func NewServer(ctx context.Context, token string) *Server {
+	return &Server{ctx: ctx, token: token}
+}
+
+// Handler returns the handler of the API routes and the web dashboard
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/servers", s.listServers)
+	mux.HandleFunc("POST /api/sync", s.syncAll)
+	mux.HandleFunc("GET /api/servers/{name}/status", s.serverStatus)
+	mux.HandleFunc("POST /api/servers/{name}/sync", s.syncServer)
+	mux.HandleFunc("POST /api/servers/{name}/resolve", s.resolveDivergence)
+	mux.HandleFunc("GET /api/servers/{name}/history", s.serverHistory)
+	mux.HandleFunc("GET /api/servers/{name}/tags", s.serverTags)
+	mux.HandleFunc("POST /api/servers/{name}/restore", s.restoreSnapshot)
+	mux.HandleFunc("GET /api/servers/{name}/lock", s.lockState)
+	mux.HandleFunc("GET /api/play", s.playState)
+	mux.HandleFunc("POST /api/play", s.startPlay)
+
+	web, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(err)
+	}
+	root := http.NewServeMux()
+	// The stream stays open, it opens the database only while reading the servers
+	root.Handle("GET /api/events", s.authenticate(http.HandlerFunc(s.streamEvents)))
+	root.Handle("/api/", s.authenticate(withDB(mux)))
+	root.Handle("/", http.FileServerFS(web))
+	return root
+}
+
+// ListenAndServe serves the API and the web dashboard on the address until the context is done
+func ListenAndServe(ctx context.Context, addr, token string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, ln, token)
+}
+
+// Serve serves the API and the web dashboard on the listener until the context is done. It then waits for
+// the game started by the API to close
+func Serve(ctx context.Context, ln net.Listener, token string) error {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		log.Warnf("The API is listening on %s, other computers of the network can reach it", addr)
+	}
+
+	s := NewServer(ctx, token)
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+	go s.watchLocks()
+	log.Infof("API listening on http://%s", ln.Addr())
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info("Stopping the API")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+
+	if s.getPlayState().Playing {
+		log.Info("Waiting for Project Zomboid to close")
+	}
+	s.game.Wait()
+	return err
+}
+
+// authenticate rejects the requests without the token in the Authorization header
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withDB opens the database during the request. It waits while another SyncedPZ process has it open, until
+// the client gives up
+func withDB(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := config.OpenDB(r.Context()); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		defer config.CloseDB()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeStatus answers with the status of the server
+func writeStatus(w http.ResponseWriter, ss *syncedpz.SyncedServer) {
+	status, err := ss.GetStatus()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// readJSON decodes the body of the request, answering with an error if it's invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// getServer returns the synced server of the path, answering with an error if it doesn't exist
+func getServer(w http.ResponseWriter, r *http.Request) (*syncedpz.SyncedServer, bool) {
+	ss, err := syncedpz.GetSyncedServer(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	return ss, true
+}
+
+// syncResult syncs the server, resolving the divergences with the configured resolution if any, unless
+// resolve is false while the game is running
+func syncResult(ctx context.Context, ss *syncedpz.SyncedServer, resolve bool) SyncResult {
+	err := ss.Sync(ctx)
+	var divergence *syncedpz.DivergenceError
+	if errors.As(err, &divergence) && config.ConflictResolution != "" && resolve {
+		var resolution syncedpz.Resolution
+		if resolution, err = syncedpz.ParseResolution(config.ConflictResolution); err == nil {
+			err = ss.ResolveDivergence(ctx, resolution)
+		}
+	}
+
+	result := SyncResult{Server: ss.Name, Result: "synced"}
+	switch {
+	case err == nil:
+	case errors.Is(err, syncedpz.ErrOffline):
+		result.Result = "offline"
+	case errors.As(err, &divergence):
+		result.Result = "diverged"
+		result.Error = err.Error()
+		result.Divergence = divergence
+	default:
+		log.Errorf("Could not sync %s: %s", ss.Name, err)
+		result.Result = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// syncServers syncs every server, stopping when the context is done
+func syncServers(ctx context.Context, resolve bool) []SyncResult {
+	results := []SyncResult{}
+	for _, ss := range syncedpz.GetSyncedServers() {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, syncResult(ctx, ss, resolve))
+	}
+	return results
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	statuses := []syncedpz.ServerStatus{}
+	for _, ss := range syncedpz.GetSyncedServers() {
+		status, err := ss.GetStatus()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) syncAll(w http.ResponseWriter, r *http.Request) {
+	results := syncServers(s.ctx, !syncedpz.IsGameRunning())
+	s.publishServers()
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) serverStatus(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+	writeStatus(w, ss)
+}
+
+func (s *Server) syncServer(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+
+	result := syncResult(s.ctx, ss, !syncedpz.IsGameRunning())
+	s.publishServers()
+	status := http.StatusOK
+	switch result.Result {
+	case "diverged":
+		status = http.StatusConflict
+	case "failed":
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result)
+}
+
+func (s *Server) resolveDivergence(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Resolution string `json:"resolution"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	resolution, err := syncedpz.ParseResolution(body.Resolution)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := ss.ResolveDivergence(s.ctx, resolution); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.publishServers()
+	writeStatus(w, ss)
+}
+
+func (s *Server) serverHistory(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number, or 0 for every snapshot"))
+			return
+		}
+	}
+	history, err := ss.GetHistory(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+func (s *Server) serverTags(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, ss.GetTags())
+}
+
+func (s *Server) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		// Tag or snapshot hash
+		Target string `json:"target"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Target == "" {
+		writeError(w, http.StatusBadRequest, errors.New("target is required"))
+		return
+	}
+	if s.getPlayState().Playing {
+		writeError(w, http.StatusConflict, errors.New("can't restore while Project Zomboid is running"))
+		return
+	}
+
+	if err := ss.RestoreSnapshot(s.ctx, body.Target); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.publishServers()
+	writeStatus(w, ss)
+}
+
+func (s *Server) lockState(w http.ResponseWriter, r *http.Request) {
+	ss, ok := getServer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"locked": ss.IsLocked()})
+}
+
+func (s *Server) getPlayState() PlayState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.play
+}
+
+func (s *Server) playState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.getPlayState())
+}
+
+// startPlay syncs every server and starts Project Zomboid in the background, syncing them while it runs
+// and once it closes, like syncedpz play. Refused if a required mod is missing
+func (s *Server) startPlay(w http.ResponseWriter, r *http.Request) {
+	missing := map[string]syncedpz.ModReport{}
+	for _, ss := range syncedpz.GetSyncedServers() {
+		if report, err := ss.VerifyMods(); err == nil && !report.OK() {
+			missing[ss.Name] = report
+		}
+	}
+	if len(missing) > 0 {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": "missing mods, install them before playing", "mods": missing})
+		return
+	}
+
+	s.mu.Lock()
+	if s.play.Playing {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, errors.New("Project Zomboid is already running"))
+		return
+	}
+	now := time.Now()
+	s.play = PlayState{Playing: true, StartedAt: &now}
+	state := s.play
+	s.mu.Unlock()
+	s.publishPlay()
+
+	s.game.Add(1)
+	go func() {
+		defer s.game.Done()
+		s.runGame()
+	}()
+	writeJSON(w, http.StatusAccepted, state)
+}
+
+func (s *Server) runGame() {
+	// The database is only open during the syncs, the game runs for hours. The divergences found while it
+	// runs are only resolved once it closes
+	syncAll := func(resolve bool) {
+		if err := config.OpenDB(s.ctx); err != nil {
+			log.Errorf("Could not sync the servers: %s", err)
+			return
+		}
+		defer config.CloseDB()
+
+		results := syncServers(s.ctx, resolve)
+		s.mu.Lock()
+		s.play.LastSync = results
+		s.mu.Unlock()
+		s.publishPlay()
+		s.publishServers()
+	}
+
+	syncAll(true)
+	err := syncedpz.RunGame(s.ctx, syncedpz.SyncInterval, func() {
+		syncAll(false)
+	})
+	if err == nil && s.ctx.Err() == nil {
+		syncAll(true)
+	} else if err == nil {
+		log.Warn("Interrupted, the final sync was skipped. Run syncedpz sync to push your progress")
+	}
+
+	s.mu.Lock()
+	s.play.Playing = false
+	if err != nil {
+		log.Error(err)
+		s.play.Error = err.Error()
+	}
+	s.mu.Unlock()
+	s.publishPlay()
+}
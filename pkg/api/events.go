@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"syncedpz/config"
+	"syncedpz/pkg/syncedpz"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// How often the lock of the servers is checked, to notice the syncs of other SyncedPZ processes
+const watchInterval = 2 * time.Second
+
+// How often the watched servers are read from the database, to notice the added and deleted ones
+const refreshInterval = 30 * time.Second
+
+// Event is a live update sent to the clients of /api/events as a Server-Sent Event
+type Event struct {
+	// servers, play or lock
+	Type string
+	Data any
+}
+
+// LockEvent is sent when a server starts or stops being synced
+type LockEvent struct {
+	Server string `json:"server"`
+	Locked bool   `json:"locked"`
+}
+
+// broker sends the events to every subscribed client
+type broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func (b *broker) subscribe() chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, 16)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *broker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// publish sends the event to the subscribers, skipping the ones too slow to receive it
+func (b *broker) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// serversEvent returns the status of every server, waiting until the context is done for the database
+func serversEvent(ctx context.Context) (Event, error) {
+	if err := config.OpenDB(ctx); err != nil {
+		return Event{}, err
+	}
+	defer config.CloseDB()
+
+	statuses := []syncedpz.ServerStatus{}
+	for _, ss := range syncedpz.GetSyncedServers() {
+		status, err := ss.GetStatus()
+		if err != nil {
+			return Event{}, err
+		}
+		statuses = append(statuses, status)
+	}
+	return Event{Type: "servers", Data: statuses}, nil
+}
+
+// publishServers sends the status of every server to the clients
+func (s *Server) publishServers() {
+	event, err := serversEvent(s.ctx)
+	if err != nil {
+		log.Debugf("Could not publish the servers: %s", err)
+		return
+	}
+	s.events.publish(event)
+}
+
+// publishPlay sends the state of the game to the clients
+func (s *Server) publishPlay() {
+	s.events.publish(Event{Type: "play", Data: s.getPlayState()})
+}
+
+// watchLocks publishes the servers that start or stop being synced, by the API or by another process,
+// until the API stops. The servers are read again from the database every refreshInterval, the ones read
+// before are watched while another process uses it. Their status is published once it's free
+func (s *Server) watchLocks() {
+	locked := make(map[string]bool)
+	var servers []*syncedpz.SyncedServer
+	var refreshed time.Time
+	changed := false
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		dbOpen := false
+		if changed || time.Since(refreshed) >= refreshInterval {
+			dbOpen = config.TryOpenDB() == nil
+		}
+		if dbOpen {
+			servers = syncedpz.GetSyncedServers()
+			refreshed = time.Now()
+		}
+
+		for _, ss := range servers {
+			isLocked := ss.IsLocked()
+			if isLocked != locked[ss.Name] {
+				locked[ss.Name] = isLocked
+				changed = true
+				s.events.publish(Event{Type: "lock", Data: LockEvent{Server: ss.Name, Locked: isLocked}})
+			}
+		}
+		if changed && dbOpen {
+			s.publishServers()
+			changed = false
+		}
+		if dbOpen {
+			config.CloseDB()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// streamEvents sends the live updates as Server-Sent Events, starting with the current state
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+	servers, err := serversEvent(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	initial := []Event{servers, {Type: "play", Data: s.getPlayState()}}
+	for _, event := range initial {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	// Keeps the connection alive through proxies and notices the closed clients
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case event := <-ch:
+			if err := writeEvent(w, event); err != nil {
+				log.Debug(err)
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,335 @@
+"use strict";
+
+// The token is given in the address opened by syncedpz ui, then kept for the session
+const tokenMatch = location.hash.match(/token=([^&]+)/);
+if (tokenMatch) {
+  sessionStorage.setItem("token", decodeURIComponent(tokenMatch[1]));
+  history.replaceState(null, "", location.pathname);
+}
+
+let servers = [];
+const locked = {};
+const divergences = {};
+// History of the servers whose timeline is open
+const timelines = {};
+let play = { playing: false };
+let busy = false;
+
+function token() {
+  return sessionStorage.getItem("token") || "";
+}
+
+function showLogin() {
+  document.getElementById("login").hidden = false;
+}
+
+function showMessage(text, isError) {
+  const message = document.getElementById("message");
+  message.textContent = text;
+  message.className = isError ? "error" : "";
+  message.hidden = !text;
+}
+
+async function api(method, path, body) {
+  const response = await fetch(path, {
+    method,
+    headers: {
+      Authorization: "Bearer " + token(),
+      "Content-Type": "application/json",
+    },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  if (response.status === 401) {
+    showLogin();
+  }
+  const data = await response.json();
+  return { ok: response.ok, status: response.status, data };
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith("0001-")) {
+    return "never";
+  }
+  return new Date(value).toLocaleString();
+}
+
+function subject(message) {
+  return (message || "").split("\n")[0].trim();
+}
+
+function commitLabel(commit) {
+  if (!commit) {
+    return "none";
+  }
+  return `${commit.hash.slice(0, 8)} · ${formatTime(commit.time)} · ${commit.author} · ${subject(commit.message)}`;
+}
+
+// run runs an action of a button, disabling the buttons until it finishes
+async function run(label, action) {
+  busy = true;
+  render();
+  showMessage(label + "…", false);
+  try {
+    const text = await action();
+    showMessage(text || "", false);
+  } catch (err) {
+    showMessage(err.message, true);
+  } finally {
+    busy = false;
+    render();
+  }
+}
+
+function syncServer(name) {
+  return run("Syncing " + name, async () => {
+    const { ok, data } = await api("POST", `/api/servers/${encodeURIComponent(name)}/sync`);
+    if (data.result === "diverged") {
+      divergences[name] = data.divergence;
+      return `${name} changed locally and in its repository, choose which snapshot to keep`;
+    }
+    delete divergences[name];
+    if (!ok) {
+      throw new Error(data.error);
+    }
+    return data.result === "offline"
+      ? `${name} is offline, the local changes will be pushed on the next sync`
+      : `${name} synced`;
+  });
+}
+
+function syncAll() {
+  return run("Syncing every server", async () => {
+    const { data } = await api("POST", "/api/sync");
+    const problems = [];
+    for (const result of data) {
+      if (result.result === "diverged") {
+        divergences[result.server] = result.divergence;
+      } else {
+        delete divergences[result.server];
+      }
+      if (result.result !== "synced") {
+        problems.push(`${result.server}: ${result.result}`);
+      }
+    }
+    return problems.length ? problems.join(", ") : "Every server synced";
+  });
+}
+
+function resolve(name, resolution) {
+  return run("Resolving " + name, async () => {
+    const { ok, data } = await api("POST", `/api/servers/${encodeURIComponent(name)}/resolve`, { resolution });
+    if (!ok) {
+      throw new Error(data.error);
+    }
+    delete divergences[name];
+    return `${name} resolved`;
+  });
+}
+
+function restore(name, target) {
+  if (!target || !confirm(`Restore ${name} to ${target} for every player? The local save is backed up first.`)) {
+    return;
+  }
+  return run(`Restoring ${name} to ${target}`, async () => {
+    const { ok, data } = await api("POST", `/api/servers/${encodeURIComponent(name)}/restore`, { target });
+    if (!ok) {
+      throw new Error(data.error);
+    }
+    return `${name} restored to ${target}`;
+  });
+}
+
+function startPlay() {
+  return run("Starting Project Zomboid", async () => {
+    const { ok, data } = await api("POST", "/api/play");
+    if (!ok) {
+      const missing = data.mods ? ": " + Object.keys(data.mods).join(", ") : "";
+      throw new Error(data.error + missing);
+    }
+    return "Project Zomboid is starting, the servers are synced every 5 minutes while it runs";
+  });
+}
+
+async function loadTimeline(name) {
+  const { ok, data } = await api("GET", `/api/servers/${encodeURIComponent(name)}/history?limit=20`);
+  if (!ok) {
+    showMessage(data.error, true);
+    return;
+  }
+  timelines[name] = data;
+  render();
+}
+
+function renderTimeline(name, list) {
+  for (const commit of timelines[name]) {
+    const item = document.createElement("li");
+    const text = document.createElement("div");
+    text.textContent = subject(commit.message);
+    for (const tag of commit.tags || []) {
+      const span = document.createElement("span");
+      span.className = "tag";
+      span.textContent = "#" + tag;
+      text.append(span);
+    }
+    const meta = document.createElement("div");
+    meta.className = "meta";
+    meta.textContent = `${commit.hash.slice(0, 8)} · ${formatTime(commit.time)} · ${commit.author}`;
+    text.append(meta);
+
+    const button = document.createElement("button");
+    button.textContent = "Restore";
+    button.disabled = busy || play.playing;
+    button.onclick = () => restore(name, (commit.tags && commit.tags[0]) || commit.hash.slice(0, 8));
+    item.append(text, button);
+    list.append(item);
+  }
+}
+
+function renderServer(status) {
+  const template = document.getElementById("server-template");
+  const section = template.content.firstElementChild.cloneNode(true);
+  const field = (selector) => section.querySelector(selector);
+
+  field(".name").textContent = status.name;
+  field(".lock").hidden = !locked[status.name];
+  if (status.queued > 0) {
+    field(".queued").hidden = false;
+    field(".queued").textContent = `${status.queued} queued`;
+  }
+  if (status.conflicts > 0) {
+    field(".conflicts").hidden = false;
+    field(".conflicts").textContent = `${status.conflicts} config conflicts`;
+  }
+  field(".branch").textContent = status.branch || "main";
+  field(".players").textContent = (status.players || []).join(", ") || "none";
+  field(".last-sync").textContent = status.last_sync ? formatTime(status.last_sync.time) : "never";
+  field(".last-commit").textContent = commitLabel(status.last_commit);
+
+  const remotes = field(".remotes");
+  for (const remote of status.remotes || []) {
+    const line = document.createElement("div");
+    line.className = remote.consecutive_failures > 0 ? "remote unreachable" : "remote";
+    line.textContent = remote.consecutive_failures > 0 ? `${remote.url} (${remote.last_error})` : remote.url;
+    remotes.append(line);
+  }
+
+  const divergence = field(".divergence");
+  divergence.hidden = !divergences[status.name];
+  for (const button of divergence.querySelectorAll("button")) {
+    button.disabled = busy;
+    button.onclick = () => resolve(status.name, button.dataset.resolution);
+  }
+
+  const disabled = busy || locked[status.name];
+  field(".sync").disabled = disabled;
+  field(".sync").onclick = () => syncServer(status.name);
+  field(".restore").disabled = disabled || play.playing;
+  field(".restore").onclick = () => restore(status.name, prompt("Tag or snapshot to restore:"));
+
+  const timeline = field(".timeline");
+  timeline.hidden = !timelines[status.name];
+  if (!timeline.hidden) {
+    renderTimeline(status.name, timeline);
+  }
+  field(".history-toggle").onclick = () => {
+    if (timelines[status.name]) {
+      delete timelines[status.name];
+      render();
+    } else {
+      loadTimeline(status.name);
+    }
+  };
+  return section;
+}
+
+function render() {
+  const container = document.getElementById("servers");
+  if (servers.length === 0) {
+    container.textContent = "No synced servers yet, add or clone one with syncedpz.";
+  } else {
+    container.replaceChildren(...servers.map(renderServer));
+  }
+
+  document.getElementById("play-state").textContent = play.playing
+    ? "Playing since " + formatTime(play.started_at)
+    : play.error || "";
+  document.getElementById("play-button").disabled = busy || play.playing;
+  document.getElementById("sync-all-button").disabled = busy;
+}
+
+function handleEvent(type, data) {
+  switch (type) {
+    case "servers":
+      servers = data;
+      // The open timelines may have new snapshots
+      for (const name of Object.keys(timelines)) {
+        loadTimeline(name);
+      }
+      break;
+    case "play":
+      play = data;
+      break;
+    case "lock":
+      locked[data.server] = data.locked;
+      break;
+  }
+  render();
+}
+
+// listen receives the live updates. EventSource can't send the Authorization header, so the
+// Server-Sent Events are read from a fetch stream
+async function listen() {
+  for (;;) {
+    try {
+      const response = await fetch("/api/events", { headers: { Authorization: "Bearer " + token() } });
+      if (response.status === 401) {
+        showLogin();
+        return;
+      }
+      const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buffer = "";
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) {
+          break;
+        }
+        buffer += value;
+        let end;
+        while ((end = buffer.indexOf("\n\n")) >= 0) {
+          const block = buffer.slice(0, end);
+          buffer = buffer.slice(end + 2);
+          let type = "message";
+          let data = "";
+          for (const line of block.split("\n")) {
+            if (line.startsWith("event: ")) {
+              type = line.slice(7);
+            } else if (line.startsWith("data: ")) {
+              data += line.slice(6);
+            }
+          }
+          if (data) {
+            handleEvent(type, JSON.parse(data));
+          }
+        }
+      }
+    } catch (err) {
+      showMessage("Disconnected from SyncedPZ, retrying…", true);
+    }
+    await new Promise((resolve) => setTimeout(resolve, 3000));
+  }
+}
+
+document.getElementById("login-form").onsubmit = (event) => {
+  event.preventDefault();
+  sessionStorage.setItem("token", document.getElementById("token").value);
+  document.getElementById("login").hidden = true;
+  listen();
+};
+document.getElementById("play-button").onclick = startPlay;
+document.getElementById("sync-all-button").onclick = syncAll;
+
+if (token()) {
+  listen();
+} else {
+  showLogin();
+}
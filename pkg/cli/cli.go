@@ -2,12 +2,20 @@ package cli
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"syncedpz/config"
+	"syncedpz/pkg/api"
 	"syncedpz/pkg/syncedpz"
+	"syncedpz/pkg/utils"
+	"time"
 
 	"github.com/charmbracelet/log"
 )
@@ -20,19 +28,132 @@ func tryParseCommand(cmd *flag.FlagSet) {
 	}
 }
 
-func Run(ch chan os.Signal) {
+// tryParseCommandInterspersed is tryParseCommand allowing the positional arguments before the flags,
+// like "import world.tar.zst -url URL"
+func tryParseCommandInterspersed(cmd *flag.FlagSet) []string {
+	args := os.Args[2:]
+	positional := []string{}
+	for {
+		if err := cmd.Parse(args); err != nil {
+			cmd.Usage()
+			runtime.Goexit()
+		}
+		if cmd.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, cmd.Arg(0))
+		args = cmd.Args()[1:]
+	}
+}
+
+// extractLogFlags removes the -log-level and -log-format flags from the arguments and returns them. They
+// are accepted before or after the command
+func extractLogFlags() (level, format string) {
+	args := []string{os.Args[0]}
+	for i := 1; i < len(os.Args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(os.Args[i], "-"), "=")
+		if !strings.HasPrefix(os.Args[i], "-") || (name != "log-level" && name != "log-format") {
+			args = append(args, os.Args[i])
+			continue
+		}
+		if !hasValue && i+1 < len(os.Args) {
+			i++
+			value = os.Args[i]
+		}
+		if name == "log-level" {
+			level = value
+		} else {
+			format = value
+		}
+	}
+	os.Args = args
+	return level, format
+}
+
+// setupLogging sets the level and format of the logs and copies them to the rotating log file, along
+// with the output of the commands
+func setupLogging(level, format string) {
+	if level != "" {
+		lvl, err := log.ParseLevel(level)
+		if err != nil {
+			log.Fatalf("Invalid log level %s, use debug, info, warn, error or fatal", level)
+		}
+		log.SetLevel(lvl)
+	}
+	switch format {
+	case "", "text":
+	case "json":
+		log.SetFormatter(log.JSONFormatter)
+	default:
+		log.Fatalf("Invalid log format %s, use text or json", format)
+	}
+	log.SetReportTimestamp(true)
+
+	file, err := utils.OpenRotatingFile(filepath.Join(config.LogsPath, "syncedpz.log"), config.DefaultLogMaxSizeMB*1024*1024, config.DefaultLogMaxFiles)
+	if err != nil {
+		log.Warnf("Could not open the log file, logging to the console only: %s", err)
+		return
+	}
+	utils.LogFile = file
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	utils.Output = io.MultiWriter(os.Stdout, utils.NewLineWriter(file))
+	if len(os.Args) > 1 {
+		// Only the command, the arguments may have secrets like the API token
+		log.Debugf("Running syncedpz %s", os.Args[1])
+	}
+}
+
+// isCommand returns true if the arguments start with the command and its subcommands
+func isCommand(names ...string) bool {
+	return len(os.Args) > len(names) && slices.Equal(os.Args[1:len(names)+1], names)
+}
+
+// loadConfig opens the database and loads the config, asking for it the first time
+func loadConfig(ctx context.Context) {
+	utils.HandleErr(config.OpenDB(ctx))
+	if err := syncedpz.LoadLanguage(); err != nil {
+		setLanguage()
+	}
+	utils.HandleErr(syncedpz.LoadBackupPolicy())
+	utils.HandleErr(syncedpz.LoadNetworkPolicy())
+
+	if config.FirstTimeSetup {
+		fmt.Println(config.GTM("First time setup"))
+	}
+	setup()
+}
+
+// Run runs the command of the arguments. The context is done when the user interrupts the program, the
+// running command then stops at the next safe point
+func Run(ctx context.Context, ch chan os.Signal) {
 	defer func() {
-		// Read a single byte (key press)
-		fmt.Print(config.GTM("Press any key to exit..."))
-		reader := bufio.NewReader(os.Stdin)
-		_, _ = reader.ReadByte()
+		if ctx.Err() == nil {
+			// Read a single byte (key press)
+			fmt.Print(config.GTM("Press any key to exit..."))
+			pressed := make(chan struct{})
+			go func() {
+				reader := bufio.NewReader(os.Stdin)
+				_, _ = reader.ReadByte()
+				close(pressed)
+			}()
+			select {
+			case <-pressed:
+			case <-ctx.Done():
+			}
+		}
 
 		// Send interrupt signal to main
 		ch <- os.Interrupt
 	}()
 
-	if err := syncedpz.LoadLanguage(); err != nil {
-		setLanguage()
+	setupLogging(extractLogFlags())
+	// The doctor opens the database itself to diagnose it, and the status of the agent is asked to the
+	// agent, so they don't wait for the processes using the database
+	if !isCommand("doctor") && !isCommand("agent", "status") {
+		loadConfig(ctx)
+	} else if config.TryOpenDB() == nil {
+		_ = syncedpz.LoadLanguage()
+		config.CloseDB()
 	}
 
 	menuCmd := flag.NewFlagSet("menu", flag.ExitOnError)
@@ -44,16 +165,75 @@ func Run(ch chan os.Signal) {
 	syncCmd := flag.NewFlagSet("sync", flag.ExitOnError)
 	playCmd := flag.NewFlagSet("play", flag.ExitOnError)
 	languageCmd := flag.NewFlagSet("language", flag.ExitOnError)
+	resolveCmd := flag.NewFlagSet("resolve", flag.ExitOnError)
+	settingsCmd := flag.NewFlagSet("settings", flag.ExitOnError)
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	backupsCmd := flag.NewFlagSet("backups", flag.ExitOnError)
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	renameCmd := flag.NewFlagSet("rename", flag.ExitOnError)
+	remoteCmd := flag.NewFlagSet("remote", flag.ExitOnError)
+	branchCmd := flag.NewFlagSet("branch", flag.ExitOnError)
+	tagCmd := flag.NewFlagSet("tag", flag.ExitOnError)
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	uiCmd := flag.NewFlagSet("ui", flag.ExitOnError)
+	agentCmd := flag.NewFlagSet("agent", flag.ExitOnError)
+	webhookCmd := flag.NewFlagSet("webhook", flag.ExitOnError)
+	logCmd := flag.NewFlagSet("log", flag.ExitOnError)
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
 
+	networkTimeout := configCmd.Int("timeout", -1, config.GTM("Timeout of each network operation in seconds"))
+	networkRetries := configCmd.Int("retries", -1, config.GTM("Number of retries of the network operations that fail temporarily"))
+	networkBackoff := configCmd.Int("backoff", -1, config.GTM("Seconds to wait before the first retry, doubled on each one"))
+	deleteForce := deleteCmd.Bool("force", false, config.GTM("Deletes the server even if some of its snapshots couldn't be pushed, losing them"))
 	listType := listCmd.String("type", "local", config.GTM("Type of servers to list"))
-
-	if config.FirstTimeSetup {
-		fmt.Println(config.GTM("First time setup"))
-	}
-	setup()
+	resolveServer := resolveCmd.String("server", "", config.GTM("Name of the synced server"))
+	settingsServer := settingsCmd.String("server", "", config.GTM("Name of the synced server"))
+	statusServer := statusCmd.String("server", "", config.GTM("Name of the synced server"))
+	historyServer := historyCmd.String("server", "", config.GTM("Name of the synced server"))
+	historyLimit := historyCmd.Int("n", 20, config.GTM("Number of snapshots to show (0 shows all)"))
+	backupsServer := backupsCmd.String("server", "", config.GTM("Name of the synced server"))
+	backupsMaxCount := backupsCmd.Int("count", -1, config.GTM("Maximum number of backups kept per server (0 is unlimited)"))
+	backupsMaxAge := backupsCmd.Int("days", -1, config.GTM("Maximum age of the backups in days (0 is unlimited)"))
+	backupsMaxSize := backupsCmd.Int("size-mb", -1, config.GTM("Maximum size of the backups of a server in MB (0 is unlimited)"))
+	exportServer := exportCmd.String("server", "", config.GTM("Name of the synced server"))
+	exportOutput := exportCmd.String("o", "", config.GTM("Path of the archive to create"))
+	importURL := importCmd.String("url", "", config.GTM("Git repository to publish the imported server to (optional)"))
+	importArgs := []string{}
+	renameServer := renameCmd.String("server", "", config.GTM("Name of the synced server"))
+	renameTo := renameCmd.String("to", "", config.GTM("New name of the server"))
+	remoteServer := remoteCmd.String("server", "", config.GTM("Name of the synced server"))
+	remoteArgs := []string{}
+	branchServer := branchCmd.String("server", "", config.GTM("Name of the synced server"))
+	branchArgs := []string{}
+	tagServer := tagCmd.String("server", "", config.GTM("Name of the synced server"))
+	tagArgs := []string{}
+	restoreServer := restoreCmd.String("server", "", config.GTM("Name of the synced server"))
+	restoreArgs := []string{}
+	serveAddr := serveCmd.String("addr", api.DefaultAddr, config.GTM("Address the API listens on, keep it on 127.0.0.1 to only allow this computer"))
+	serveToken := serveCmd.String("token", "", config.GTM("Token of the API, the saved one is used if empty"))
+	uiAddr := uiCmd.String("addr", api.DefaultAddr, config.GTM("Address the API listens on, keep it on 127.0.0.1 to only allow this computer"))
+	agentInterval := agentCmd.Duration("interval", config.DefaultAgentIntervalMinutes*time.Minute, config.GTM("Time between the syncs of the agent"))
+	agentArgs := []string{}
+	webhookFormat := webhookCmd.String("format", syncedpz.WebhookJSON, config.GTM("Payload of the webhook: json, discord or slack"))
+	webhookEvents := webhookCmd.String("events", "", config.GTM("Comma separated events notified to the webhook, empty notifies the sessions, pushes, conflicts and failures"))
+	webhookArgs := []string{}
+	logServer := logCmd.String("server", "", config.GTM("Name of the synced server"))
+	logSince := logCmd.String("since", "7d", config.GTM("Shows the syncs of this period, like 12h or 7d"))
+	logJSON := logCmd.Bool("json", false, config.GTM("Prints each sync as a JSON line"))
+	logBundle := logCmd.String("bundle", "", config.GTM("Zip archive to create with the log files and the syncs, to attach to bug reports"))
+	syncCmd.BoolVar(&config.SkipVerify, "force", false, config.GTM("Pushes the save even if it fails the verification"))
+	playCmd.BoolVar(&config.SkipVerify, "force", false, config.GTM("Pushes the save even if it fails the verification"))
+	syncCmd.StringVar(&config.ConflictResolution, "conflict", "", config.GTM("Resolves the divergences without asking: mine, theirs or fork"))
+	playCmd.StringVar(&config.ConflictResolution, "conflict", "", config.GTM("Resolves the divergences without asking: mine, theirs or fork"))
+	serveCmd.StringVar(&config.ConflictResolution, "conflict", "", config.GTM("Resolves the divergences without asking: mine, theirs or fork"))
+	uiCmd.StringVar(&config.ConflictResolution, "conflict", "", config.GTM("Resolves the divergences without asking: mine, theirs or fork"))
+	agentCmd.StringVar(&config.ConflictResolution, "conflict", "", config.GTM("Resolves the divergences without asking: mine, theirs or fork"))
 
 	if len(os.Args) < 2 {
-		menu()
+		menu(ctx)
 		return
 	}
 
@@ -76,19 +256,57 @@ func Run(ch chan os.Signal) {
 		tryParseCommand(playCmd)
 	case "language":
 		tryParseCommand(languageCmd)
+	case "resolve":
+		tryParseCommand(resolveCmd)
+	case "settings":
+		tryParseCommand(settingsCmd)
+	case "status":
+		tryParseCommand(statusCmd)
+	case "history":
+		tryParseCommand(historyCmd)
+	case "backups":
+		tryParseCommand(backupsCmd)
+	case "export":
+		tryParseCommand(exportCmd)
+	case "import":
+		importArgs = tryParseCommandInterspersed(importCmd)
+	case "rename":
+		tryParseCommand(renameCmd)
+	case "remote":
+		remoteArgs = tryParseCommandInterspersed(remoteCmd)
+	case "branch":
+		branchArgs = tryParseCommandInterspersed(branchCmd)
+	case "tag":
+		tagArgs = tryParseCommandInterspersed(tagCmd)
+	case "restore":
+		restoreArgs = tryParseCommandInterspersed(restoreCmd)
+	case "serve":
+		tryParseCommand(serveCmd)
+	case "ui":
+		tryParseCommand(uiCmd)
+	case "agent":
+		agentArgs = tryParseCommandInterspersed(agentCmd)
+	case "webhook":
+		webhookArgs = tryParseCommandInterspersed(webhookCmd)
+	case "log":
+		tryParseCommand(logCmd)
+	case "doctor":
+		tryParseCommand(doctorCmd)
 	default:
 		printUsage()
 		runtime.Goexit()
 	}
 
 	if menuCmd.Parsed() {
-		menu()
+		menu(ctx)
 	} else if configCmd.Parsed() {
 		if configCmd.Arg(0) == "setup" {
 			config.FirstTimeSetup = true
 			setup()
 		} else if configCmd.Arg(0) == "list" {
 			listConfig()
+		} else if configCmd.Arg(0) == "network" {
+			networkPolicy(*networkTimeout, *networkRetries, *networkBackoff)
 		} else {
 			log.Fatal(config.GTM("No argument for config"))
 		}
@@ -103,16 +321,62 @@ func Run(ch chan os.Signal) {
 			runtime.Goexit()
 		}
 	} else if addCmd.Parsed() {
-		addServer()
+		addServer(ctx)
 	} else if deleteCmd.Parsed() {
-		deleteServer()
+		deleteServer(ctx, *deleteForce)
 	} else if cloneCmd.Parsed() {
-		cloneServer()
+		cloneServer(ctx)
 	} else if syncCmd.Parsed() {
-		syncServers()
+		syncServers(ctx, !syncedpz.IsGameRunning())
 	} else if playCmd.Parsed() {
-		play()
+		play(ctx)
 	} else if languageCmd.Parsed() {
 		setLanguage()
+	} else if resolveCmd.Parsed() {
+		resolveConflicts(*resolveServer)
+	} else if settingsCmd.Parsed() {
+		serverSettings(ctx, *settingsServer, settingsCmd.Args())
+	} else if statusCmd.Parsed() {
+		printStatus(*statusServer)
+	} else if historyCmd.Parsed() {
+		printHistory(*historyServer, *historyLimit)
+	} else if backupsCmd.Parsed() {
+		if backupsCmd.Arg(0) == "policy" {
+			backupPolicy(*backupsMaxCount, *backupsMaxAge, *backupsMaxSize)
+		} else {
+			manageBackups(*backupsServer, backupsCmd.Args())
+		}
+	} else if exportCmd.Parsed() {
+		exportWorld(ctx, *exportServer, *exportOutput)
+	} else if importCmd.Parsed() {
+		importWorld(ctx, importArgs, *importURL)
+	} else if renameCmd.Parsed() {
+		renameSyncedServer(ctx, *renameServer, *renameTo)
+	} else if remoteCmd.Parsed() {
+		manageRemote(ctx, *remoteServer, remoteArgs)
+	} else if branchCmd.Parsed() {
+		manageBranches(ctx, *branchServer, branchArgs)
+	} else if tagCmd.Parsed() {
+		tagSnapshot(ctx, *tagServer, tagArgs)
+	} else if restoreCmd.Parsed() {
+		restoreSnapshot(ctx, *restoreServer, restoreArgs)
+	} else if serveCmd.Parsed() {
+		serve(ctx, *serveAddr, *serveToken)
+	} else if uiCmd.Parsed() {
+		openDashboard(ctx, *uiAddr)
+	} else if agentCmd.Parsed() {
+		if len(agentArgs) == 0 {
+			runAgent(ctx, *agentInterval)
+		} else if len(agentArgs) == 1 && agentArgs[0] == "status" {
+			agentStatus(ctx)
+		} else {
+			printUsage()
+		}
+	} else if webhookCmd.Parsed() {
+		manageWebhooks(ctx, *webhookFormat, *webhookEvents, webhookArgs)
+	} else if logCmd.Parsed() {
+		printSyncRuns(*logServer, *logSince, *logJSON, *logBundle)
+	} else if doctorCmd.Parsed() {
+		doctor(ctx)
 	}
 }
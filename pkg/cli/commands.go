@@ -1,14 +1,21 @@
 package cli
 
 import (
-	"bufio"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syncedpz/config"
+	"syncedpz/pkg/agent"
+	"syncedpz/pkg/api"
 	"syncedpz/pkg/syncedpz"
+	"syncedpz/pkg/tui"
 	"syncedpz/pkg/utils"
 	"time"
 
@@ -20,76 +27,45 @@ func printUsage() {
 	fmt.Println(config.GTM("  syncedpz help = shows this message"))
 	fmt.Println(config.GTM("  syncedpz menu = use menu mode"))
 	fmt.Println(config.GTM("  syncedpz config [setup | list] = sets up or list the syncedpz configuration"))
+	fmt.Println(config.GTM("  syncedpz config [-timeout 600] [-retries 3] [-backoff 2] network = shows or sets the timeout and retries of the network operations"))
 	fmt.Println(config.GTM("  syncedpz list -type [local | synced] = list servers according to its type (default is local))"))
 	fmt.Println(config.GTM("  syncedpz add = adds a new synced PZ server from your local files"))
-	fmt.Println(config.GTM("  syncedpz delete = deletes a synced PZ server from the database only"))
+	fmt.Println(config.GTM("  syncedpz delete [-force] = deletes a synced PZ server from the database only"))
 	fmt.Println(config.GTM("  syncedpz clone = adds a new synced PZ server from a git repository"))
 	fmt.Println(config.GTM("  syncedpz sync = syncs all servers"))
 	fmt.Println(config.GTM("  syncedpz play = syncs all servers at the start, every 5 minutes and at the end. And starts Project Zomboid"))
+	fmt.Println(config.GTM("  syncedpz [sync | play] -force = pushes the saves even if they fail the verification"))
+	fmt.Println(config.GTM("  syncedpz [sync | play] -conflict [mine | theirs | fork] = resolves without asking when the save changed locally and in the server"))
 	fmt.Println(config.GTM("  syncedpz language = sets the language of the application"))
+	fmt.Println(config.GTM("  syncedpz resolve [-server NAME] = resolves the config conflicts found when syncing"))
+	fmt.Println(config.GTM("  syncedpz settings -server NAME [list | get KEY | set KEY VALUE] = shows or changes the server settings"))
+	fmt.Println(config.GTM("  syncedpz status [-server NAME] = shows the status of the synced servers"))
+	fmt.Println(config.GTM("  syncedpz history -server NAME [-n 20] = shows the last snapshots of a synced server"))
+	fmt.Println(config.GTM("  syncedpz backups [-server NAME] [list | restore ID | prune] = manages the local backups taken before the saves are overwritten"))
+	fmt.Println(config.GTM("  syncedpz backups [-count N] [-days N] [-size-mb N] policy = shows or sets how many backups are kept"))
+	fmt.Println(config.GTM("  syncedpz export -server NAME -o world.tar.zst = exports a synced server to an archive that can be shared"))
+	fmt.Println(config.GTM("  syncedpz import world.tar.zst [-url URL] = installs an exported server and optionally publishes it to a git repository"))
+	fmt.Println(config.GTM("  syncedpz rename -server OLD -to NEW = renames a synced server for every player"))
+	fmt.Println(config.GTM("  syncedpz remote set-url -server NAME URL = changes the git repository of a synced server"))
+	fmt.Println(config.GTM("  syncedpz remote migrate -server NAME URL = pushes the whole history of a synced server to a new git repository and uses it"))
+	fmt.Println(config.GTM("  syncedpz remote [list | add URL | remove URL] -server NAME = manages the mirrors of a synced server, every repository is pushed and the freshest one is pulled"))
+	fmt.Println(config.GTM("  syncedpz branch [list | create NAME | switch NAME | merge NAME] -server NAME = manages alternate timelines of a synced server, merging replaces the current world with the one of the branch"))
+	fmt.Println(config.GTM("  syncedpz tag -server NAME [TAG] = tags the current snapshot of a synced server as a milestone, or lists the tags"))
+	fmt.Println(config.GTM("  syncedpz restore -server NAME [TAG | SNAPSHOT] = makes an older snapshot of a synced server the current one for every player"))
+	fmt.Println(config.GTM("  syncedpz serve [-addr 127.0.0.1:8765] [-token TOKEN] = serves a JSON API to control SyncedPZ from other programs, every request must send the token"))
+	fmt.Println(config.GTM("  syncedpz ui [-addr 127.0.0.1:8765] = opens a dashboard in the browser to see, sync, play and restore the synced servers"))
+	fmt.Println(config.GTM("  syncedpz agent [-interval 10m] [-conflict mine | theirs | fork] = keeps syncing the servers in the background while the game is closed, including the changes of servers hosted without syncedpz play"))
+	fmt.Println(config.GTM("  syncedpz agent status = shows what the running agent did"))
+	fmt.Println(config.GTM("  syncedpz webhook [list | add URL | remove URL | test URL] [-format json | discord | slack] [-events EVENT,...] = notifies URLs when players start or finish playing, push snapshots, or syncs conflict or fail"))
+	fmt.Println(config.GTM("  syncedpz log [-server NAME] [-since 7d] [-json] = shows the syncs of the servers, what they pulled or pushed and their errors"))
+	fmt.Println(config.GTM("  syncedpz log [-since 7d] -bundle logs.zip = creates an archive with the log files and the syncs to attach to bug reports"))
+	fmt.Println(config.GTM("  syncedpz doctor = checks the setup, the repositories and the mods and explains how to fix the problems"))
+	fmt.Println(config.GTM("  syncedpz [-log-level debug | info | warn | error] [-log-format text | json] COMMAND = changes the logs, also written to data/logs"))
 }
 
-func menu() {
-	var err error
-
-	functions := []func(){
-		printUsage,
-		setup,
-		listConfig,
-		listLocalServers,
-		listSyncedServers,
-		addServer,
-		deleteServer,
-		cloneServer,
-		syncServers,
-		play,
-		setLanguage,
-	}
-
-	choice := -1
-	// Runs the menu until the user chooses to exit
-	for true {
-		// use > len(functions) and not >= len(functions) to include the exit option
-		for choice < 0 || choice > len(functions) {
-			fmt.Println(config.GTM("Menu:"))
-			fmt.Println(config.GTM("  [0] Help"))
-			fmt.Println(config.GTM("  [1] Setup config"))
-			fmt.Println(config.GTM("  [2] List config"))
-			fmt.Println(config.GTM("  [3] List local servers"))
-			fmt.Println(config.GTM("  [4] List synced servers"))
-			fmt.Println(config.GTM("  [5] Add synced server"))
-			fmt.Println(config.GTM("  [6] Delete synced server"))
-			fmt.Println(config.GTM("  [7] Clone synced server"))
-			fmt.Println(config.GTM("  [8] Sync servers"))
-			fmt.Println(config.GTM("  [9] Play"))
-			fmt.Println(config.GTM("  [10] Set language"))
-			fmt.Println(config.GTM("  [11] Exit"))
-
-			choiceStr := askForInput(config.GTM("Enter the number of the option you want to choose: "))
-			choice, err = strconv.Atoi(choiceStr)
-			if err != nil || choice < 0 || choice > len(functions) {
-				fmt.Println(config.GTM("Invalid choice"))
-				time.Sleep(1 * time.Second)
-			}
-		}
-
-		if choice == len(functions) {
-			break
-		}
-		if choice == 1 {
-			config.FirstTimeSetup = true
-		}
-
-		fn := functions[choice]
-		fn()
-
-		choice = -1 // Reset choice to run the menu again
-
-		// Read a single byte (key press)
-		fmt.Print(config.GTM("Press any key to continue..."))
-		reader := bufio.NewReader(os.Stdin)
-		_, _ = reader.ReadByte()
-	}
+// menu shows the full-screen interface
+func menu(ctx context.Context) {
+	utils.HandleErr(tui.Run(ctx))
 }
 
 func setup() {
@@ -110,18 +86,18 @@ func setup() {
 		if data_path == "" {
 			data_path = config.PZ_DataPath
 		}
-		syncedpz.SetupPzDirs(batPath, data_path)
+		utils.HandleErr(syncedpz.SetupPzDirs(batPath, data_path))
 
 		steamID := askForInput(config.GTM("Enter your steam id: "))
 		if steamID == "" {
 			steamID = config.PZ_SteamID
 		}
-		syncedpz.SetupSteamId(steamID)
+		utils.HandleErr(syncedpz.SetupSteamId(steamID))
 
 		gitUsername := askForInput(config.GTM("Enter your git username: "))
 		gitPassword := askForInput(config.GTM("Enter your git password (or your github token)): "))
 		if gitUsername != "" || gitPassword != "" {
-			syncedpz.SetupGitAuth(gitUsername, gitPassword)
+			utils.HandleErr(syncedpz.SetupGitAuth(gitUsername, gitPassword))
 		}
 	} else {
 		handleErr(syncedpz.LoadSteamID())
@@ -134,6 +110,28 @@ func listConfig() {
 	fmt.Println(config.GTM("PZ Bat Path: "), config.PZ_BatPath)
 	fmt.Println(config.GTM("PZ Data Path: "), config.PZ_DataPath)
 	fmt.Println(config.GTM("Steam ID: "), config.PZ_SteamID)
+	fmt.Println(config.GTM("Network timeout: "), config.NetworkTimeout)
+	fmt.Println(config.GTM("Network retries: "), config.NetworkRetries)
+	fmt.Println(config.GTM("Network backoff: "), config.NetworkBackoff)
+}
+
+func networkPolicy(timeoutSeconds, retries, backoffSeconds int) {
+	if timeoutSeconds >= 0 || retries >= 0 || backoffSeconds >= 0 {
+		if timeoutSeconds < 0 {
+			timeoutSeconds = int(config.NetworkTimeout / time.Second)
+		}
+		if retries < 0 {
+			retries = config.NetworkRetries
+		}
+		if backoffSeconds < 0 {
+			backoffSeconds = int(config.NetworkBackoff / time.Second)
+		}
+		utils.HandleErr(syncedpz.SetupNetworkPolicy(timeoutSeconds, retries, backoffSeconds))
+	}
+
+	fmt.Println(config.GTM("Network timeout: "), config.NetworkTimeout)
+	fmt.Println(config.GTM("Network retries: "), config.NetworkRetries)
+	fmt.Println(config.GTM("Network backoff: "), config.NetworkBackoff)
 }
 
 func listLocalServers() {
@@ -150,7 +148,7 @@ func listSyncedServers() {
 	}
 }
 
-func addServer() {
+func addServer(ctx context.Context) {
 	var err error
 
 	localServers := syncedpz.GetLocalServers()
@@ -173,8 +171,13 @@ func addServer() {
 	gitURL := askForInput(config.GTM("Enter the git repository link to the server: "))
 	ss := syncedpz.NewSyncedServer(server.Name, gitURL)
 
-	ss.InitGit()
-	changes := ss.Pull()
+	utils.HandleErr(ss.InitGit())
+	changes, err := ss.TryPull(ctx)
+	if errors.Is(err, syncedpz.ErrOffline) {
+		log.Warnf("No repository is reachable, %s will be pushed on the next sync", ss.Name)
+	} else {
+		utils.HandleErr(err)
+	}
 	if changes {
 		fmt.Println(config.GTM("Warning! Apparently a server using this git repository already exists"))
 		fmt.Println(config.GTM("and it already has some content."))
@@ -189,16 +192,13 @@ func addServer() {
 		}
 	}
 
-	ss.CopyLocalServerToSynced()
-	ss.UpdatePlayersFile()
 	fmt.Println(config.GTM("WARNING: Commiting and pushing can take a while, please wait..."))
-	ss.CommitAndPush()
-	ss.Save()
+	utils.HandleErr(ss.Publish(ctx))
 
 	fmt.Println(config.GTM("Server added successfully"))
 }
 
-func deleteServer() {
+func deleteServer(ctx context.Context, force bool) {
 	servers := syncedpz.GetSyncedServers()
 	if (len(servers)) == 0 {
 		fmt.Println(config.GTM("No servers to delete"))
@@ -212,102 +212,748 @@ func deleteServer() {
 	choiceInt, err := strconv.Atoi(choice)
 	if err != nil || choiceInt < 0 || choiceInt >= len(servers) {
 		fmt.Println(config.GTM("Invalid choice"))
-		deleteServer()
+		deleteServer(ctx, force)
 		return
 	}
 
 	server := servers[choiceInt]
-	server.Delete()
+	err = server.Delete(ctx, force)
+	if errors.Is(err, syncedpz.ErrUnpushedSnapshots) {
+		log.Error(err)
+		log.Fatal(config.GTM("Nothing was deleted. Sync the server once the repositories are reachable, or use -force to delete it anyway and lose the snapshots"))
+	}
+	utils.HandleErr(err)
+	fmt.Printf(config.GTM("%s deleted")+"\n", server.Name)
 }
 
-func cloneServer() {
+func cloneServer(ctx context.Context) {
 	gitURL := askForInput(config.GTM("Enter the git repository link to the server: "))
-	ss := syncedpz.SyncedServer{GitURL: gitURL}
-
-	ss.Clone()
-	ss.CopySyncedServerToLocal()
-	ss.UpdatePlayersFile()
-	ss.CommitAndPush()
-	ss.Save()
+	_, err := syncedpz.CloneServer(ctx, gitURL)
+	utils.HandleErr(err)
 
 	fmt.Println(config.GTM("Server cloned successfully"))
 }
 
-func syncServers() {
+// syncServers syncs every synced server, returns false if any of them is offline.
+// When the context is done the current sync stops at a safe point and the remaining servers are skipped.
+// Divergences are resolved with config.ConflictResolution or, if it's empty, asking the player. When ask
+// is false, while the game is running, they're left until it closes
+func syncServers(ctx context.Context, ask bool) bool {
+	online := true
 	servers := syncedpz.GetSyncedServers()
 	for _, ss := range servers {
-		// If there are changes in the server, prioritize pulling
-		if ss.Pull() {
-			ss.CopySyncedServerToLocal()
-		} else { // If there are no changes, prioritize pushing
-			ss.CopyLocalServerToSynced()
-			// Try to fetch again to check if there are new changes
-			// If there are, pull them and discard the local changes
-			if ss.Fetch() {
-				log.Error("There are new changes in the server, prioritizing them")
-				ss.Restore()
-				ss.Pull()
-			} else {
-				ss.CommitAndPush()
+		err := ss.Sync(ctx)
+		var divergence *syncedpz.DivergenceError
+		if errors.As(err, &divergence) {
+			err = resolveDivergence(ctx, ss, divergence, ask)
+		}
+		if errors.Is(err, syncedpz.ErrOffline) {
+			online = false
+		} else if ctx.Err() != nil {
+			log.Warnf("Sync of %s interrupted, the remaining servers were skipped", ss.Name)
+			return online
+		} else if err != nil {
+			log.Errorf("Could not sync %s: %s", ss.Name, err)
+		}
+	}
+	return online
+}
+
+// resolveDivergence resolves the divergence found when syncing the server
+func resolveDivergence(ctx context.Context, ss *syncedpz.SyncedServer, divergence *syncedpz.DivergenceError, ask bool) error {
+	if !ask {
+		// Resolving it would replace the save the game is writing
+		log.Warnf("%s, it will be resolved once the game closes", divergence)
+		return nil
+	}
+	if config.ConflictResolution != "" {
+		resolution, err := syncedpz.ParseResolution(config.ConflictResolution)
+		if err != nil {
+			return err
+		}
+		return ss.ResolveDivergence(ctx, resolution)
+	}
+
+	printCommit := func(label string, ci syncedpz.CommitInfo) {
+		fmt.Println(label, ci.Time.Format("2006-01-02 15:04"), "-", ci.Author, "-", ci.Subject())
+	}
+	fmt.Printf(config.GTM("%s changed locally and in the server since the last sync:\n"), ss.Name)
+	if divergence.Base != nil {
+		printCommit(config.GTM("  Last sync:"), *divergence.Base)
+	}
+	printCommit(config.GTM("  Mine:     "), divergence.Mine)
+	printCommit(config.GTM("  Theirs:   "), divergence.Theirs)
+	fmt.Println(config.GTM("  [1] Keep mine, replacing theirs"))
+	fmt.Println(config.GTM("  [2] Keep theirs, mine is kept in the local backups"))
+	fmt.Println(config.GTM("  [3] Fork mine into a new branch and keep theirs"))
+	fmt.Println(config.GTM("  [4] Decide on the next sync"))
+
+	resolutions := map[string]syncedpz.Resolution{"1": syncedpz.KeepMine, "2": syncedpz.KeepTheirs, "3": syncedpz.Fork}
+	for {
+		choice := strings.TrimSpace(askForInput(config.GTM("Enter the number of the option you want to choose: ")))
+		if choice == "4" {
+			return nil
+		}
+		if resolution, ok := resolutions[choice]; ok {
+			return ss.ResolveDivergence(ctx, resolution)
+		}
+		fmt.Println(config.GTM("Invalid choice"))
+	}
+}
+
+func play(ctx context.Context) {
+	if !syncServers(ctx, true) {
+		fmt.Println(config.GTM("WARNING: you are offline, your progress will be pushed when the connection is back"))
+		fmt.Println(config.GTM("Other players won't see it and may play an older version of the world meanwhile"))
+	}
+	if ctx.Err() != nil || !checkMods() {
+		return
+	}
+
+	// The database is only open during the syncs while the game runs, so the other commands can use it
+	config.CloseDB()
+	err := syncedpz.RunGame(ctx, syncedpz.SyncInterval, func() {
+		if err := config.OpenDB(ctx); err != nil {
+			log.Errorf("Could not sync the servers: %s", err)
+			return
+		}
+		defer config.CloseDB()
+		// Doesn't ask while the game is running
+		syncServers(ctx, false)
+	})
+	utils.HandleErr(err)
+
+	if ctx.Err() != nil {
+		log.Warn("Interrupted, the final sync was skipped. Run syncedpz sync to push your progress")
+		return
+	}
+	utils.HandleErr(config.OpenDB(ctx))
+	syncServers(ctx, true)
+}
+
+// getServers returns the synced server with the given name, or all of them if the name is empty
+func getServers(serverName string) []*syncedpz.SyncedServer {
+	if serverName == "" {
+		return syncedpz.GetSyncedServers()
+	}
+
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+	return []*syncedpz.SyncedServer{ss}
+}
+
+func resolveConflicts(serverName string) {
+	servers := getServers(serverName)
+
+	showValue := func(value string, present bool) string {
+		if !present {
+			return config.GTM("(not set)")
+		}
+		return value
+	}
+
+	keptMine := false
+	resolved := 0
+	for _, ss := range servers {
+		for _, c := range ss.GetConflicts() {
+			fmt.Printf(config.GTM("Conflict in %s (%s) at %s:\n"), c.File, ss.Name, c.Key)
+			fmt.Println(config.GTM("  Last synced: "), showValue(c.Base, c.InBase))
+			fmt.Println(config.GTM("  Mine:        "), showValue(c.Ours, c.InOurs))
+			fmt.Println(config.GTM("  Theirs:      "), showValue(c.Theirs, c.InTheirs))
+
+			choice := ""
+			for choice != "1" && choice != "2" {
+				choice = askForInput(config.GTM("Enter 1 to keep mine or 2 to keep theirs: "))
+			}
+			utils.HandleErr(ss.ResolveConflict(c, choice == "1"))
+			keptMine = keptMine || choice == "1"
+			resolved++
+		}
+	}
+
+	if resolved == 0 {
+		fmt.Println(config.GTM("No conflicts to resolve"))
+	} else if keptMine {
+		fmt.Println(config.GTM("Your values will be sent to the other players on the next sync"))
+	}
+}
+
+func serverSettings(ctx context.Context, serverName string, args []string) {
+	if serverName == "" || len(args) == 0 {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+
+	printSetting := func(s syncedpz.ServerSetting) {
+		fmt.Printf("%s = %s", s.Key, s.Value)
+		if s.Known {
+			fmt.Printf(" (%s", s.Type)
+			if s.Range() != "" {
+				fmt.Printf(", %s", s.Range())
+			}
+			fmt.Printf(") %s", s.Description)
+		}
+		fmt.Println()
+	}
+
+	switch {
+	case args[0] == "list":
+		settings, err := ss.ListSettings()
+		utils.HandleErr(err)
+		for _, s := range settings {
+			printSetting(s)
+		}
+	case args[0] == "get" && len(args) == 2:
+		s, err := ss.GetSetting(args[1])
+		utils.HandleErr(err)
+		printSetting(s)
+	case args[0] == "set" && len(args) == 3:
+		utils.HandleErr(ss.SetSetting(ctx, args[1], args[2]))
+	default:
+		printUsage()
+	}
+}
+
+func printStatus(serverName string) {
+	for _, ss := range getServers(serverName) {
+		status, err := ss.GetStatus()
+		utils.HandleErr(err)
+		fmt.Println(status.Name)
+		fmt.Println(config.GTM("  Repositories:"))
+		for _, rh := range status.Remotes {
+			fmt.Print("  ")
+			printRemoteHealth(rh)
+		}
+		if status.Branch != "" {
+			fmt.Println(config.GTM("  Branch:"), status.Branch)
+		}
+		fmt.Println(config.GTM("  Players:"), strings.Join(status.Players, ", "))
+		if status.LastCommit != nil {
+			fmt.Println(config.GTM("  Last snapshot:"), status.LastCommit.Time.Format("2006-01-02 15:04"), "-", status.LastCommit.Subject())
+		}
+		if status.Metadata != nil {
+			for _, line := range status.Metadata.Lines() {
+				fmt.Println("  " + line)
 			}
 		}
-		ss.EnsureUpdatedPlayerSaveFolders()
-	}
-}
-
-func play() {
-	keepSyncing := func(ch chan struct{}) {
-		log.Info("Keep syncing mode")
-
-		last5MinutesInterval := time.Now().Add(-5 * time.Minute)
-		for {
-			now := time.Now()
-
-			select {
-			case <-ch:
-				return
-			default:
-				if now.Sub(last5MinutesInterval).Minutes() >= 5 {
-					for _, ss := range syncedpz.GetSyncedServers() {
-						if ss.Pull() {
-							ss.CopySyncedServerToLocal()
-						} else {
-							ss.CopyLocalServerToSynced()
-							// Try to fetch again to check if there are new changes
-							// If there are, pull them and discard the local changes
-							if ss.Fetch() {
-								log.Error("There are new changes in the server, prioritizing them")
-								ss.Restore()
-								ss.Pull()
-							} else {
-								ss.CommitAndPush()
-							}
-						}
-						ss.EnsureUpdatedPlayerSaveFolders()
-					}
-					// Last 5 minutes interval is now
-					last5MinutesInterval = time.Now()
-				}
+		if status.LastSync != nil {
+			fmt.Println(config.GTM("  Last sync:"), status.LastSync.Time.Format("2006-01-02 15:04"), "-", status.LastSync.Commit[:8])
+		}
+		if status.Queued > 0 {
+			fmt.Printf(config.GTM("  %d snapshots waiting to be pushed\n"), status.Queued)
+		}
+		if status.Conflicts > 0 {
+			fmt.Printf(config.GTM("  %d config conflicts, use syncedpz resolve to solve them\n"), status.Conflicts)
+		}
+	}
+}
+
+func printHistory(serverName string, limit int) {
+	if serverName == "" {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+
+	history, err := ss.GetHistory(limit)
+	utils.HandleErr(err)
+	for _, c := range history {
+		tags := ""
+		if len(c.Tags) > 0 {
+			tags = fmt.Sprintf(" (%s)", strings.Join(c.Tags, ", "))
+		}
+		fmt.Printf("%s  %s  %s%s\n", c.Hash[:8], c.Time.Format("2006-01-02 15:04"), c.Subject(), tags)
+		for _, line := range c.Body() {
+			fmt.Printf("%28s%s\n", "", line)
+		}
+	}
+}
+
+func manageBackups(serverName string, args []string) {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch {
+	case args[0] == "list":
+		for _, ss := range getServers(serverName) {
+			fmt.Println(ss.Name)
+			for _, backup := range ss.GetBackups() {
+				fmt.Printf("  %s  %s  %.1f MB\n", backup.ID, backup.Time.Format("2006-01-02 15:04:05"), float64(backup.Size)/1024/1024)
 			}
 		}
+	case args[0] == "restore" && len(args) == 2 && serverName != "":
+		ss, err := syncedpz.GetSyncedServer(serverName)
+		utils.HandleErr(err)
+		utils.HandleErr(ss.RestoreBackup(args[1]))
+		fmt.Println(config.GTM("Backup restored, it will be pushed on the next sync if there are no new changes in the server"))
+	case args[0] == "prune":
+		for _, ss := range getServers(serverName) {
+			removed := ss.PruneBackups()
+			fmt.Printf(config.GTM("%s: %d backups removed\n"), ss.Name, len(removed))
+		}
+	default:
+		printUsage()
+	}
+}
+
+func backupPolicy(maxCount, maxAgeDays, maxSizeMB int) {
+	if maxCount >= 0 || maxAgeDays >= 0 || maxSizeMB >= 0 {
+		if maxCount < 0 {
+			maxCount = config.BackupMaxCount
+		}
+		if maxAgeDays < 0 {
+			maxAgeDays = config.BackupMaxAgeDays
+		}
+		if maxSizeMB < 0 {
+			maxSizeMB = config.BackupMaxSizeMB
+		}
+		utils.HandleErr(syncedpz.SetupBackupPolicy(maxCount, maxAgeDays, maxSizeMB))
+	}
+
+	fmt.Println(config.GTM("Maximum number of backups per server:"), config.BackupMaxCount)
+	fmt.Println(config.GTM("Maximum age of the backups in days:"), config.BackupMaxAgeDays)
+	fmt.Println(config.GTM("Maximum size of the backups of a server in MB:"), config.BackupMaxSizeMB)
+}
+
+func exportWorld(ctx context.Context, serverName, output string) {
+	if serverName == "" {
+		printUsage()
+		return
 	}
+	if output == "" {
+		output = serverName + ".tar.zst"
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
 
-	syncServers()
+	_, err = ss.Export(ctx, output)
+	utils.HandleErr(err)
+	fmt.Printf(config.GTM("Server exported to %s\n"), output)
+}
 
-	ch := make(chan struct{})
-	go keepSyncing(ch)
+func importWorld(ctx context.Context, args []string, gitURL string) {
+	if len(args) != 1 {
+		printUsage()
+		return
+	}
 
-	log.Infof("Starting Project Zomboid with bat path:\n%s", config.PZ_BatPath)
-	cmd := exec.Command(config.PZ_BatPath)
-	utils.HandleErr(cmd.Start())
+	ss, manifest, err := syncedpz.Import(ctx, args[0], gitURL)
+	utils.HandleErr(err)
 
-	log.Info("Project Zomboid started with PID: ", cmd.Process.Pid)
+	fmt.Printf(config.GTM("Server %s imported, exported by %s at %s\n"), manifest.Name, manifest.ExportedBy, manifest.ExportedAt.Format("2006-01-02 15:04"))
+	if manifest.Metadata != nil {
+		for _, line := range manifest.Metadata.Lines() {
+			fmt.Println("  " + line)
+		}
+	}
+	if len(manifest.Mods.WorkshopItems) > 0 {
+		fmt.Println(config.GTM("  Workshop items:"), strings.Join(manifest.Mods.WorkshopItems, ", "))
+	}
+	if ss == nil {
+		fmt.Println(config.GTM("The server was installed as a local server only, use syncedpz add to sync it"))
+	}
+}
 
-	// When Project Zomboid closes, send signal to stop the syncing
-	cmd.Wait()
-	close(ch)
+func renameSyncedServer(ctx context.Context, serverName, newName string) {
+	if serverName == "" || newName == "" {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
 
-	syncServers()
+	utils.HandleErr(ss.Rename(ctx, newName))
+	fmt.Printf(config.GTM("Server renamed to %s, the other players will follow it on their next sync\n"), ss.Name)
+}
+
+func manageRemote(ctx context.Context, serverName string, args []string) {
+	if serverName == "" || len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+
+	switch args[0] {
+	case "list":
+		status, err := ss.GetStatus()
+		utils.HandleErr(err)
+		for _, rh := range status.Remotes {
+			printRemoteHealth(rh)
+		}
+	case "add":
+		utils.HandleErr(ss.AddMirror(ctx, args[1]))
+		fmt.Printf(config.GTM("Mirror %s added to %s\n"), args[1], ss.Name)
+	case "remove":
+		utils.HandleErr(ss.RemoveMirror(ctx, args[1]))
+		fmt.Printf(config.GTM("Mirror %s removed from %s\n"), args[1], ss.Name)
+	case "set-url":
+		utils.HandleErr(ss.SetURL(ctx, args[1]))
+		fmt.Printf(config.GTM("Repository of %s changed to %s\n"), ss.Name, ss.GitURL)
+	case "migrate":
+		utils.HandleErr(ss.Migrate(ctx, args[1]))
+		fmt.Printf(config.GTM("%s migrated to %s, the other players must run: syncedpz remote set-url -server \"%s\" %s\n"), ss.Name, ss.GitURL, ss.Name, ss.GitURL)
+	default:
+		printUsage()
+	}
+}
+
+func manageWebhooks(ctx context.Context, format, events string, args []string) {
+	if len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		printUsage()
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		webhooks, err := syncedpz.GetWebhooks()
+		utils.HandleErr(err)
+		for _, webhook := range webhooks {
+			fmt.Printf("%s (%s): %s\n", webhook.URL, webhook.Format, strings.Join(webhook.Events, ", "))
+		}
+		fmt.Println(config.GTM("Events:"), strings.Join(syncedpz.WebhookEvents, ", "))
+	case "add":
+		webhook := syncedpz.Webhook{URL: args[1], Format: format}
+		if events != "" {
+			for _, event := range strings.Split(events, ",") {
+				webhook.Events = append(webhook.Events, strings.TrimSpace(event))
+			}
+		}
+		utils.HandleErr(syncedpz.AddWebhook(webhook))
+		fmt.Printf(config.GTM("Webhook %s added, check it with syncedpz webhook test %s\n"), webhook.URL, webhook.URL)
+	case "remove":
+		utils.HandleErr(syncedpz.RemoveWebhook(args[1]))
+		fmt.Printf(config.GTM("Webhook %s removed\n"), args[1])
+	case "test":
+		// The saved webhook is tested with its format, any other URL with the one of the flag
+		webhook := syncedpz.Webhook{URL: args[1], Format: format}
+		webhooks, err := syncedpz.GetWebhooks()
+		utils.HandleErr(err)
+		for _, saved := range webhooks {
+			if saved.URL == args[1] {
+				webhook = saved
+			}
+		}
+		utils.HandleErr(syncedpz.TestWebhook(ctx, webhook))
+		fmt.Printf(config.GTM("Test notification sent to %s\n"), webhook.URL)
+	default:
+		printUsage()
+	}
+}
+
+// parseSince parses a period like 7d or 12h, returning when it started
+func parseSince(since string) (time.Time, error) {
+	if days, ok := strings.CutSuffix(since, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf(config.GTM("Invalid period %s, use something like 7d or 12h"), since)
+		}
+		return time.Now().AddDate(0, 0, -n), nil
+	}
+
+	d, err := time.ParseDuration(since)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf(config.GTM("Invalid period %s, use something like 7d or 12h"), since)
+	}
+	return time.Now().Add(-d), nil
+}
+
+func printSyncRuns(serverName, since string, jsonLines bool, bundle string) {
+	start, err := parseSince(since)
+	utils.HandleErr(err)
+	if serverName != "" {
+		_, err := syncedpz.GetSyncedServer(serverName)
+		utils.HandleErr(err)
+	}
+	runs, err := syncedpz.GetSyncRuns(serverName, start)
+	utils.HandleErr(err)
+
+	if bundle != "" {
+		utils.HandleErr(writeLogBundle(bundle, runs))
+		fmt.Printf(config.GTM("Logs saved to %s, attach it to the bug report\n"), bundle)
+		return
+	}
+	if jsonLines {
+		enc := json.NewEncoder(os.Stdout)
+		for _, run := range runs {
+			utils.HandleErr(enc.Encode(run))
+		}
+		return
+	}
+
+	for _, run := range runs {
+		commit := ""
+		if len(run.Commit) >= 8 {
+			commit = run.Commit[:8]
+		}
+		fmt.Printf("%s  %s  %s  %-4s  %s  %s\n", run.Start.Format("2006-01-02 15:04:05"), run.ID, run.Server, run.Direction, commit, run.Duration().Round(time.Second))
+		if run.FilesChanged > 0 {
+			fmt.Printf(config.GTM("  %d files changed, %.1f MB\n"), run.FilesChanged, float64(run.Bytes)/1024/1024)
+		}
+		if run.Error != "" {
+			fmt.Printf(config.GTM("  Error: %s\n"), run.Error)
+		}
+	}
+	if len(runs) == 0 {
+		fmt.Println(config.GTM("No syncs in this period"))
+	}
+}
+
+// writeLogBundle writes a zip archive with the log files and the syncs as JSON lines
+func writeLogBundle(path string, runs []syncedpz.SyncRun) (err error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	archive := zip.NewWriter(out)
+	logFiles, err := filepath.Glob(filepath.Join(config.LogsPath, "*.log"))
+	if err != nil {
+		return err
+	}
+	for _, logFile := range logFiles {
+		data, err := os.ReadFile(logFile)
+		if err != nil {
+			return err
+		}
+		w, err := archive.Create("logs/" + filepath.Base(logFile))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	w, err := archive.Create("sync_runs.jsonl")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, run := range runs {
+		if err := enc.Encode(run); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// doctor prints the result of every check and how to fix the problems found
+func doctor(ctx context.Context) {
+	fmt.Println(config.GTM("Checking SyncedPZ, the repositories may take a while to answer..."))
+	problems, warnings := 0, 0
+	for _, d := range syncedpz.Diagnose(ctx) {
+		switch {
+		case d.OK():
+			fmt.Printf("[OK]   %s\n", d.Check)
+			continue
+		case d.Warning:
+			warnings++
+			fmt.Printf("[WARN] %s: %s\n", d.Check, d.Problem)
+		default:
+			problems++
+			fmt.Printf("[FAIL] %s: %s\n", d.Check, d.Problem)
+		}
+		fmt.Printf(config.GTM("       Fix: %s\n"), strings.ReplaceAll(d.Fix, "\n", "\n       "))
+	}
+
+	if problems == 0 && warnings == 0 {
+		fmt.Println(config.GTM("Everything looks fine"))
+	} else {
+		fmt.Printf(config.GTM("%d problems and %d warnings found\n"), problems, warnings)
+	}
+}
+
+func manageBranches(ctx context.Context, serverName string, args []string) {
+	if serverName == "" || len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+
+	switch args[0] {
+	case "list":
+		if _, err := ss.TryFetch(ctx); errors.Is(err, syncedpz.ErrOffline) {
+			log.Warn("No repository is reachable, the branches may be out of date")
+		} else {
+			utils.HandleErr(err)
+		}
+		branches, err := ss.ListBranches()
+		utils.HandleErr(err)
+		for _, b := range branches {
+			current := " "
+			if b.Current {
+				current = "*"
+			}
+			fmt.Printf("%s %s  %s - %s\n", current, b.Name, b.Last.Time.Format("2006-01-02 15:04"), b.Last.Subject())
+		}
+	case "create":
+		utils.HandleErr(ss.CreateBranch(ctx, args[1]))
+		fmt.Printf(config.GTM("Branch %s created, use syncedpz branch switch to play on it\n"), args[1])
+	case "switch":
+		utils.HandleErr(ss.SwitchBranch(ctx, args[1]))
+		fmt.Printf(config.GTM("%s is now on the branch %s\n"), ss.Name, args[1])
+	case "merge":
+		utils.HandleErr(ss.MergeBranch(ctx, args[1]))
+		fmt.Printf(config.GTM("Branch %s merged\n"), args[1])
+	default:
+		printUsage()
+	}
+}
+
+func tagSnapshot(ctx context.Context, serverName string, args []string) {
+	if serverName == "" || len(args) > 1 {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+
+	if len(args) == 1 {
+		utils.HandleErr(ss.Tag(ctx, args[0]))
+		fmt.Printf(config.GTM("Snapshot tagged as %s, restore it with syncedpz restore -server \"%s\" %s\n"), args[0], ss.Name, args[0])
+		return
+	}
+
+	for _, tag := range ss.GetTags() {
+		fmt.Printf("%s  %s  %s  %s\n", tag.Commit.Hash[:8], tag.Time.Format("2006-01-02 15:04"), tag.Name, tag.Tagger)
+		_, body, _ := strings.Cut(strings.TrimSpace(tag.Message), "\n")
+		for _, line := range strings.Split(body, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Printf("%28s%s\n", "", line)
+			}
+		}
+	}
+}
+
+func restoreSnapshot(ctx context.Context, serverName string, args []string) {
+	if serverName == "" || len(args) != 1 {
+		printUsage()
+		return
+	}
+	ss, err := syncedpz.GetSyncedServer(serverName)
+	utils.HandleErr(err)
+
+	utils.HandleErr(ss.RestoreSnapshot(ctx, args[0]))
+	fmt.Printf(config.GTM("%s restored to %s, the other players will get it on their next sync\n"), ss.Name, args[0])
+}
+
+func serve(ctx context.Context, addr, token string) {
+	if token == "" {
+		utils.HandleErr(syncedpz.LoadAPIToken())
+		token = config.APIToken
+	}
+
+	fmt.Printf(config.GTM("Send the header Authorization: Bearer %s in every request\n"), token)
+	// The API opens the database in each request
+	config.CloseDB()
+	utils.HandleErr(api.ListenAndServe(ctx, addr, token))
+}
+
+func openDashboard(ctx context.Context, addr string) {
+	utils.HandleErr(syncedpz.LoadAPIToken())
+	ln, err := net.Listen("tcp", addr)
+	utils.HandleErr(err)
+
+	url := fmt.Sprintf("http://%s/#token=%s", ln.Addr(), config.APIToken)
+	if err := utils.OpenBrowser(url); err != nil {
+		log.Warn(err)
+	}
+	fmt.Printf(config.GTM("Dashboard running at %s, close this window to stop it\n"), url)
+	config.CloseDB()
+	utils.HandleErr(api.Serve(ctx, ln, config.APIToken))
+}
+
+func runAgent(ctx context.Context, interval time.Duration) {
+	if interval < time.Minute {
+		log.Fatal(config.GTM("The interval of the agent must be at least 1 minute"))
+	}
+	fmt.Println(config.GTM("Agent running, close this window to stop it"))
+	// The agent opens the database in each cycle
+	config.CloseDB()
+	utils.HandleErr(agent.New(interval).Run(ctx))
+}
+
+func agentStatus(ctx context.Context) {
+	state, err := agent.Query(ctx)
+	if errors.Is(err, agent.ErrNotRunning) {
+		fmt.Println(config.GTM("The agent is not running, start it with syncedpz agent"))
+		return
+	}
+	utils.HandleErr(err)
+
+	fmt.Printf(config.GTM("Agent running since %s (pid %d), syncing every %s\n"),
+		state.StartedAt.Format("2006-01-02 15:04"), state.PID, time.Duration(state.IntervalSeconds)*time.Second)
+	if !state.LastCycle.IsZero() {
+		fmt.Println(config.GTM("  Last cycle:"), state.LastCycle.Format("2006-01-02 15:04"))
+		fmt.Println(config.GTM("  Next cycle:"), state.NextCycle.Format("2006-01-02 15:04"))
+	}
+	if state.GameRunning {
+		fmt.Println(config.GTM("  Project Zomboid is running, the servers are synced once it closes"))
+	}
+	for _, server := range state.Servers {
+		fmt.Printf("  %s: %s", server.Name, server.Result)
+		if server.Error != "" {
+			fmt.Printf(" (%s)", server.Error)
+		}
+		fmt.Println()
+		if !server.LastUpdate.IsZero() {
+			fmt.Println(config.GTM("    Last update:"), server.LastUpdate.Format("2006-01-02 15:04"))
+		}
+	}
+}
+
+func printRemoteHealth(rh syncedpz.RemoteHealth) {
+	fmt.Printf("  %s: ", rh.URL)
+	switch {
+	case rh.LastSuccess.IsZero() && rh.LastFailure.IsZero():
+		fmt.Println(config.GTM("not used yet"))
+	case rh.Permanent:
+		fmt.Printf(config.GTM("failing, retrying won't help: %s\n"), rh.LastError)
+	case rh.Healthy():
+		fmt.Printf(config.GTM("ok (last success %s)\n"), rh.LastSuccess.Format("2006-01-02 15:04"))
+	default:
+		fmt.Printf(config.GTM("failed %d times in a row, last at %s: %s\n"), rh.ConsecutiveFailures, rh.LastFailure.Format("2006-01-02 15:04"), rh.LastError)
+	}
+}
+
+// checkMods prints the missing mods of every synced server, returns false if any mod is missing
+func checkMods() bool {
+	ok := true
+	for _, ss := range syncedpz.GetSyncedServers() {
+		report, err := ss.VerifyMods()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		for mod, path := range report.MismatchedMods {
+			log.Warnf("Mod %s of %s is installed at %s, not from the server workshop items, its version may differ", mod, ss.Name, path)
+		}
+		if report.OK() {
+			continue
+		}
+
+		ok = false
+		fmt.Printf(config.GTM("Missing mods for %s, install them before playing:\n"), ss.Name)
+		for _, item := range report.MissingWorkshopItems {
+			fmt.Printf(config.GTM("  Workshop item %s: https://steamcommunity.com/sharedfiles/filedetails/?id=%s\n"), item, item)
+		}
+		for _, mod := range report.MissingMods {
+			fmt.Printf(config.GTM("  Mod %s\n"), mod)
+		}
+	}
+	return ok
 }
 
 func setLanguage() {
@@ -325,5 +971,5 @@ func setLanguage() {
 		}
 	}
 
-	syncedpz.SetupLanguage(choice)
+	utils.HandleErr(syncedpz.SetupLanguage(choice))
 }
@@ -0,0 +1,54 @@
+package pzconfig
+
+import "bytes"
+
+// parseINI parses the lines "key=value" of the server .ini file.
+// Empty lines and comments (starting with # or ;) are ignored
+func parseINI(src []byte) []*Entry {
+	entries := []*Entry{}
+
+	offset := 0
+	for offset < len(src) {
+		lineEnd := len(src)
+		if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+			lineEnd = offset + i
+		}
+		line := src[offset:lineEnd]
+		lineStart := offset
+		offset = lineEnd + 1
+
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		eq := bytes.IndexByte(line, '=')
+		if eq < 0 {
+			continue
+		}
+
+		key := string(bytes.TrimSpace(line[:eq]))
+		if key == "" {
+			continue
+		}
+
+		// Value span without surrounding spaces (and the \r of CRLF files)
+		start := lineStart + eq + 1
+		end := lineStart + len(line)
+		for start < end && (src[start] == ' ' || src[start] == '\t') {
+			start++
+		}
+		for end > start && (src[end-1] == ' ' || src[end-1] == '\t' || src[end-1] == '\r') {
+			end--
+		}
+
+		entries = append(entries, &Entry{
+			Key:      key,
+			Value:    string(src[start:end]),
+			keyStart: lineStart + bytes.Index(line, []byte(key)),
+			start:    start,
+			end:      end,
+		})
+	}
+
+	return entries
+}
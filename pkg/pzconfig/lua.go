@@ -0,0 +1,322 @@
+package pzconfig
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type luaTokenKind int
+
+const (
+	luaEOF luaTokenKind = iota
+	luaIdent
+	luaNumber
+	luaString
+	luaSymbol
+)
+
+type luaToken struct {
+	kind  luaTokenKind
+	text  string
+	start int
+	end   int
+}
+
+// lexLua splits the lua source in tokens, skipping spaces and comments.
+// It only knows what is needed to read the tables used by Project Zomboid config files
+func lexLua(src []byte) ([]luaToken, error) {
+	tokens := []luaToken{}
+
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '-' && i+1 < len(src) && src[i+1] == '-':
+			if bytes.HasPrefix(src[i+2:], []byte("[[")) {
+				end := bytes.Index(src[i+4:], []byte("]]"))
+				if end < 0 {
+					return nil, fmt.Errorf("unclosed comment at offset %d", i)
+				}
+				i += 4 + end + 2
+			} else {
+				end := bytes.IndexByte(src[i:], '\n')
+				if end < 0 {
+					end = len(src) - i
+				}
+				i += end
+			}
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unclosed string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, luaToken{luaString, string(src[start:i]), start, i})
+		case isLuaIdentStart(c):
+			start := i
+			for i < len(src) && (isLuaIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, luaToken{luaIdent, string(src[start:i]), start, i})
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || isLuaIdentStart(src[i]) || src[i] == '.' ||
+				((src[i] == '-' || src[i] == '+') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, luaToken{luaNumber, string(src[start:i]), start, i})
+		default:
+			tokens = append(tokens, luaToken{luaSymbol, string(c), i, i + 1})
+			i++
+		}
+	}
+
+	return append(tokens, luaToken{kind: luaEOF, start: len(src), end: len(src)}), nil
+}
+
+func isLuaIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type luaParser struct {
+	src     []byte
+	tokens  []luaToken
+	pos     int
+	entries []*Entry
+	tables  map[string]int
+}
+
+// parseLua reads every table constructor found at the top level of the file, like
+// "SandboxVars = { ... }" or "return { ... }", flattening their fields in entries.
+// The name the table is assigned to is not part of the keys, so SandboxVars.ZombieLore.Speed is
+// just "ZombieLore.Speed". Positional fields are named [1], [2]... unless they are tables with a
+// name field (like the spawn regions), then they are named after it, e.g. "[Muldraugh, KY].file"
+func parseLua(src []byte) ([]*Entry, map[string]int, error) {
+	tokens, err := lexLua(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &luaParser{src: src, tokens: tokens, tables: make(map[string]int)}
+	for p.peek().kind != luaEOF {
+		if p.next().text == "{" {
+			if err := p.parseTable(""); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return p.entries, p.tables, nil
+}
+
+func (p *luaParser) peek() luaToken {
+	return p.tokens[p.pos]
+}
+
+func (p *luaParser) next() luaToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != luaEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *luaParser) expect(text string) error {
+	tok := p.next()
+	if tok.text != text {
+		return fmt.Errorf("expected %q at offset %d, found %q", text, tok.start, tok.text)
+	}
+	return nil
+}
+
+// parseTable parses the fields of a table, the opening brace was already consumed
+func (p *luaParser) parseTable(prefix string) error {
+	index := 0
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == luaEOF:
+			return fmt.Errorf("unclosed table %q", prefix)
+		case tok.text == "}":
+			p.next()
+			p.tables[prefix] = tok.start
+			return nil
+		case tok.text == "," || tok.text == ";":
+			p.next()
+			continue
+		}
+
+		keyStart := tok.start
+		var segment string
+		positional := false
+		if tok.kind == luaIdent && p.tokens[p.pos+1].text == "=" {
+			segment = tok.text
+			p.pos += 2
+		} else if tok.text == "[" {
+			p.next()
+			keyTok := p.next()
+			segment = "[" + unquoteLua(keyTok.text) + "]"
+			if err := p.expect("]"); err != nil {
+				return err
+			}
+			if err := p.expect("="); err != nil {
+				return err
+			}
+		} else {
+			index++
+			segment = "[" + strconv.Itoa(index) + "]"
+			positional = true
+		}
+
+		key := joinKey(prefix, segment)
+		if p.peek().text == "{" {
+			p.next()
+			first := len(p.entries)
+			if err := p.parseTable(key); err != nil {
+				return err
+			}
+			if positional {
+				p.renameByName(key, first)
+			}
+			continue
+		}
+
+		start, end, err := p.parseValue()
+		if err != nil {
+			return err
+		}
+		p.entries = append(p.entries, &Entry{
+			Key:      key,
+			Value:    string(p.src[start:end]),
+			keyStart: keyStart,
+			start:    start,
+			end:      end,
+		})
+	}
+}
+
+// parseValue skips the tokens of a scalar value (which may be an expression like -1 or a function call),
+// returning its span
+func (p *luaParser) parseValue() (int, int, error) {
+	first := p.peek()
+	last := first
+	depth := 0
+	for {
+		tok := p.peek()
+		if tok.kind == luaEOF {
+			return 0, 0, fmt.Errorf("unexpected end of file at offset %d", tok.start)
+		}
+		if depth == 0 && (tok.text == "," || tok.text == ";" || tok.text == "}") {
+			break
+		}
+		switch tok.text {
+		case "(", "{", "[":
+			depth++
+		case ")", "}", "]":
+			depth--
+		}
+		last = p.next()
+	}
+	if last.end <= first.start {
+		return 0, 0, fmt.Errorf("missing value at offset %d", first.start)
+	}
+	return first.start, last.end, nil
+}
+
+// renameByName renames a positional table, and everything inside it, after its name field
+func (p *luaParser) renameByName(key string, first int) {
+	name := ""
+	for _, e := range p.entries[first:] {
+		if e.Key == key+".name" {
+			name = e.Value
+		}
+	}
+	if !strings.HasPrefix(name, "\"") && !strings.HasPrefix(name, "'") {
+		return
+	}
+
+	newKey := joinKey(parentKey(key), "["+unquoteLua(name)+"]")
+	if _, ok := p.tables[newKey]; ok {
+		return // another table with the same name, keeps the positional name
+	}
+
+	for _, e := range p.entries[first:] {
+		e.Key = newKey + strings.TrimPrefix(e.Key, key)
+	}
+	for k, v := range p.tables {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(p.tables, k)
+			p.tables[newKey+strings.TrimPrefix(k, key)] = v
+		}
+	}
+}
+
+// unquoteLua returns the content of a lua string literal, other tokens are returned as they are
+func unquoteLua(text string) string {
+	if len(text) < 2 || (text[0] != '"' && text[0] != '\'') {
+		return text
+	}
+	if s, err := strconv.Unquote(text); err == nil && text[0] == '"' {
+		return s
+	}
+	return text[1 : len(text)-1]
+}
+
+// insertLua adds a new field at the end of an existing table
+func (f *File) insertLua(key, value string) error {
+	segments := splitKey(key)
+	segment := segments[len(segments)-1]
+	parent := parentKey(key)
+	if strings.HasPrefix(segment, "[") {
+		return fmt.Errorf("cannot add positional field %q", key)
+	}
+	closing, ok := f.tables[parent]
+	if !ok {
+		return fmt.Errorf("cannot add %q, table %q does not exist", key, parent)
+	}
+
+	nl := f.newline()
+	lineStart := bytes.LastIndexByte(f.src[:closing], '\n') + 1
+
+	// Indents the new field like its siblings, or one level deeper than the closing brace
+	indent := string(f.src[lineStart:skipSpaces(f.src, lineStart)]) + "    "
+	for _, e := range f.entries {
+		if parentKey(e.Key) == parent {
+			siblingLine := bytes.LastIndexByte(f.src[:e.keyStart], '\n') + 1
+			indent = string(f.src[siblingLine:skipSpaces(f.src, siblingLine)])
+		}
+	}
+
+	// The previous field needs a separator before the new one
+	last := closing - 1
+	for last >= 0 && strings.ContainsRune(" \t\r\n", rune(f.src[last])) {
+		last--
+	}
+	needsSeparator := last >= 0 && f.src[last] != '{' && f.src[last] != ',' && f.src[last] != ';'
+
+	field := segment + " = " + value + ","
+	if strings.TrimSpace(string(f.src[lineStart:closing])) == "" {
+		f.replace(lineStart, lineStart, indent+field+nl)
+	} else {
+		f.replace(closing, closing, " "+field+" ")
+	}
+	if needsSeparator {
+		f.replace(last+1, last+1, ",")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package pzconfig
+
+// Conflict is a key changed in different ways by both sides of a merge
+type Conflict struct {
+	Key      string
+	Base     string
+	Ours     string
+	Theirs   string
+	InBase   bool
+	InOurs   bool
+	InTheirs bool
+}
+
+// Merge does a key level three-way merge of the config files.
+// The result is based on ours, so its comments and ordering are kept, with the changes made by theirs
+// since base applied on top of it. When both sides changed the same key differently, ours is kept and
+// the key is returned as a conflict
+func Merge(base, ours, theirs *File) (*File, []Conflict) {
+	result := ours.Clone()
+	conflicts := []Conflict{}
+
+	keys := ours.Keys()
+	for _, key := range theirs.Keys() {
+		if _, ok := ours.index[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range base.Keys() {
+		_, inOurs := ours.index[key]
+		_, inTheirs := theirs.index[key]
+		if !inOurs && !inTheirs {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		b, inBase := base.Get(key)
+		o, inOurs := ours.Get(key)
+		t, inTheirs := theirs.Get(key)
+		conflict := Conflict{key, b, o, t, inBase, inOurs, inTheirs}
+
+		sameOursTheirs := inOurs == inTheirs && o == t
+		sameBaseTheirs := inBase == inTheirs && b == t
+		sameBaseOurs := inBase == inOurs && b == o
+		if sameOursTheirs || sameBaseTheirs {
+			continue // nothing changed or only ours changed
+		}
+		if !sameBaseOurs {
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		// Only theirs changed
+		var err error
+		if inTheirs {
+			err = result.Set(key, t)
+		} else {
+			err = result.Delete(key)
+		}
+		if err != nil {
+			// The change can't be applied to the structure of ours (e.g. a new table in a lua file)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return result, conflicts
+}
@@ -0,0 +1,168 @@
+package pzconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustParse(t *testing.T, filename, src string) *File {
+	t.Helper()
+	f, err := Parse(filename, []byte(src))
+	if err != nil {
+		t.Fatalf("Parse(%s): %s", filename, err)
+	}
+	return f
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		filename  string
+		base      string
+		ours      string
+		theirs    string
+		want      string
+		conflicts []Conflict
+	}{
+		{
+			name:     "nothing changed",
+			filename: "servertest.ini",
+			base:     "PVP=true\nMaxPlayers=16\n",
+			ours:     "PVP=true\nMaxPlayers=16\n",
+			theirs:   "PVP=true\nMaxPlayers=16\n",
+			want:     "PVP=true\nMaxPlayers=16\n",
+		},
+		{
+			name:     "clean merge of different keys",
+			filename: "servertest.ini",
+			base:     "# Players can hurt each other\nPVP=true\nMaxPlayers=16\n",
+			ours:     "# Players can hurt each other\nPVP=false\nMaxPlayers=16\n",
+			theirs:   "# Players can hurt each other\nPVP=true\nMaxPlayers=32\n",
+			want:     "# Players can hurt each other\nPVP=false\nMaxPlayers=32\n",
+		},
+		{
+			name:     "same change on both sides",
+			filename: "servertest.ini",
+			base:     "PVP=true\n",
+			ours:     "PVP=false\n",
+			theirs:   "PVP=false\n",
+			want:     "PVP=false\n",
+		},
+		{
+			name:      "conflict on the same key",
+			filename:  "servertest.ini",
+			base:      "PVP=true\nMaxPlayers=16\n",
+			ours:      "PVP=true\nMaxPlayers=8\n",
+			theirs:    "PVP=true\nMaxPlayers=32\n",
+			want:      "PVP=true\nMaxPlayers=8\n",
+			conflicts: []Conflict{{"MaxPlayers", "16", "8", "32", true, true, true}},
+		},
+		{
+			name:     "added by ours",
+			filename: "servertest.ini",
+			base:     "PVP=true\n",
+			ours:     "PVP=true\nPauseEmpty=true\n",
+			theirs:   "PVP=true\n",
+			want:     "PVP=true\nPauseEmpty=true\n",
+		},
+		{
+			name:     "added by theirs",
+			filename: "servertest.ini",
+			base:     "PVP=true\n",
+			ours:     "PVP=true\n",
+			theirs:   "PVP=true\nPauseEmpty=true\n",
+			want:     "PVP=true\nPauseEmpty=true\n",
+		},
+		{
+			name:      "added by both with different values",
+			filename:  "servertest.ini",
+			base:      "PVP=true\n",
+			ours:      "PVP=true\nPauseEmpty=true\n",
+			theirs:    "PVP=true\nPauseEmpty=false\n",
+			want:      "PVP=true\nPauseEmpty=true\n",
+			conflicts: []Conflict{{"PauseEmpty", "", "true", "false", false, true, true}},
+		},
+		{
+			name:     "deleted by ours",
+			filename: "servertest.ini",
+			base:     "PVP=true\nPauseEmpty=true\n",
+			ours:     "PVP=true\n",
+			theirs:   "PVP=true\nPauseEmpty=true\n",
+			want:     "PVP=true\n",
+		},
+		{
+			name:     "deleted by theirs",
+			filename: "servertest.ini",
+			base:     "PVP=true\nPauseEmpty=true\n",
+			ours:     "PVP=true\nPauseEmpty=true\n",
+			theirs:   "PVP=true\n",
+			want:     "PVP=true\n",
+		},
+		{
+			name:      "deleted by theirs and changed by ours",
+			filename:  "servertest.ini",
+			base:      "PVP=true\nPauseEmpty=true\n",
+			ours:      "PVP=true\nPauseEmpty=false\n",
+			theirs:    "PVP=true\n",
+			want:      "PVP=true\nPauseEmpty=false\n",
+			conflicts: []Conflict{{"PauseEmpty", "true", "false", "", true, true, false}},
+		},
+		{
+			name:      "deleted by ours and changed by theirs",
+			filename:  "servertest.ini",
+			base:      "PVP=true\nPauseEmpty=true\n",
+			ours:      "PVP=true\n",
+			theirs:    "PVP=true\nPauseEmpty=false\n",
+			want:      "PVP=true\n",
+			conflicts: []Conflict{{"PauseEmpty", "true", "", "false", true, false, true}},
+		},
+		{
+			name:     "clean merge of a lua table",
+			filename: "servertest_SandboxVars.lua",
+			base:     "SandboxVars = {\n    Zombies = 4,\n    ZombieLore = {\n        Speed = 2,\n    },\n}\n",
+			ours:     "SandboxVars = {\n    Zombies = 3,\n    ZombieLore = {\n        Speed = 2,\n    },\n}\n",
+			theirs:   "SandboxVars = {\n    Zombies = 4,\n    ZombieLore = {\n        Speed = 1,\n    },\n}\n",
+			want:     "SandboxVars = {\n    Zombies = 3,\n    ZombieLore = {\n        Speed = 1,\n    },\n}\n",
+		},
+		{
+			name:      "conflict in a lua table",
+			filename:  "servertest_SandboxVars.lua",
+			base:      "SandboxVars = {\n    ZombieLore = {\n        Speed = 2,\n    },\n}\n",
+			ours:      "SandboxVars = {\n    ZombieLore = {\n        Speed = 1,\n    },\n}\n",
+			theirs:    "SandboxVars = {\n    ZombieLore = {\n        Speed = 3,\n    },\n}\n",
+			want:      "SandboxVars = {\n    ZombieLore = {\n        Speed = 1,\n    },\n}\n",
+			conflicts: []Conflict{{"ZombieLore.Speed", "2", "1", "3", true, true, true}},
+		},
+		{
+			name:      "table added by theirs can't be applied to a lua file",
+			filename:  "servertest_SandboxVars.lua",
+			base:      "SandboxVars = {\n    Zombies = 4,\n}\n",
+			ours:      "SandboxVars = {\n    Zombies = 4,\n}\n",
+			theirs:    "SandboxVars = {\n    Zombies = 4,\n    Map = {\n        AllowMiniMap = true,\n    },\n}\n",
+			want:      "SandboxVars = {\n    Zombies = 4,\n}\n",
+			conflicts: []Conflict{{"Map.AllowMiniMap", "", "", "true", false, false, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := mustParse(t, tt.filename, tt.base)
+			ours := mustParse(t, tt.filename, tt.ours)
+			theirs := mustParse(t, tt.filename, tt.theirs)
+
+			merged, conflicts := Merge(base, ours, theirs)
+			if got := string(merged.Bytes()); got != tt.want {
+				t.Errorf("merged file =\n%s\nwant\n%s", got, tt.want)
+			}
+			if tt.conflicts == nil {
+				tt.conflicts = []Conflict{}
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %+v, want %+v", conflicts, tt.conflicts)
+			}
+			if string(ours.Bytes()) != tt.ours {
+				t.Error("the merge modified ours")
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// Package pzconfig parses the Project Zomboid server config files (<server>.ini, <server>_SandboxVars.lua,
+// <server>_spawnregions.lua...) into flat key/value entries.
+// Every entry remembers where its value is in the source, so values can be changed without touching the
+// comments, ordering and formatting of the rest of the file
+package pzconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type Format int
+
+const (
+	FormatINI Format = iota
+	FormatLua
+)
+
+var ErrUnsupportedFile = errors.New("unsupported config file")
+
+// Entry is a single setting of a config file.
+// Key is the flattened path of the setting, e.g. "PVP" in an .ini file or "ZombieLore.Speed" in a lua file.
+// Value is the raw text of the value as it is written in the file, e.g. "true" or "\"Muldraugh, KY\""
+type Entry struct {
+	Key   string
+	Value string
+
+	keyStart int
+	start    int
+	end      int
+}
+
+// File is a parsed config file
+type File struct {
+	Format Format
+
+	src     []byte
+	entries []*Entry
+	index   map[string]*Entry
+	tables  map[string]int // lua only: offset of the closing brace of every table, by key path
+}
+
+// IsSupported returns true if the file can be parsed by this package
+func IsSupported(filename string) bool {
+	_, err := formatOf(filename)
+	return err == nil
+}
+
+func formatOf(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ini":
+		return FormatINI, nil
+	case ".lua":
+		return FormatLua, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnsupportedFile, filename)
+}
+
+// Parse parses the config file according to its extension
+func Parse(filename string, data []byte) (*File, error) {
+	format, err := formatOf(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{Format: format, src: append([]byte{}, data...)}
+	if err := f.parse(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(filename), err)
+	}
+	return f, nil
+}
+
+func (f *File) parse() error {
+	f.entries = nil
+	f.index = make(map[string]*Entry)
+	f.tables = make(map[string]int)
+
+	var err error
+	switch f.Format {
+	case FormatINI:
+		f.entries = parseINI(f.src)
+	case FormatLua:
+		f.entries, f.tables, err = parseLua(f.src)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range f.entries {
+		f.index[e.Key] = e
+	}
+	return nil
+}
+
+// Bytes returns the content of the file
+func (f *File) Bytes() []byte {
+	return append([]byte{}, f.src...)
+}
+
+// Get returns the raw value of the key
+func (f *File) Get(key string) (string, bool) {
+	e, ok := f.index[key]
+	if !ok {
+		return "", false
+	}
+	return e.Value, true
+}
+
+// Keys returns all the keys of the file, in the order they appear
+func (f *File) Keys() []string {
+	keys := make([]string, 0, len(f.entries))
+	for _, e := range f.entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+// Entries returns all the entries of the file, in the order they appear
+func (f *File) Entries() []Entry {
+	entries := make([]Entry, 0, len(f.entries))
+	for _, e := range f.entries {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// Clone returns a copy of the file
+func (f *File) Clone() *File {
+	clone := &File{Format: f.Format, src: f.Bytes()}
+	clone.parse() // the source was already parsed once, it can't fail
+	return clone
+}
+
+// Set sets the raw value of the key, adding the key if it doesn't exist.
+// In lua files new keys can only be added to tables that already exist
+func (f *File) Set(key, value string) error {
+	if e, ok := f.index[key]; ok {
+		f.replace(e.start, e.end, value)
+		return f.parse()
+	}
+
+	switch f.Format {
+	case FormatINI:
+		f.appendLine(key + "=" + value)
+	case FormatLua:
+		if err := f.insertLua(key, value); err != nil {
+			return err
+		}
+	}
+	return f.parse()
+}
+
+// Delete removes the key from the file
+func (f *File) Delete(key string) error {
+	e, ok := f.index[key]
+	if !ok {
+		return nil
+	}
+
+	start, end := e.keyStart, e.end
+	if f.Format == FormatLua {
+		// Also removes the separator after the value
+		i := skipSpaces(f.src, end)
+		if i < len(f.src) && (f.src[i] == ',' || f.src[i] == ';') {
+			end = i + 1
+		}
+	}
+
+	// Removes the whole line if nothing else is in it
+	lineStart := bytes.LastIndexByte(f.src[:start], '\n') + 1
+	lineEnd := len(f.src)
+	if i := bytes.IndexByte(f.src[end:], '\n'); i >= 0 {
+		lineEnd = end + i + 1
+	}
+	before := strings.TrimSpace(string(f.src[lineStart:start]))
+	after := strings.TrimSpace(string(f.src[end:lineEnd]))
+	if before == "" && after == "" {
+		start, end = lineStart, lineEnd
+	}
+
+	f.replace(start, end, "")
+	return f.parse()
+}
+
+func (f *File) replace(start, end int, text string) {
+	src := make([]byte, 0, len(f.src)-(end-start)+len(text))
+	src = append(src, f.src[:start]...)
+	src = append(src, text...)
+	src = append(src, f.src[end:]...)
+	f.src = src
+}
+
+func (f *File) newline() string {
+	if bytes.Contains(f.src, []byte("\r\n")) {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func (f *File) appendLine(line string) {
+	nl := f.newline()
+	if len(f.src) > 0 && f.src[len(f.src)-1] != '\n' {
+		f.src = append(f.src, nl...)
+	}
+	f.src = append(f.src, line+nl...)
+}
+
+func skipSpaces(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// splitKey splits the key path in its segments, ignoring the dots inside brackets
+func splitKey(key string) []string {
+	segments := []string{}
+	depth := 0
+	last := 0
+	for i, c := range key {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				segments = append(segments, key[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(segments, key[last:])
+}
+
+// parentKey returns the key path of the table containing the key, empty for top level keys
+func parentKey(key string) string {
+	segments := splitKey(key)
+	return strings.Join(segments[:len(segments)-1], ".")
+}
+
+func joinKey(prefix, segment string) string {
+	if prefix == "" {
+		return segment
+	}
+	return prefix + "." + segment
+}
@@ -0,0 +1,281 @@
+package pzconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SettingsFile is the server config file a setting belongs to
+type SettingsFile int
+
+const (
+	ServerINI   SettingsFile = iota // <server>.ini
+	SandboxVars                     // <server>_SandboxVars.lua
+)
+
+// Filename returns the name of the settings file of the server
+func (sf SettingsFile) Filename(serverName string) string {
+	if sf == SandboxVars {
+		return serverName + "_SandboxVars.lua"
+	}
+	return serverName + ".ini"
+}
+
+// Format returns the format of the settings file
+func (sf SettingsFile) Format() Format {
+	if sf == SandboxVars {
+		return FormatLua
+	}
+	return FormatINI
+}
+
+type SettingType int
+
+const (
+	TypeString SettingType = iota
+	TypeBool
+	TypeInt
+	TypeFloat
+)
+
+func (t SettingType) String() string {
+	switch t {
+	case TypeBool:
+		return "bool"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	}
+	return "string"
+}
+
+// Setting describes a known Project Zomboid server setting
+type Setting struct {
+	Key         string
+	File        SettingsFile
+	Type        SettingType
+	Min         float64 // only used by numbers when Min != Max
+	Max         float64
+	Description string
+}
+
+// Range returns the valid range of the setting as text, empty when any value is valid
+func (s Setting) Range() string {
+	if s.Min == s.Max {
+		return ""
+	}
+	return fmt.Sprintf("%v-%v", s.Min, s.Max)
+}
+
+// Validate checks if the value (without lua quotes) is valid for the setting
+func (s Setting) Validate(value string) error {
+	var number float64
+	var err error
+	switch s.Type {
+	case TypeBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%s must be true or false", s.Key)
+		}
+		return nil
+	case TypeInt:
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 64)
+		number = float64(i)
+	case TypeFloat:
+		number, err = strconv.ParseFloat(value, 64)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s must be a number of type %s", s.Key, s.Type)
+	}
+	if s.Min != s.Max && (number < s.Min || number > s.Max) {
+		return fmt.Errorf("%s must be between %v and %v", s.Key, s.Min, s.Max)
+	}
+	return nil
+}
+
+// LookupSetting returns the known setting with the given key (case insensitive)
+func LookupSetting(key string) (Setting, bool) {
+	for _, s := range Schema {
+		if strings.EqualFold(s.Key, key) {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// DisplayValue returns the value as the user sees it, without the quotes of lua strings
+func DisplayValue(format Format, raw string) string {
+	if format == FormatLua {
+		return unquoteLua(raw)
+	}
+	return raw
+}
+
+// RawValue returns the value as it must be written in a file of the given format.
+// In lua files strings are quoted, anything else is written as it is
+func RawValue(format Format, value string, t SettingType) string {
+	if format == FormatLua && t == TypeString {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// InferType guesses the type of an unknown setting by its raw value
+func InferType(format Format, raw string) SettingType {
+	if format == FormatLua && (strings.HasPrefix(raw, "\"") || strings.HasPrefix(raw, "'")) {
+		return TypeString
+	}
+	if raw == "true" || raw == "false" {
+		return TypeBool
+	}
+	if _, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return TypeInt
+	}
+	if _, err := strconv.ParseFloat(raw, 64); err == nil {
+		return TypeFloat
+	}
+	return TypeString
+}
+
+// Schema is the table of known server settings (build 41), with their types and valid ranges.
+// Settings not listed here can still be read and changed, but without validation
+var Schema = []Setting{
+	// <server>.ini
+	{"PVP", ServerINI, TypeBool, 0, 0, "Players can hurt and kill other players"},
+	{"PauseEmpty", ServerINI, TypeBool, 0, 0, "Game time stops when there are no players online"},
+	{"GlobalChat", ServerINI, TypeBool, 0, 0, "Enables the global chat"},
+	{"Open", ServerINI, TypeBool, 0, 0, "Players can join without being in the whitelist"},
+	{"ServerWelcomeMessage", ServerINI, TypeString, 0, 0, "Message shown to players when they join"},
+	{"AutoCreateUserInWhiteList", ServerINI, TypeBool, 0, 0, "Adds unknown players to the whitelist when they join"},
+	{"DisplayUserName", ServerINI, TypeBool, 0, 0, "Shows the usernames above the players heads"},
+	{"ShowFirstAndLastName", ServerINI, TypeBool, 0, 0, "Shows the character names above the players heads"},
+	{"SpawnPoint", ServerINI, TypeString, 0, 0, "Forces every new player to spawn at x,y,z (0,0,0 disables it)"},
+	{"SafetySystem", ServerINI, TypeBool, 0, 0, "Players can enable or disable their PVP safety"},
+	{"ShowSafety", ServerINI, TypeBool, 0, 0, "Shows a skull icon over players with PVP enabled"},
+	{"SafetyToggleTimer", ServerINI, TypeInt, 0, 1000, "Seconds it takes to toggle the PVP safety"},
+	{"SafetyCooldownTimer", ServerINI, TypeInt, 0, 1000, "Seconds before the PVP safety can be toggled again"},
+	{"SpawnItems", ServerINI, TypeString, 0, 0, "Items given to new players, separated by commas"},
+	{"DefaultPort", ServerINI, TypeInt, 0, 65535, "Port of the server"},
+	{"UDPPort", ServerINI, TypeInt, 0, 65535, "UDP port of the server"},
+	{"ResetID", ServerINI, TypeInt, 0, 2147483647, "Changing it forces every player to create a new character"},
+	{"Mods", ServerINI, TypeString, 0, 0, "Mod IDs loaded by the server, separated by semicolons"},
+	{"Map", ServerINI, TypeString, 0, 0, "Map folders loaded by the server, separated by semicolons"},
+	{"DoLuaChecksum", ServerINI, TypeBool, 0, 0, "Kicks players whose lua files differ from the server ones"},
+	{"Public", ServerINI, TypeBool, 0, 0, "Shows the server in the public server list"},
+	{"PublicName", ServerINI, TypeString, 0, 0, "Name of the server in the public server list"},
+	{"PublicDescription", ServerINI, TypeString, 0, 0, "Description of the server in the public server list"},
+	{"MaxPlayers", ServerINI, TypeInt, 1, 100, "Maximum number of players online at the same time"},
+	{"PingLimit", ServerINI, TypeInt, 100, 2147483647, "Players with a higher ping (ms) are kicked"},
+	{"HoursForLootRespawn", ServerINI, TypeInt, 0, 2147483647, "In-game hours for the loot to respawn (0 disables it)"},
+	{"MaxItemsForLootRespawn", ServerINI, TypeInt, 1, 2147483647, "Containers with more items than this don't respawn loot"},
+	{"ConstructionPreventsLootRespawn", ServerINI, TypeBool, 0, 0, "Loot doesn't respawn in buildings with player constructions"},
+	{"DropOffWhiteListAfterDeath", ServerINI, TypeBool, 0, 0, "Removes players from the whitelist when they die"},
+	{"NoFire", ServerINI, TypeBool, 0, 0, "Disables fire, except for campfires"},
+	{"AnnounceDeath", ServerINI, TypeBool, 0, 0, "Announces the death of players in the chat"},
+	{"SaveWorldEveryMinutes", ServerINI, TypeInt, 0, 2147483647, "Real minutes between world saves (0 saves only when needed)"},
+	{"PlayerSafehouse", ServerINI, TypeBool, 0, 0, "Players can claim safehouses"},
+	{"AdminSafehouse", ServerINI, TypeBool, 0, 0, "Only admins can claim safehouses"},
+	{"SafehouseAllowTrepass", ServerINI, TypeBool, 0, 0, "Non members can enter safehouses"},
+	{"SafehouseAllowFire", ServerINI, TypeBool, 0, 0, "Fire can damage safehouses"},
+	{"SafehouseAllowLoot", ServerINI, TypeBool, 0, 0, "Non members can take items from safehouses"},
+	{"SafehouseAllowRespawn", ServerINI, TypeBool, 0, 0, "Players respawn in their safehouse after dying"},
+	{"SafehouseDaySurvivedToClaim", ServerINI, TypeInt, 0, 2147483647, "Days a player must survive before claiming a safehouse"},
+	{"AllowDestructionBySledgehammer", ServerINI, TypeBool, 0, 0, "Players can destroy world objects with sledgehammers"},
+	{"Password", ServerINI, TypeString, 0, 0, "Password needed to join the server"},
+	{"MaxAccountsPerUser", ServerINI, TypeInt, 0, 2147483647, "Accounts a single Steam user can create (0 is unlimited)"},
+	{"SleepAllowed", ServerINI, TypeBool, 0, 0, "Players can sleep"},
+	{"SleepNeeded", ServerINI, TypeBool, 0, 0, "Players get tired and need to sleep"},
+	{"WorkshopItems", ServerINI, TypeString, 0, 0, "Steam workshop item IDs, separated by semicolons"},
+	{"Faction", ServerINI, TypeBool, 0, 0, "Players can create factions"},
+	{"VoiceEnable", ServerINI, TypeBool, 0, 0, "Enables the voice chat"},
+	{"PlayerRespawnWithSelf", ServerINI, TypeBool, 0, 0, "Players can respawn at the place they died"},
+	{"PlayerRespawnWithOther", ServerINI, TypeBool, 0, 0, "Players can respawn at the position of a split screen player"},
+	{"FastForwardMultiplier", ServerINI, TypeFloat, 1, 100, "How fast time passes while every player is sleeping"},
+	{"BackupsCount", ServerINI, TypeInt, 1, 300, "Number of backups kept by the game"},
+	{"BackupsOnStart", ServerINI, TypeBool, 0, 0, "The game makes a backup when the server starts"},
+	{"BackupsPeriod", ServerINI, TypeInt, 0, 1500, "Real minutes between the backups of the game (0 disables them)"},
+
+	// <server>_SandboxVars.lua
+	{"Zombies", SandboxVars, TypeInt, 1, 6, "Zombie population: 1 = Insane, 2 = Very High, 3 = High, 4 = Normal, 5 = Low, 6 = None"},
+	{"Distribution", SandboxVars, TypeInt, 1, 2, "Zombie distribution: 1 = Urban Focused, 2 = Uniform"},
+	{"DayLength", SandboxVars, TypeInt, 1, 26, "Real time length of an in-game day: 1 = 15 minutes ... 26 = Real-time"},
+	{"StartYear", SandboxVars, TypeInt, 1, 100, "Start year, 1 = 1993"},
+	{"StartMonth", SandboxVars, TypeInt, 1, 12, "Start month"},
+	{"StartDay", SandboxVars, TypeInt, 1, 31, "Start day of the month"},
+	{"StartTime", SandboxVars, TypeInt, 1, 9, "Start time: 1 = 7 AM, 2 = 9 AM ... 9 = 5 AM"},
+	{"WaterShut", SandboxVars, TypeInt, 1, 8, "Water shutoff: 1 = Instant, 2 = 0-30 days ... 7 = 6-12 months, 8 = Never"},
+	{"ElecShut", SandboxVars, TypeInt, 1, 8, "Electricity shutoff: 1 = Instant, 2 = 0-30 days ... 7 = 6-12 months, 8 = Never"},
+	{"WaterShutModifier", SandboxVars, TypeInt, -1, 2147483647, "Exact day the water is shut off"},
+	{"ElecShutModifier", SandboxVars, TypeInt, -1, 2147483647, "Exact day the electricity is shut off"},
+	{"FoodLoot", SandboxVars, TypeInt, 1, 7, "Food loot rarity: 1 = None, 2 = Insanely Rare ... 7 = Abundant"},
+	{"WeaponLoot", SandboxVars, TypeInt, 1, 7, "Weapon loot rarity: 1 = None, 2 = Insanely Rare ... 7 = Abundant"},
+	{"OtherLoot", SandboxVars, TypeInt, 1, 7, "Other loot rarity: 1 = None, 2 = Insanely Rare ... 7 = Abundant"},
+	{"Temperature", SandboxVars, TypeInt, 1, 5, "Temperature: 1 = Very Cold ... 5 = Very Hot"},
+	{"Rain", SandboxVars, TypeInt, 1, 5, "Rain: 1 = Very Dry ... 5 = Very Rainy"},
+	{"ErosionSpeed", SandboxVars, TypeInt, 1, 5, "Erosion speed: 1 = Very Fast (20 days) ... 5 = Very Slow (500 days)"},
+	{"XpMultiplier", SandboxVars, TypeFloat, 0.001, 1000, "Multiplier of the experience gained"},
+	{"Farming", SandboxVars, TypeInt, 1, 5, "Farming speed: 1 = Very Fast ... 5 = Very Slow"},
+	{"StatsDecrease", SandboxVars, TypeInt, 1, 5, "Hunger, thirst and fatigue decrease: 1 = Very Fast ... 5 = Very Slow"},
+	{"NatureAbundance", SandboxVars, TypeInt, 1, 5, "Foraging abundance: 1 = Very Poor ... 5 = Very Abundant"},
+	{"Alarm", SandboxVars, TypeInt, 1, 6, "Houses with alarms: 1 = Never ... 6 = Very Often"},
+	{"LockedHouses", SandboxVars, TypeInt, 1, 6, "Locked houses: 1 = Never ... 6 = Very Often"},
+	{"StarterKit", SandboxVars, TypeBool, 0, 0, "New characters start with some items"},
+	{"Nutrition", SandboxVars, TypeBool, 0, 0, "Enables the nutrition system"},
+	{"FoodRotSpeed", SandboxVars, TypeInt, 1, 5, "Food spoil speed: 1 = Very Fast ... 5 = Very Slow"},
+	{"FridgeFactor", SandboxVars, TypeInt, 1, 6, "Fridge effectiveness: 1 = Very Low ... 6 = No decay"},
+	{"LootRespawn", SandboxVars, TypeInt, 1, 5, "Loot respawn: 1 = None, 2 = Every Day ... 5 = Every Six Months"},
+	{"TimeSinceApo", SandboxVars, TypeInt, 1, 13, "Months since the apocalypse started"},
+	{"PlantResilience", SandboxVars, TypeInt, 1, 5, "Plant resilience: 1 = Very High ... 5 = Very Low"},
+	{"PlantAbundance", SandboxVars, TypeInt, 1, 5, "Crop yield: 1 = Very Poor ... 5 = Very Abundant"},
+	{"EndRegen", SandboxVars, TypeInt, 1, 5, "Endurance regeneration: 1 = Very Fast ... 5 = Very Slow"},
+	{"Helicopter", SandboxVars, TypeInt, 1, 4, "Helicopter event: 1 = Never, 2 = Once, 3 = Sometimes, 4 = Often"},
+	{"MetaEvent", SandboxVars, TypeInt, 1, 3, "Distant events like gunshots: 1 = Never, 2 = Sometimes, 3 = Often"},
+	{"SleepingEvent", SandboxVars, TypeInt, 1, 3, "Night time events: 1 = Never, 2 = Sometimes, 3 = Often"},
+	{"GeneratorSpawning", SandboxVars, TypeInt, 1, 5, "Generator spawn rate: 1 = Extremely Rare ... 5 = Common"},
+	{"GeneratorFuelConsumption", SandboxVars, TypeFloat, 0, 100, "Multiplier of the generator fuel consumption"},
+	{"CharacterFreePoints", SandboxVars, TypeInt, -100, 100, "Extra trait points for new characters"},
+	{"NightDarkness", SandboxVars, TypeInt, 1, 4, "Night darkness: 1 = Pitch Black ... 4 = Bright"},
+	{"InjurySeverity", SandboxVars, TypeInt, 1, 3, "Injury severity: 1 = Low, 2 = Normal, 3 = High"},
+	{"BoneFracture", SandboxVars, TypeBool, 0, 0, "Characters can break bones"},
+	{"HoursForCorpseRemoval", SandboxVars, TypeFloat, -1, 2147483647, "In-game hours for corpses to disappear (-1 never)"},
+	{"BloodLevel", SandboxVars, TypeInt, 1, 5, "Amount of blood: 1 = None ... 5 = Ultra Gore"},
+	{"FireSpread", SandboxVars, TypeBool, 0, 0, "Fire can spread"},
+	{"EnableVehicles", SandboxVars, TypeBool, 0, 0, "Vehicles spawn in the world"},
+	{"CarSpawnRate", SandboxVars, TypeInt, 1, 5, "Vehicle spawn rate: 1 = None ... 5 = High"},
+	{"ChanceHasGas", SandboxVars, TypeInt, 1, 3, "Chance of vehicles having gas: 1 = Low, 2 = Normal, 3 = High"},
+	{"InitialGas", SandboxVars, TypeInt, 1, 6, "Initial gas of vehicles: 1 = Very Low ... 6 = Full"},
+	{"LockedCar", SandboxVars, TypeInt, 1, 6, "Locked vehicles: 1 = Never ... 6 = Very Often"},
+	{"CarGeneralCondition", SandboxVars, TypeInt, 1, 5, "Vehicle condition: 1 = Very Low ... 5 = Very High"},
+	{"TrafficJam", SandboxVars, TypeBool, 0, 0, "Traffic jams spawn on the roads"},
+	{"ZombieLore.Speed", SandboxVars, TypeInt, 1, 4, "Zombie speed: 1 = Sprinters, 2 = Fast Shamblers, 3 = Shamblers, 4 = Random"},
+	{"ZombieLore.Strength", SandboxVars, TypeInt, 1, 4, "Zombie strength: 1 = Superhuman, 2 = Normal, 3 = Weak, 4 = Random"},
+	{"ZombieLore.Toughness", SandboxVars, TypeInt, 1, 4, "Zombie toughness: 1 = Tough, 2 = Normal, 3 = Fragile, 4 = Random"},
+	{"ZombieLore.Transmission", SandboxVars, TypeInt, 1, 4, "Infection: 1 = Blood + Saliva, 2 = Saliva Only, 3 = Everyone's Infected, 4 = None"},
+	{"ZombieLore.Mortality", SandboxVars, TypeInt, 1, 7, "Infection mortality: 1 = Instant ... 7 = Never"},
+	{"ZombieLore.Reanimate", SandboxVars, TypeInt, 1, 6, "Reanimation time: 1 = Instant ... 6 = 1-3 days"},
+	{"ZombieLore.Cognition", SandboxVars, TypeInt, 1, 4, "Zombie cognition: 1 = Navigate + Use Doors ... 4 = Random"},
+	{"ZombieLore.Memory", SandboxVars, TypeInt, 1, 5, "Zombie memory: 1 = Long ... 4 = None, 5 = Random"},
+	{"ZombieLore.Sight", SandboxVars, TypeInt, 1, 4, "Zombie sight: 1 = Eagle, 2 = Normal, 3 = Poor, 4 = Random"},
+	{"ZombieLore.Hearing", SandboxVars, TypeInt, 1, 4, "Zombie hearing: 1 = Pinpoint, 2 = Normal, 3 = Poor, 4 = Random"},
+	{"ZombieLore.ThumpNoChasing", SandboxVars, TypeBool, 0, 0, "Zombies thump on doors and windows even when not chasing"},
+	{"ZombieLore.ThumpOnConstruction", SandboxVars, TypeBool, 0, 0, "Zombies destroy player constructions"},
+	{"ZombieLore.ActiveOnly", SandboxVars, TypeInt, 1, 3, "Zombies are more active: 1 = Both, 2 = Night, 3 = Day"},
+	{"ZombieLore.TriggerHouseAlarm", SandboxVars, TypeBool, 0, 0, "Zombies trigger house alarms"},
+	{"ZombieLore.ZombiesDragDown", SandboxVars, TypeBool, 0, 0, "Groups of zombies can drag players down"},
+	{"ZombieLore.ZombiesFenceLunge", SandboxVars, TypeBool, 0, 0, "Zombies can lunge over fences"},
+	{"ZombieConfig.PopulationMultiplier", SandboxVars, TypeFloat, 0, 4, "Multiplier of the zombie population"},
+	{"ZombieConfig.PopulationStartMultiplier", SandboxVars, TypeFloat, 0, 4, "Multiplier of the zombie population at the start"},
+	{"ZombieConfig.PopulationPeakMultiplier", SandboxVars, TypeFloat, 0, 4, "Multiplier of the zombie population at its peak"},
+	{"ZombieConfig.PopulationPeakDay", SandboxVars, TypeInt, 1, 365, "Day the zombie population reaches its peak"},
+	{"ZombieConfig.RespawnHours", SandboxVars, TypeFloat, 0, 8760, "In-game hours for zombies to respawn (0 disables it)"},
+	{"ZombieConfig.RespawnUnseenHours", SandboxVars, TypeFloat, 0, 8760, "Hours a cell must be unseen for zombies to respawn in it"},
+	{"ZombieConfig.RespawnMultiplier", SandboxVars, TypeFloat, 0, 1, "Fraction of the population that respawns"},
+	{"ZombieConfig.RedistributeHours", SandboxVars, TypeFloat, 0, 8760, "In-game hours for zombies to migrate to empty cells"},
+	{"ZombieConfig.FollowSoundDistance", SandboxVars, TypeInt, 10, 1000, "Distance zombies travel following a sound"},
+	{"ZombieConfig.RallyGroupSize", SandboxVars, TypeInt, 0, 1000, "Size of the groups zombies form"},
+}
@@ -0,0 +1,272 @@
+// Package pzsave reads metadata from Project Zomboid save folders: the world time (map_t.bin), the world
+// version and map (map_ver.bin), the map bounds (map_meta.bin) and the characters and vehicles databases
+// (players.db and vehicles.db)
+package pzsave
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrBadHeader = errors.New("bad file header")
+
+// WorldTime is the in-game time of a save
+type WorldTime struct {
+	WorldVersion   int
+	Year           int
+	Month          int // 1-12
+	Day            int // 1-31
+	TimeOfDay      float64
+	NightsSurvived int
+}
+
+// Hour returns the in-game hour
+func (wt WorldTime) Hour() int {
+	return int(wt.TimeOfDay) % 24
+}
+
+// Minute returns the in-game minute
+func (wt WorldTime) Minute() int {
+	return int((wt.TimeOfDay-math.Floor(wt.TimeOfDay))*60) % 60
+}
+
+func (wt WorldTime) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d (day %d)", wt.Year, wt.Month, wt.Day, wt.Hour(), wt.Minute(), wt.NightsSurvived+1)
+}
+
+// MapBounds are the bounds of the world, in cells, found in map_meta.bin
+type MapBounds struct {
+	MinX, MinY, MaxX, MaxY int
+}
+
+func (mb MapBounds) String() string {
+	return fmt.Sprintf("%dx%d cells", mb.MaxX-mb.MinX+1, mb.MaxY-mb.MinY+1)
+}
+
+// Character is a character found in players.db
+type Character struct {
+	Username string
+	Name     string
+	IsDead   bool
+	// In-game hours, 0 if unknown
+	HoursSurvived float64
+}
+
+// SurvivalTime returns the time survived by the character in days and hours, like "12d 5h". Empty if
+// it's unknown
+func (c Character) SurvivalTime() string {
+	hours := int(c.HoursSurvived)
+	switch {
+	case c.HoursSurvived <= 0:
+		return ""
+	case hours < 24:
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dd %dh", hours/24, hours%24)
+}
+
+// Metadata is everything that could be read from a save folder.
+// Fields are left empty when the file they come from is missing or unreadable
+type Metadata struct {
+	Time         *WorldTime
+	WorldVersion int
+	MapName      string
+	Bounds       *MapBounds
+	Characters   []Character
+	Vehicles     int
+}
+
+// Lines returns a human readable summary of the metadata, one line per item
+func (m Metadata) Lines() []string {
+	lines := []string{}
+	if m.Time != nil {
+		lines = append(lines, "In-game date: "+m.Time.String())
+	}
+	if len(m.Characters) > 0 {
+		survivors := []string{}
+		for _, c := range m.Characters {
+			name := c.Name
+			if name == "" {
+				name = c.Username
+			} else if c.Username != "" && c.Username != name {
+				name += " (" + c.Username + ")"
+			}
+			if survived := c.SurvivalTime(); survived != "" {
+				name += " [survived " + survived + "]"
+			}
+			if c.IsDead {
+				name += " [dead]"
+			}
+			survivors = append(survivors, name)
+		}
+		lines = append(lines, "Survivors: "+strings.Join(survivors, ", "))
+	}
+	if m.Vehicles > 0 {
+		lines = append(lines, fmt.Sprintf("Vehicles: %d", m.Vehicles))
+	}
+	if m.MapName != "" || m.WorldVersion > 0 || m.Bounds != nil {
+		mapInfo := []string{}
+		if m.MapName != "" {
+			mapInfo = append(mapInfo, m.MapName)
+		}
+		if m.Bounds != nil {
+			mapInfo = append(mapInfo, m.Bounds.String())
+		}
+		if m.WorldVersion > 0 {
+			mapInfo = append(mapInfo, fmt.Sprintf("world version %d", m.WorldVersion))
+		}
+		lines = append(lines, "Map: "+strings.Join(mapInfo, ", "))
+	}
+	return lines
+}
+
+// ReadMetadata reads the metadata of the save folder.
+// Returns an error only if nothing could be read
+func ReadMetadata(savePath string) (*Metadata, error) {
+	m := &Metadata{}
+	errs := []error{}
+
+	wt, err := ReadWorldTime(filepath.Join(savePath, "map_t.bin"))
+	if err == nil {
+		m.Time = wt
+		m.WorldVersion = wt.WorldVersion
+	} else {
+		errs = append(errs, err)
+	}
+
+	version, mapName, err := ReadMapVersion(filepath.Join(savePath, "map_ver.bin"))
+	if err == nil {
+		m.WorldVersion = version
+		m.MapName = mapName
+	} else {
+		errs = append(errs, err)
+	}
+
+	bounds, err := ReadMapBounds(filepath.Join(savePath, "map_meta.bin"))
+	if err == nil {
+		m.Bounds = bounds
+	} else {
+		errs = append(errs, err)
+	}
+
+	characters, err := ReadCharacters(filepath.Join(savePath, "players.db"))
+	if err == nil {
+		m.Characters = characters
+	} else {
+		errs = append(errs, err)
+	}
+
+	vehicles, err := CountVehicles(filepath.Join(savePath, "vehicles.db"))
+	if err == nil {
+		m.Vehicles = vehicles
+	} else {
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 5 {
+		return nil, errors.Join(errs...)
+	}
+	return m, nil
+}
+
+// ReadWorldTime reads map_t.bin, written by GameTime.save: the magic "GMTM", the world version, the time
+// multiplier, the nights survived, the target zombies, the last time of day, the time of day and the
+// day, month and year (0 based day and month). Everything is big endian, like java's DataOutputStream
+func ReadWorldTime(path string) (*WorldTime, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var header struct {
+		Magic          [4]byte
+		WorldVersion   int32
+		Multiplier     float32
+		NightsSurvived int32
+		TargetZombies  int32
+		LastTimeOfDay  float32
+		TimeOfDay      float32
+		Day            int32
+		Month          int32
+		Year           int32
+	}
+	if err := binary.Read(file, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if string(header.Magic[:]) != "GMTM" {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrBadHeader)
+	}
+
+	return &WorldTime{
+		WorldVersion:   int(header.WorldVersion),
+		Year:           int(header.Year),
+		Month:          int(header.Month) + 1,
+		Day:            int(header.Day) + 1,
+		TimeOfDay:      float64(header.TimeOfDay),
+		NightsSurvived: int(header.NightsSurvived),
+	}, nil
+}
+
+// ReadMapVersion reads map_ver.bin: the world version followed by the map name, a java UTF string
+// (16 bits length and the bytes). Older saves only have the world version
+func ReadMapVersion(path string) (int, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	var version int32
+	if err := binary.Read(file, binary.BigEndian, &version); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if version <= 0 {
+		return 0, "", fmt.Errorf("%s: %w", filepath.Base(path), ErrBadHeader)
+	}
+
+	var length uint16
+	if err := binary.Read(file, binary.BigEndian, &length); err != nil {
+		return int(version), "", nil
+	}
+	mapName := make([]byte, length)
+	if _, err := io.ReadFull(file, mapName); err != nil {
+		return int(version), "", nil
+	}
+	return int(version), string(mapName), nil
+}
+
+// ReadMapBounds reads the header of map_meta.bin, written by IsoMetaGrid.save: the magic "META", the world
+// version and the bounds of the world in cells
+func ReadMapBounds(path string) (*MapBounds, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var header struct {
+		Magic                  [4]byte
+		WorldVersion           int32
+		MinX, MinY, MaxX, MaxY int32
+	}
+	if err := binary.Read(file, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if string(header.Magic[:]) != "META" || header.MaxX < header.MinX || header.MaxY < header.MinY {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrBadHeader)
+	}
+
+	return &MapBounds{
+		MinX: int(header.MinX),
+		MinY: int(header.MinY),
+		MaxX: int(header.MaxX),
+		MaxY: int(header.MaxY),
+	}, nil
+}
@@ -0,0 +1,118 @@
+package pzsave
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// openDB opens a save database in read only mode
+func openDB(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	dsn := "file:" + filepath.ToSlash(path) + "?mode=ro"
+	return sql.Open("sqlite", dsn)
+}
+
+func hasTable(db *sql.DB, table string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	return count > 0, err
+}
+
+// findColumn returns the name of the column of the table matching the name case insensitively, empty if
+// there's none
+func findColumn(db *sql.DB, table, column string) (string, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		if strings.EqualFold(name, column) {
+			return name, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// ReadCharacters reads the characters of players.db.
+// Multiplayer saves keep them in the networkPlayers table, singleplayer ones in localPlayers. The hours
+// survived are read from the hoursSurvived column, left at 0 by the versions of the game without it
+func ReadCharacters(path string) ([]Character, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	table, username := "", ""
+	if ok, err := hasTable(db, "networkPlayers"); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	} else if ok {
+		table, username = "networkPlayers", "username"
+	} else if ok, _ := hasTable(db, "localPlayers"); ok {
+		table, username = "localPlayers", "''"
+	} else {
+		return nil, fmt.Errorf("%s: no players table", filepath.Base(path))
+	}
+
+	hoursSurvived, err := findColumn(db, table, "hoursSurvived")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	} else if hoursSurvived == "" {
+		hoursSurvived = "NULL"
+	}
+
+	// The names come from the schema, not from the save
+	query := fmt.Sprintf("SELECT %s, name, isDead, %s FROM %s ORDER BY id", username, hoursSurvived, table)
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	defer rows.Close()
+
+	characters := []Character{}
+	for rows.Next() {
+		var username, name sql.NullString
+		var isDead sql.NullBool
+		var hours sql.NullFloat64
+		if err := rows.Scan(&username, &name, &isDead, &hours); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		characters = append(characters, Character{
+			Username:      strings.TrimSpace(username.String),
+			Name:          strings.TrimSpace(name.String),
+			IsDead:        isDead.Bool,
+			HoursSurvived: max(hours.Float64, 0),
+		})
+	}
+	return characters, rows.Err()
+}
+
+// CountVehicles returns the number of vehicles stored in vehicles.db
+func CountVehicles(path string) (int, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM vehicles").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return count, nil
+}
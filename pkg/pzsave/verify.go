@@ -0,0 +1,102 @@
+package pzsave
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RequiredFiles are the files every multiplayer save has after being saved once by the game
+var RequiredFiles = []string{"map_t.bin", "map_ver.bin", "players.db"}
+
+// Databases are the SQLite databases of a save
+var Databases = []string{"players.db", "vehicles.db"}
+
+// CheckDB runs the SQLite integrity check on a save database
+func CheckDB(path string) error {
+	db, err := openDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s failed the integrity check: %s", filepath.Base(path), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Verify checks if the save looks healthy: the required files exist and aren't empty, the databases pass
+// the SQLite integrity check and the binary files have valid headers.
+// Returns every problem found
+func Verify(savePath string) []error {
+	problems := []error{}
+
+	for _, filename := range RequiredFiles {
+		info, err := os.Stat(filepath.Join(savePath, filename))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("required file %s is missing", filename))
+		} else if info.Size() == 0 {
+			problems = append(problems, fmt.Errorf("required file %s is empty", filename))
+		}
+	}
+
+	for _, filename := range Databases {
+		path := filepath.Join(savePath, filename)
+		if _, err := os.Stat(path); err != nil {
+			continue // missing required databases were already reported
+		}
+		if err := CheckDB(path); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	headerChecks := []struct {
+		filename string
+		check    func(string) error
+	}{
+		{"map_t.bin", func(path string) error {
+			_, err := ReadWorldTime(path)
+			return err
+		}},
+		{"map_ver.bin", func(path string) error {
+			_, _, err := ReadMapVersion(path)
+			return err
+		}},
+		{"map_meta.bin", func(path string) error {
+			_, err := ReadMapBounds(path)
+			return err
+		}},
+	}
+	for _, hc := range headerChecks {
+		path := filepath.Join(savePath, hc.filename)
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			continue
+		}
+		if err := hc.check(path); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	return problems
+}
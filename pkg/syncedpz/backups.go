@@ -0,0 +1,290 @@
+package syncedpz
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/utils"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+const backupTimeFormat = "20060102-150405"
+
+// Backup is a compressed copy of the local save of a server (Saves/Multiplayer/<server>) and its player
+// save folders, taken before they are overwritten
+type Backup struct {
+	ID     string
+	Time   time.Time
+	Reason string
+	Size   int64
+	Path   string
+}
+
+// GetBackupsPath returns the path where the local backups of the server are stored
+func (ss SyncedServer) GetBackupsPath() string {
+	return filepath.Join(config.BackupsPath, ss.Name)
+}
+
+// getLocalBackupEntries returns the folders to back up, relative to Saves/Multiplayer
+func (ss SyncedServer) getLocalBackupEntries(includeSave bool) ([]string, error) {
+	pzSaveFilesPath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
+
+	entries := []string{}
+	if _, err := os.Stat(filepath.Join(pzSaveFilesPath, ssNameWithUnderScore)); includeSave && err == nil {
+		entries = append(entries, ssNameWithUnderScore)
+	}
+	playerFolders, err := ss.getLocalPlayerFolders()
+	if err != nil {
+		return nil, err
+	}
+	for _, playerFolder := range playerFolders {
+		entries = append(entries, playerFolder.Name())
+	}
+	return entries, nil
+}
+
+// BackupLocal creates a compressed backup of the local save of the server and its player save folders,
+// or just the player save folders if includeSave is false
+func (ss *SyncedServer) BackupLocal(reason string, includeSave bool) (*Backup, error) {
+	entries, err := ss.getLocalBackupEntries(includeSave)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil // nothing to lose
+	}
+
+	ss.logger().Infof("Backing up local save (%s)", reason)
+
+	utils.EnsureDir(ss.GetBackupsPath())
+	now := time.Now()
+	id := now.Format(backupTimeFormat) + "-" + reason
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(ss.GetBackupsPath(), id+".tar.gz")); os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s-%s-%d", now.Format(backupTimeFormat), reason, i)
+	}
+	path := filepath.Join(ss.GetBackupsPath(), id+".tar.gz")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	err = utils.WriteTar(gz, filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer"), entries)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	ss.logger().Infof("Local save backed up to %s", path)
+	return &Backup{ID: id, Time: now, Reason: reason, Size: info.Size(), Path: path}, nil
+}
+
+// backupLocalOrFail is BackupLocal for the copy routines, which must not overwrite anything without a
+// backup. Old backups are pruned after it
+func (ss *SyncedServer) backupLocalOrFail(reason string, includeSave bool) (*Backup, error) {
+	backup, err := ss.BackupLocal(reason, includeSave)
+	if err != nil {
+		return nil, fmt.Errorf("could not back up the local save, nothing was overwritten: %w", err)
+	}
+	ss.PruneBackups()
+	return backup, nil
+}
+
+// GetBackups returns the local backups of the server, the most recent first
+func (ss SyncedServer) GetBackups() []Backup {
+	backups := []Backup{}
+
+	entries, err := os.ReadDir(ss.GetBackupsPath())
+	if err != nil {
+		return backups
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".tar.gz")
+		if !ok || len(id) < len(backupTimeFormat) {
+			continue
+		}
+		backupTime, err := time.ParseInLocation(backupTimeFormat, id[:len(backupTimeFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		reason := strings.TrimPrefix(id[len(backupTimeFormat):], "-")
+		backups = append(backups, Backup{
+			ID:     id,
+			Time:   backupTime,
+			Reason: reason,
+			Size:   info.Size(),
+			Path:   filepath.Join(ss.GetBackupsPath(), entry.Name()),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID > backups[j].ID
+	})
+	return backups
+}
+
+// PruneBackups removes the backups exceeding the retention policy (count, age and total size), always
+// keeping the most recent one. Returns the removed backups
+func (ss *SyncedServer) PruneBackups() []Backup {
+	removed := []Backup{}
+
+	var totalSize int64
+	for i, backup := range ss.GetBackups() {
+		totalSize += backup.Size
+
+		tooMany := config.BackupMaxCount > 0 && i >= config.BackupMaxCount
+		tooOld := config.BackupMaxAgeDays > 0 && time.Since(backup.Time) > time.Duration(config.BackupMaxAgeDays)*24*time.Hour
+		tooBig := config.BackupMaxSizeMB > 0 && totalSize > int64(config.BackupMaxSizeMB)*1024*1024
+		if i == 0 || !(tooMany || tooOld || tooBig) {
+			continue
+		}
+
+		if err := os.Remove(backup.Path); err != nil {
+			ss.logger().Error(err)
+			continue
+		}
+		removed = append(removed, backup)
+		ss.logger().Infof("Backup %s pruned", backup.ID)
+	}
+	return removed
+}
+
+// RestoreBackup replaces the local save folders stored in the backup with their backed up version.
+// The current folders are backed up before
+func (ss *SyncedServer) RestoreBackup(id string) error {
+	var backup *Backup
+	for _, b := range ss.GetBackups() {
+		if b.ID == id {
+			backup = &b
+			break
+		}
+	}
+	if backup == nil {
+		return fmt.Errorf("backup %s not found", id)
+	}
+
+	ss.logger().Infof("Restoring backup %s", id)
+
+	file, err := os.Open(backup.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	names, err := utils.ListTar(gz)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ss.BackupLocal("before-restore", true); err != nil {
+		return err
+	}
+
+	pzSaveFilesPath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	for _, name := range names {
+		if err := os.RemoveAll(filepath.Join(pzSaveFilesPath, name)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return err
+	}
+	if err := gz.Reset(file); err != nil {
+		return err
+	}
+	if err := utils.ExtractTar(gz, pzSaveFilesPath); err != nil {
+		return err
+	}
+
+	ss.logger().Infof("Backup %s restored", id)
+	return nil
+}
+
+// getPlayerFoldersFingerprintKey returns the key of the fingerprint of the player save folders, used in
+// the database
+func (ss SyncedServer) getPlayerFoldersFingerprintKey() []byte {
+	return []byte("players_fingerprint_" + ss.Name)
+}
+
+// playerFoldersFingerprint returns a hash of the names, sizes and modification times of the files in the
+// local player save folders, used to avoid backing them up again when nothing changed
+func (ss SyncedServer) playerFoldersFingerprint() (string, error) {
+	playerFolders, err := ss.getLocalPlayerFolders()
+	if err != nil {
+		return "", err
+	}
+	pzSaveFilesPath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	hash := sha256.New()
+	for _, playerFolder := range playerFolders {
+		filepath.WalkDir(filepath.Join(pzSaveFilesPath, playerFolder.Name()), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				fmt.Fprintf(hash, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// playerFoldersChanged returns true if the player save folders changed since the fingerprint was saved
+func (ss SyncedServer) playerFoldersChanged() bool {
+	fingerprint := ""
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ss.getPlayerFoldersFingerprintKey())
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			fingerprint = string(val)
+			return nil
+		})
+	})
+	current, currentErr := ss.playerFoldersFingerprint()
+	return err != nil || currentErr != nil || fingerprint != current
+}
+
+// savePlayerFoldersFingerprint saves the fingerprint of the current player save folders
+func (ss SyncedServer) savePlayerFoldersFingerprint() error {
+	fingerprint, err := ss.playerFoldersFingerprint()
+	if err != nil {
+		return err
+	}
+	return config.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(ss.getPlayerFoldersFingerprintKey(), []byte(fingerprint))
+	})
+}
@@ -0,0 +1,305 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syncedpz/config"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// BranchInfo is a branch of the server, an alternate timeline of the world
+type BranchInfo struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	// Most recent snapshot of the branch, locally or in any repository of the server
+	Last CommitInfo `json:"last"`
+}
+
+// validateBranchName checks if the name can be used for a branch
+func validateBranchName(name string) error {
+	if name == "" || strings.HasPrefix(name, "-") || plumbing.NewBranchReferenceName(name).Validate() != nil {
+		return fmt.Errorf("invalid branch name: %q", name)
+	}
+	return nil
+}
+
+// branchCommit returns the most recent commit of the branch, locally or in any repository of the server
+// as they were last fetched. Nil if the branch doesn't exist
+func (ss *SyncedServer) branchCommit(name string) *object.Commit {
+	candidates := []plumbing.ReferenceName{plumbing.NewBranchReferenceName(name)}
+	for _, gitURL := range ss.GetRemoteURLs() {
+		candidates = append(candidates, plumbing.NewRemoteReferenceName(ss.remoteName(gitURL), name))
+	}
+
+	var best *object.Commit
+	for _, refName := range candidates {
+		ref, err := ss.repo.Reference(refName, true)
+		if err != nil {
+			continue
+		}
+		commit, err := ss.repo.CommitObject(ref.Hash())
+		if err != nil {
+			continue
+		}
+		if best == nil {
+			best = commit
+		} else if ahead, err := best.IsAncestor(commit); err == nil && ahead {
+			best = commit
+		}
+	}
+	return best
+}
+
+// ListBranches returns the branches of the server, from the last fetch of its repositories
+func (ss *SyncedServer) ListBranches() ([]BranchInfo, error) {
+	if err := ss.openRepo(); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	refs, err := ss.repo.References()
+	if err != nil {
+		return nil, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if ref.Name().IsBranch() {
+			names[ref.Name().Short()] = true
+		} else if ref.Name().IsRemote() {
+			for _, gitURL := range ss.GetRemoteURLs() {
+				if name, ok := strings.CutPrefix(ref.Name().String(), "refs/remotes/"+ss.remoteName(gitURL)+"/"); ok {
+					names[name] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := ss.currentBranch()
+	branches := []BranchInfo{}
+	for name := range names {
+		commit := ss.branchCommit(name)
+		if commit == nil {
+			continue
+		}
+		branches = append(branches, BranchInfo{
+			Name:    name,
+			Current: name == current.Short(),
+			Last:    newCommitInfo(commit),
+		})
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Name < branches[j].Name
+	})
+	return branches, nil
+}
+
+// CreateBranch creates a branch from the last synced snapshot of the current branch and pushes it.
+// It doesn't switch to it
+func (ss *SyncedServer) CreateBranch(ctx context.Context, name string) error {
+	if err := validateBranchName(name); err != nil {
+		return err
+	}
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+	if _, err := ss.fetchRemotes(ctx); err != nil && !errors.Is(err, ErrOffline) {
+		return err
+	}
+	if ss.branchCommit(name) != nil {
+		return fmt.Errorf("the branch %s already exists", name)
+	}
+
+	head, err := ss.repo.Head()
+	if err != nil {
+		return err
+	}
+	branch := plumbing.NewBranchReferenceName(name)
+	if err := ss.repo.Storer.SetReference(plumbing.NewHashReference(branch, head.Hash())); err != nil {
+		return err
+	}
+	ss.logger().Infof("Branch %s created from %s", name, head.Hash().String()[:8])
+
+	err = ss.pushRemotes(ctx, branchRefSpecs(branch))
+	if errors.Is(err, ErrOffline) {
+		ss.logger().Warn("No repository is reachable, the branch will be pushed when you sync on it")
+		return nil
+	} else if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
+
+// SwitchBranch syncs the current branch and then switches the server to the branch, replacing the local
+// save with its snapshot. The local save is backed up before
+func (ss *SyncedServer) SwitchBranch(ctx context.Context, name string) error {
+	if err := validateBranchName(name); err != nil {
+		return err
+	}
+	if current, ok := ss.currentBranch(); ok && current.Short() == name {
+		return fmt.Errorf("%s is already on the branch %s", ss.Name, name)
+	}
+
+	// Keeps the progress made on the current branch
+	if err := ss.Sync(ctx); err != nil && !errors.Is(err, ErrOffline) {
+		return err
+	}
+
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	commit := ss.branchCommit(name)
+	if commit == nil {
+		return fmt.Errorf("the branch %s doesn't exist, create it with syncedpz branch create", name)
+	}
+
+	ss.logger().Infof("Switching %s to the branch %s", ss.Name, name)
+
+	branch := plumbing.NewBranchReferenceName(name)
+	if _, err := ss.repo.Reference(branch, true); err != nil {
+		// Only in the repositories yet
+		if err := ss.repo.Storer.SetReference(plumbing.NewHashReference(branch, commit.Hash)); err != nil {
+			return err
+		}
+	}
+	w, err := ss.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: branch, Force: true}); err != nil {
+		return err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: commit.Hash, Mode: git.HardReset}); err != nil {
+		return err
+	}
+	if err := removeUnstagedFiles(w); err != nil {
+		return err
+	}
+
+	ss.Branch = name
+	if err := ss.Save(); err != nil {
+		return err
+	}
+
+	// The config files of the branch aren't merged with the ones of the previous branch
+	ss.baseCommit = plumbing.ZeroHash
+	if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+		return err
+	}
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return err
+	}
+	ss.saveLastSync()
+
+	ss.logger().Infof("%s switched to the branch %s", ss.Name, name)
+	return nil
+}
+
+// adoptSnapshot commits the files of the source commit on top of the onto one, replacing its snapshot
+// while keeping its history
+func (ss *SyncedServer) adoptSnapshot(onto, source *object.Commit, commitMsg string) error {
+	w, err := ss.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: onto.Hash, Mode: git.HardReset}); err != nil {
+		return err
+	}
+	paths, err := changedPaths(onto, source)
+	if err != nil {
+		return err
+	}
+	sourceTree, err := source.Tree()
+	if err != nil {
+		return err
+	}
+	if err := ss.checkoutPaths(sourceTree, paths); err != nil {
+		return err
+	}
+	return ss.CommitWithMessage(commitMsg)
+}
+
+// MergeBranch makes the snapshot of the branch the new snapshot of the current branch, after syncing it.
+// Saves can't be merged file by file, so the world of the branch replaces the current one
+func (ss *SyncedServer) MergeBranch(ctx context.Context, name string) error {
+	current, ok := ss.currentBranch()
+	if !ok {
+		return errors.New("the server isn't on a branch")
+	}
+	if current.Short() == name {
+		return fmt.Errorf("can't merge the branch %s into itself", name)
+	}
+
+	if err := ss.Sync(ctx); err != nil {
+		return err
+	}
+
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	source := ss.branchCommit(name)
+	if source == nil {
+		return fmt.Errorf("the branch %s doesn't exist", name)
+	}
+	head, err := ss.repo.Head()
+	if err != nil {
+		return err
+	}
+	onto, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	ss.logger().Infof("Merging the branch %s into %s", name, current.Short())
+
+	if merged, err := source.IsAncestor(onto); err == nil && merged {
+		ss.logger().Info("Already merged")
+		return nil
+	}
+	if ahead, err := onto.IsAncestor(source); err == nil && ahead {
+		// Fast-forward
+		w, err := ss.repo.Worktree()
+		if err != nil {
+			return err
+		}
+		if err := w.Reset(&git.ResetOptions{Commit: source.Hash, Mode: git.HardReset}); err != nil {
+			return err
+		}
+	} else {
+		commitMsg := fmt.Sprintf("SyncedPZ: %s merged the branch %s into %s", config.PZ_SteamID, name, current.Short())
+		if err := ss.adoptSnapshot(onto, source, commitMsg); err != nil {
+			return err
+		}
+	}
+
+	if err := ss.TryPush(ctx); err != nil {
+		return err
+	}
+	if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+		return err
+	}
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return err
+	}
+	ss.saveLastSync()
+
+	ss.logger().Infof("Branch %s merged into %s", name, current.Short())
+	return nil
+}
@@ -0,0 +1,244 @@
+package syncedpz
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/pzconfig"
+
+	"github.com/dgraph-io/badger"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ConfigConflict is a setting of a server config file changed both locally and by another player since
+// the last sync
+type ConfigConflict struct {
+	File string
+	pzconfig.Conflict
+}
+
+// readFileAtCommit returns the content of a file of the repository at the given commit
+func (ss *SyncedServer) readFileAtCommit(hash plumbing.Hash, path string) ([]byte, error) {
+	commit, err := ss.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(path)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := file.Contents()
+	return []byte(contents), err
+}
+
+// mergeConfigFile does a three-way merge of a config file between the last synced version (base), the local
+// version (ours) and the synced one that was just pulled (theirs), writing the result to the local file.
+// On conflicts the synced value wins, like it does for the save files, and the conflict is stored so it
+// can be resolved later with ResolveConflict.
+// Returns false if the file can't be merged and must be copied instead
+func (ss *SyncedServer) mergeConfigFile(syncedFilename, localFilename string) (bool, error) {
+	if !pzconfig.IsSupported(syncedFilename) || ss.baseCommit.IsZero() || ss.repo == nil {
+		return false, nil
+	}
+
+	filename := filepath.Base(syncedFilename)
+	baseData, err := ss.readFileAtCommit(ss.baseCommit, "config/"+filename)
+	if err != nil {
+		return false, nil // new file
+	}
+	oursData, err := os.ReadFile(localFilename)
+	if err != nil {
+		return false, nil
+	}
+	theirsData, err := os.ReadFile(syncedFilename)
+	if err != nil {
+		return false, err
+	}
+
+	merged, conflicts, ok, err := ss.mergeConfigData(filename, baseData, oursData, theirsData)
+	if !ok || err != nil {
+		return false, err
+	}
+	if err := ss.addConflicts(filename, conflicts); err != nil {
+		return false, err
+	}
+
+	if err := os.WriteFile(localFilename, merged, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// mergeConfigData does a three-way merge of the versions of a config file. On conflicts the synced value
+// (theirs) wins, the conflicts are returned so they can be stored.
+// Returns false if the versions can't be parsed
+func (ss *SyncedServer) mergeConfigData(filename string, baseData, oursData, theirsData []byte) ([]byte, []pzconfig.Conflict, bool, error) {
+	var ours, theirs *pzconfig.File
+	base, err := pzconfig.Parse(filename, baseData)
+	if err == nil {
+		ours, err = pzconfig.Parse(filename, oursData)
+	}
+	if err == nil {
+		theirs, err = pzconfig.Parse(filename, theirsData)
+	}
+	if err != nil {
+		ss.logger().Warnf("Could not merge config file %s: %s", filename, err)
+		return nil, nil, false, nil
+	}
+
+	ss.logger().Infof("Merging config file %s", filename)
+
+	merged, conflicts := pzconfig.Merge(base, ours, theirs)
+	for _, c := range conflicts {
+		ss.logger().Warnf("Conflict in %s at %s, using the synced value", filename, c.Key)
+		if c.InTheirs {
+			err = merged.Set(c.Key, c.Theirs)
+		} else {
+			err = merged.Delete(c.Key)
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("could not use the synced value of %s in %s: %w", c.Key, filename, err)
+		}
+	}
+	return merged.Bytes(), conflicts, true, nil
+}
+
+// mergeCommitsConfig merges a config file of the repository changed by both commits since their merge
+// base, the remote one winning the conflicts.
+// Returns false if the path isn't a config file that can be merged
+func (ss *SyncedServer) mergeCommitsConfig(path string, base, local, remote *object.Commit) ([]byte, []pzconfig.Conflict, bool, error) {
+	if !strings.HasPrefix(path, "config/") || !pzconfig.IsSupported(path) {
+		return nil, nil, false, nil
+	}
+
+	versions := [][]byte{}
+	for _, commit := range []*object.Commit{base, local, remote} {
+		data, err := ss.readFileAtCommit(commit.Hash, path)
+		if err != nil {
+			// Added or removed by one of them
+			return nil, nil, false, nil
+		}
+		versions = append(versions, data)
+	}
+	return ss.mergeConfigData(filepath.Base(path), versions[0], versions[1], versions[2])
+}
+
+// getConflictsKey returns the key of the server config conflicts used in the database
+func (ss SyncedServer) getConflictsKey() []byte {
+	return []byte("conflicts_" + ss.Name)
+}
+
+// GetConflicts returns the unresolved config conflicts of the server
+func (ss SyncedServer) GetConflicts() []ConfigConflict {
+	conflicts := []ConfigConflict{}
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ss.getConflictsKey())
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			return gob.NewDecoder(bytes.NewReader(v)).Decode(&conflicts)
+		})
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		ss.logger().Error(err)
+	}
+	return conflicts
+}
+
+func (ss *SyncedServer) saveConflicts(conflicts []ConfigConflict) error {
+	return config.DB.Update(func(txn *badger.Txn) error {
+		if len(conflicts) == 0 {
+			return txn.Delete(ss.getConflictsKey())
+		}
+
+		var buff bytes.Buffer
+		if err := gob.NewEncoder(&buff).Encode(conflicts); err != nil {
+			return err
+		}
+		return txn.Set(ss.getConflictsKey(), buff.Bytes())
+	})
+}
+
+// addConflicts stores the new conflicts of a config file, replacing older ones of the same keys
+func (ss *SyncedServer) addConflicts(filename string, conflicts []pzconfig.Conflict) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	stored := []ConfigConflict{}
+	for _, c := range ss.GetConflicts() {
+		replaced := false
+		for _, newC := range conflicts {
+			replaced = replaced || (c.File == filename && c.Key == newC.Key)
+		}
+		if !replaced {
+			stored = append(stored, c)
+		}
+	}
+	for _, c := range conflicts {
+		stored = append(stored, ConfigConflict{File: filename, Conflict: c})
+	}
+	if err := ss.saveConflicts(stored); err != nil {
+		return err
+	}
+
+	keys := []string{}
+	for _, c := range conflicts {
+		keys = append(keys, c.Key)
+	}
+	notify(WebhookEvent{
+		Event:   EventConflictDetected,
+		Server:  ss.Name,
+		Message: fmt.Sprintf(config.GTM("%s and the server changed the same settings of %s in %s: %s"), config.PZ_SteamID, ss.Name, filename, strings.Join(keys, ", ")),
+	})
+	return nil
+}
+
+// ResolveConflict resolves a config conflict, keeping your local value or the synced one.
+// The synced value is already in the local file, so keeping yours writes it back, and it's pushed to
+// the other players on the next sync
+func (ss *SyncedServer) ResolveConflict(conflict ConfigConflict, keepMine bool) error {
+	if keepMine {
+		localFilename := filepath.Join(config.PZ_DataPath, "Server", conflict.File)
+		data, err := os.ReadFile(localFilename)
+		if err != nil {
+			return err
+		}
+
+		file, err := pzconfig.Parse(localFilename, data)
+		if err != nil {
+			return err
+		}
+		if conflict.InOurs {
+			err = file.Set(conflict.Key, conflict.Ours)
+		} else {
+			err = file.Delete(conflict.Key)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(localFilename, file.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	remaining := []ConfigConflict{}
+	for _, c := range ss.GetConflicts() {
+		if c.File != conflict.File || c.Key != conflict.Key {
+			remaining = append(remaining, c)
+		}
+	}
+	if err := ss.saveConflicts(remaining); err != nil {
+		return err
+	}
+
+	ss.logger().Infof("Conflict in %s at %s resolved", conflict.File, conflict.Key)
+	return nil
+}
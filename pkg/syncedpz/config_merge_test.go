@@ -0,0 +1,179 @@
+package syncedpz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syncedpz/config"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// testClient is a player syncing the server, with its own data folder and Project Zomboid folder
+type testClient struct {
+	dir     string
+	steamID string
+}
+
+// use makes the client the current one, its data folder is relative to the working directory
+func (c testClient) use(t *testing.T) {
+	t.Helper()
+	config.CloseDB()
+	if err := os.Chdir(c.dir); err != nil {
+		t.Fatal(err)
+	}
+	config.PZ_DataPath = filepath.Join(c.dir, "Zomboid")
+	config.PZ_SteamID = c.steamID
+	if err := config.OpenDB(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c testClient) writeConfig(t *testing.T, name, data string) {
+	t.Helper()
+	path := filepath.Join(c.dir, "Zomboid", "Server", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c testClient) readConfig(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(c.dir, "Zomboid", "Server", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// newTestClients returns two clients of a new empty repository
+func newTestClients(t *testing.T) (string, testClient, testClient) {
+	home := t.TempDir()
+	gitconfig := "[user]\n\tname = test\n\temail = test@example.com\n"
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+
+	remote := t.TempDir()
+	if _, err := git.PlainInit(remote, true); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipVerify := config.SkipVerify
+	config.SkipVerify = true
+	t.Cleanup(func() {
+		config.CloseDB()
+		config.SkipVerify = skipVerify
+		os.Chdir(wd)
+	})
+
+	a := testClient{dir: t.TempDir(), steamID: "76561198000000001"}
+	b := testClient{dir: t.TempDir(), steamID: "76561198000000002"}
+	return remote, a, b
+}
+
+// syncTestServer publishes a server with the config file from A and clones it in B, both synced
+func syncTestServer(t *testing.T, remote string, a, b testClient, ini string) (*SyncedServer, *SyncedServer) {
+	t.Helper()
+	ctx := context.Background()
+
+	a.use(t)
+	a.writeConfig(t, "servertest.ini", ini)
+	save := filepath.Join(a.dir, "Zomboid", "Saves", "Multiplayer", "servertest", "map_0_0.bin")
+	if err := os.MkdirAll(filepath.Dir(save), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(save, []byte("map"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ssA := NewSyncedServer("servertest", remote)
+	if err := ssA.InitGit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssA.Publish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssA.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b.use(t)
+	ssB, err := CloneServer(ctx, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ssB.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return ssA, ssB
+}
+
+func TestSyncMergesConfigSettings(t *testing.T) {
+	ctx := context.Background()
+	remote, a, b := newTestClients(t)
+	ssA, ssB := syncTestServer(t, remote, a, b, "PVP=true\nPauseEmpty=true\nMaxPlayers=8\n")
+
+	// Both change a different setting of the same file, A syncs first
+	a.use(t)
+	a.writeConfig(t, "servertest.ini", "PVP=false\nPauseEmpty=true\nMaxPlayers=8\n")
+	if err := ssA.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b.use(t)
+	b.writeConfig(t, "servertest.ini", "PVP=true\nPauseEmpty=true\nMaxPlayers=16\n")
+	if err := ssB.Sync(ctx); err != nil {
+		t.Fatalf("sync with a change to another setting: %s", err)
+	}
+	if conflicts := ssB.GetConflicts(); len(conflicts) != 0 {
+		t.Errorf("conflicts = %v, want none", conflicts)
+	}
+	want := "PVP=false\nPauseEmpty=true\nMaxPlayers=16\n"
+	if got := b.readConfig(t, "servertest.ini"); got != want {
+		t.Errorf("B config = %q, want %q", got, want)
+	}
+
+	a.use(t)
+	if err := ssA.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.readConfig(t, "servertest.ini"); got != want {
+		t.Errorf("A config = %q, want %q", got, want)
+	}
+}
+
+func TestSyncMergeConflictKeepsTheirs(t *testing.T) {
+	ctx := context.Background()
+	remote, a, b := newTestClients(t)
+	ssA, ssB := syncTestServer(t, remote, a, b, "PVP=true\nMaxPlayers=8\n")
+
+	a.use(t)
+	a.writeConfig(t, "servertest.ini", "PVP=true\nMaxPlayers=10\n")
+	if err := ssA.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same setting, the synced value wins and the conflict is kept to be resolved
+	b.use(t)
+	b.writeConfig(t, "servertest.ini", "PVP=false\nMaxPlayers=16\n")
+	if err := ssB.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := "PVP=false\nMaxPlayers=10\n"
+	if got := b.readConfig(t, "servertest.ini"); got != want {
+		t.Errorf("B config = %q, want %q", got, want)
+	}
+	conflicts := ssB.GetConflicts()
+	if len(conflicts) != 1 || conflicts[0].File != "servertest.ini" || conflicts[0].Key != "MaxPlayers" {
+		t.Fatalf("conflicts = %v, want MaxPlayers of servertest.ini", conflicts)
+	}
+}
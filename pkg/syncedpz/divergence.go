@@ -0,0 +1,386 @@
+package syncedpz
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syncedpz/config"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// LastSync is the snapshot the local server had at the end of the last successful sync, the base to
+// tell which side changed since then
+type LastSync struct {
+	Commit string    `json:"commit"`
+	Time   time.Time `json:"time"`
+}
+
+// getLastSyncKey returns the key of the last successful sync, used in the database
+func (ss SyncedServer) getLastSyncKey() []byte {
+	return []byte("last_sync_" + ss.Name)
+}
+
+// GetLastSync returns the last successful sync of the server, nil if it was never synced
+func (ss SyncedServer) GetLastSync() *LastSync {
+	var lastSync *LastSync
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ss.getLastSyncKey())
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			lastSync = &LastSync{}
+			return gob.NewDecoder(bytes.NewReader(val)).Decode(lastSync)
+		})
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		ss.logger().Error(err)
+	}
+	return lastSync
+}
+
+// saveLastSync records the current snapshot of the server repository as the last successful sync
+func (ss *SyncedServer) saveLastSync() {
+	head, err := ss.repo.Head()
+	if err != nil {
+		return // nothing synced yet
+	}
+
+	var buff bytes.Buffer
+	err = gob.NewEncoder(&buff).Encode(LastSync{Commit: head.Hash().String(), Time: time.Now()})
+	if err == nil {
+		err = config.DB.Update(func(txn *badger.Txn) error {
+			return txn.Set(ss.getLastSyncKey(), buff.Bytes())
+		})
+	}
+	if err != nil {
+		ss.logger().Error(err)
+	}
+}
+
+// DivergenceError is returned by Sync when the local server and its repository both changed since the
+// last sync. Nothing is overwritten, the local snapshot is committed and queued until the player chooses
+// how to resolve it with ResolveDivergence
+type DivergenceError struct {
+	Server string `json:"server"`
+	// Snapshot of the last successful sync, nil if unknown
+	Base   *CommitInfo `json:"base"`
+	Mine   CommitInfo  `json:"mine"`
+	Theirs CommitInfo  `json:"theirs"`
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("%s changed locally and in its repository since the last sync", e.Server)
+}
+
+// Resolution is how a divergence is resolved
+type Resolution int
+
+const (
+	// KeepMine commits the local snapshot on top of the one in the repository, replacing it
+	KeepMine Resolution = iota + 1
+	// KeepTheirs replaces the local snapshot with the one in the repository. The local one is kept in a
+	// reference and in the local backups
+	KeepTheirs
+	// Fork pushes the local snapshot to a new branch and replaces it with the one in the repository
+	Fork
+)
+
+// ParseResolution parses "mine", "theirs" or "fork"
+func ParseResolution(s string) (Resolution, error) {
+	switch s {
+	case "mine":
+		return KeepMine, nil
+	case "theirs":
+		return KeepTheirs, nil
+	case "fork":
+		return Fork, nil
+	}
+	return 0, fmt.Errorf("invalid resolution %q, use mine, theirs or fork", s)
+}
+
+// divergedRemote returns the commit of a repository of the server that isn't in the local commit, as
+// they were last fetched. Nil if every repository is in it
+func (ss *SyncedServer) divergedRemote(local *object.Commit) *object.Commit {
+	for _, remote := range ss.remoteCommits() {
+		if inLocal, err := remote.IsAncestor(local); err == nil && !inLocal {
+			return remote
+		}
+	}
+	return nil
+}
+
+// newDivergenceError describes the divergence between the local and the remote commits
+func (ss *SyncedServer) newDivergenceError(local, remote *object.Commit) *DivergenceError {
+	divergence := &DivergenceError{
+		Server: ss.Name,
+		Mine:   newCommitInfo(local),
+		Theirs: newCommitInfo(remote),
+	}
+	if lastSync := ss.GetLastSync(); lastSync != nil {
+		if base, err := ss.repo.CommitObject(plumbing.NewHash(lastSync.Commit)); err == nil {
+			info := newCommitInfo(base)
+			divergence.Base = &info
+		}
+	}
+	return divergence
+}
+
+// hasLocalChanges returns true if the files of the server repository differ from its last commit
+func (ss *SyncedServer) hasLocalChanges() (bool, error) {
+	w, err := ss.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+	return !status.IsClean(), nil
+}
+
+// staleChanges compares the files of the server repository that differ from its last commit with the
+// last sync. When a pull moved the repository since then but couldn't be copied to the local server, the
+// local save is still based on the last sync: the files it didn't change aren't local changes, they're
+// missing the pull. Returns those stale files, and the ones changed on both sides since the last sync
+func (ss *SyncedServer) staleChanges() (stale, conflicting map[string]bool, err error) {
+	lastSync := ss.GetLastSync()
+	head, err := ss.repo.Head()
+	if err != nil || lastSync == nil || lastSync.Commit == head.Hash().String() {
+		return nil, nil, nil
+	}
+	base, err := ss.repo.CommitObject(plumbing.NewHash(lastSync.Commit))
+	if err != nil {
+		return nil, nil, nil // the last sync isn't in the repository anymore
+	}
+	current, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	if pulled, err := base.IsAncestor(current); err != nil || !pulled {
+		// The repository was restored or switched to another branch, not pulled
+		return nil, nil, err
+	}
+
+	baseTree, err := base.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	currentTree, err := current.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := ss.repo.Worktree()
+	if err != nil {
+		return nil, nil, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stale = make(map[string]bool)
+	conflicting = make(map[string]bool)
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified {
+			continue
+		}
+		baseHash, err := treeFileHash(baseTree, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		localHash, err := localFileHash(filepath.Join(ss.GetServerPath(), filepath.FromSlash(path)))
+		if err != nil {
+			return nil, nil, err
+		}
+		if localHash == baseHash {
+			stale[path] = true
+			continue
+		}
+		currentHash, err := treeFileHash(currentTree, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if currentHash != baseHash {
+			conflicting[path] = true
+		}
+	}
+	return stale, conflicting, nil
+}
+
+// reapplyPull brings the stale files of the local save, see staleChanges, up to date in the server
+// repository. Returns true if there were any, then the repository has to be copied to the local server
+// after committing. When the local save changed files of the missed pull a DivergenceError is returned,
+// with the local changes committed on top of the last sync
+func (ss *SyncedServer) reapplyPull() (bool, error) {
+	stale, conflicting, err := ss.staleChanges()
+	if err != nil || len(stale) == 0 && len(conflicting) == 0 {
+		return false, err
+	}
+
+	head, err := ss.repo.Head()
+	if err != nil {
+		return false, err
+	}
+	current, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+	currentTree, err := current.Tree()
+	if err != nil {
+		return false, err
+	}
+	lastSync := plumbing.NewHash(ss.GetLastSync().Commit)
+	ss.baseCommit = lastSync
+
+	if len(stale) > 0 {
+		ss.logger().Warnf("The local save missed %d files pulled after the last sync, copying them", len(stale))
+		if err := ss.checkoutPaths(currentTree, stale); err != nil {
+			return false, err
+		}
+	}
+	if len(conflicting) == 0 {
+		return len(stale) > 0, nil
+	}
+
+	ss.logger().Warn("The local save and a pull it missed changed the same files since the last sync")
+	w, err := ss.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: lastSync, Mode: git.MixedReset}); err != nil {
+		return false, err
+	}
+	if err := ss.commitVerified(); err != nil {
+		return false, err
+	}
+	head, err = ss.repo.Head()
+	if err != nil {
+		return false, err
+	}
+	local, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+	remote := ss.divergedRemote(local)
+	if remote == nil {
+		remote = current
+	}
+	return false, ss.newDivergenceError(local, remote)
+}
+
+// treeFileHash returns the hash of the file at the path of the tree, zero if it isn't in it
+func treeFileHash(tree *object.Tree, path string) (plumbing.Hash, error) {
+	file, err := tree.File(path)
+	if err == object.ErrFileNotFound {
+		return plumbing.ZeroHash, nil
+	} else if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return file.Hash, nil
+}
+
+// localFileHash returns the git hash of the file at the path, zero if it doesn't exist
+func localFileHash(path string) (plumbing.Hash, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return plumbing.ZeroHash, nil
+	} else if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return plumbing.ComputeHash(plumbing.BlobObject, content), nil
+}
+
+// ResolveDivergence resolves the divergence between the local snapshot and the one in the repositories
+// of the server, found by Sync
+func (ss *SyncedServer) ResolveDivergence(ctx context.Context, resolution Resolution) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+
+	if _, err := ss.fetchRemotes(ctx); err != nil {
+		return err
+	}
+	head, err := ss.repo.Head()
+	if err != nil {
+		return err
+	}
+	local, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	remote := ss.divergedRemote(local)
+	if remote == nil {
+		ss.logger().Info("Nothing to resolve, the local snapshot has every change of the server")
+		return ss.TryPush(ctx)
+	}
+
+	if lastSync := ss.GetLastSync(); lastSync != nil {
+		ss.baseCommit = plumbing.NewHash(lastSync.Commit)
+	}
+
+	switch resolution {
+	case KeepMine:
+		ss.logger().Info("Keeping the local snapshot over the one of the server")
+
+		commitMsg := fmt.Sprintf("SyncedPZ: %s kept their own snapshot over %s", config.PZ_SteamID, remote.Hash.String()[:8])
+		if err := ss.adoptSnapshot(remote, local, commitMsg); err != nil {
+			return err
+		}
+		if err := ss.TryPush(ctx); err != nil {
+			return err
+		}
+	case KeepTheirs, Fork:
+		var fork plumbing.ReferenceName
+		if resolution == Fork {
+			fork = plumbing.NewBranchReferenceName(fmt.Sprintf("fork-%s-%s", config.PZ_SteamID, time.Now().Format("20060102-150405")))
+			if err := ss.repo.Storer.SetReference(plumbing.NewHashReference(fork, local.Hash)); err != nil {
+				return err
+			}
+			ss.logger().Infof("Local snapshot forked to the branch %s, switch to it with syncedpz branch switch", fork.Short())
+		} else {
+			ref := ss.keepQueuedSnapshots(local.Hash)
+			ss.logger().Infof("Keeping the snapshot of the server, the local one was kept in %s and in the local backups", ref)
+		}
+
+		w, err := ss.repo.Worktree()
+		if err != nil {
+			return err
+		}
+		if err := w.Reset(&git.ResetOptions{Commit: remote.Hash, Mode: git.HardReset}); err != nil {
+			return err
+		}
+		if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+			return err
+		}
+		if resolution == Fork {
+			// Publishes the new branch
+			if err := ss.pushRemotes(ctx, branchRefSpecs(fork)); err != nil && err != git.NoErrAlreadyUpToDate {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid resolution %d", resolution)
+	}
+
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return err
+	}
+	ss.saveLastSync()
+	ss.logger().Info("Divergence resolved")
+	return nil
+}
@@ -0,0 +1,392 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/utils"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Diagnosis is the result of a check of syncedpz doctor
+type Diagnosis struct {
+	Check string
+	// Empty when the check passed
+	Problem string
+	// What the player can do to fix the problem
+	Fix string
+	// The problem doesn't stop SyncedPZ from working
+	Warning bool
+}
+
+// OK returns true if the check passed
+func (d Diagnosis) OK() bool {
+	return d.Problem == ""
+}
+
+// steamIDPattern matches the 64 bits Steam IDs, the ones used in the names of the player save folders
+var steamIDPattern = regexp.MustCompile(`^7656119\d{10}$`)
+
+// minFreeDiskSpace is the free space below which the syncs may fail, even for small worlds
+const minFreeDiskSpace = 1 << 30
+
+// remoteCheckTimeout is how long a repository has to answer, shorter than the network timeout of the
+// syncs so the diagnosis doesn't hang on a repository that isn't reachable
+const remoteCheckTimeout = 30 * time.Second
+
+// Diagnose checks the installation, the config and every synced server, returning a diagnosis for each
+// check. The config is loaded while checking it
+func Diagnose(ctx context.Context) []Diagnosis {
+	diagnoses := []Diagnosis{diagnoseGit()}
+
+	// The rest of the config is in the database, only the disk space can be checked without it
+	dbCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	err := config.OpenDB(dbCtx)
+	cancel()
+	if err != nil {
+		return append(diagnoses, diagnoseOpenDB(err), diagnoseDiskSpace(nil))
+	}
+	defer config.CloseDB()
+
+	diagnoses = append(diagnoses, diagnoseDB())
+	diagnoses = append(diagnoses, diagnosePaths()...)
+	diagnoses = append(diagnoses, diagnoseSteamID(), diagnoseCredentials())
+
+	servers := GetSyncedServers()
+	for _, ss := range servers {
+		if ctx.Err() != nil {
+			return diagnoses
+		}
+		diagnoses = append(diagnoses, ss.diagnoseRemotes(ctx)...)
+		diagnoses = append(diagnoses, ss.diagnoseRepository(), ss.diagnoseMods())
+	}
+	return append(diagnoses, diagnoseDiskSpace(servers))
+}
+
+func diagnoseGit() Diagnosis {
+	d := Diagnosis{Check: config.GTM("Git")}
+	if err := config.CheckExistenceOfGit(); err != nil {
+		d.Problem = err.Error()
+		d.Fix = config.GTM("Install git from https://git-scm.com/downloads and open a new terminal")
+	}
+	return d
+}
+
+// diagnoseOpenDB returns the failed check of the database that couldn't be opened
+func diagnoseOpenDB(err error) Diagnosis {
+	d := Diagnosis{Check: config.GTM("Database"), Problem: err.Error()}
+	if errors.Is(err, config.ErrDBInUse) {
+		d.Fix = config.GTM("Close the other SyncedPZ windows, including syncedpz agent, serve and ui, and run syncedpz doctor again")
+	} else {
+		d.Fix = fmt.Sprintf(config.GTM("Back up %s and report the error with the log files of %s"), config.DataPath, config.LogsPath)
+	}
+	return d
+}
+
+// diagnoseDB writes, reads and deletes a key to check the database
+func diagnoseDB() Diagnosis {
+	d := Diagnosis{Check: config.GTM("Database")}
+	key, value := []byte("doctor_check"), []byte(time.Now().String())
+	err := config.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+	if err == nil {
+		err = config.DB.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			return item.Value(func(val []byte) error {
+				if string(val) != string(value) {
+					return errors.New("the value read differs from the one written")
+				}
+				return nil
+			})
+		})
+	}
+	if err == nil {
+		err = config.DB.Update(func(txn *badger.Txn) error {
+			return txn.Delete(key)
+		})
+	}
+
+	if err != nil {
+		d.Problem = err.Error()
+		d.Fix = config.GTM("Close every other SyncedPZ window and run syncedpz doctor again. If it keeps failing, back up the data folder and report it with syncedpz log -bundle logs.zip")
+	}
+	return d
+}
+
+func diagnosePaths() []Diagnosis {
+	err := LoadPzDirs()
+	if err == badger.ErrKeyNotFound {
+		return []Diagnosis{{
+			Check:   config.GTM("Project Zomboid paths"),
+			Problem: config.GTM("not configured"),
+			Fix:     config.GTM("Run syncedpz config setup"),
+		}}
+	}
+
+	bat := Diagnosis{Check: config.GTM("Project Zomboid executable")}
+	batFix := config.GTM("Find ProjectZomboid64.bat in the game folder (Steam > Project Zomboid > Manage > Browse local files) and set it with syncedpz config setup")
+	if info, err := os.Stat(config.PZ_BatPath); err != nil {
+		bat.Problem, bat.Fix = err.Error(), batFix
+	} else if info.IsDir() {
+		bat.Problem, bat.Fix = fmt.Sprintf(config.GTM("%s is a folder, not the executable"), config.PZ_BatPath), batFix
+	}
+
+	data := Diagnosis{Check: config.GTM("Project Zomboid data folder")}
+	dataFix := config.GTM("It's the Zomboid folder of your user, like C:\\Users\\NAME\\Zomboid, set it with syncedpz config setup")
+	if info, err := os.Stat(config.PZ_DataPath); err != nil {
+		data.Problem, data.Fix = err.Error(), dataFix
+	} else if !info.IsDir() {
+		data.Problem, data.Fix = fmt.Sprintf(config.GTM("%s is not a folder"), config.PZ_DataPath), dataFix
+	} else if _, err := os.Stat(filepath.Join(config.PZ_DataPath, "Saves")); err != nil {
+		// Missing until the game is played once
+		data.Problem, data.Fix, data.Warning = fmt.Sprintf(config.GTM("%s has no Saves folder, it may not be the Zomboid folder"), config.PZ_DataPath), dataFix, true
+	}
+
+	diagnoses := []Diagnosis{bat, data}
+	if err != nil && bat.OK() && data.OK() {
+		// Failed reading the database
+		diagnoses = append(diagnoses, Diagnosis{Check: config.GTM("Project Zomboid paths"), Problem: err.Error(), Fix: config.GTM("Run syncedpz config setup")})
+	}
+	return diagnoses
+}
+
+func diagnoseSteamID() Diagnosis {
+	d := Diagnosis{Check: config.GTM("Steam ID")}
+	fix := config.GTM("Your Steam ID has 17 digits and starts with 7656119, find it at https://steamid.io and set it with syncedpz config setup")
+	if err := LoadSteamID(); err == badger.ErrKeyNotFound {
+		d.Problem, d.Fix = config.GTM("not configured"), fix
+	} else if err != nil {
+		d.Problem, d.Fix = err.Error(), fix
+	} else if !steamIDPattern.MatchString(config.PZ_SteamID) {
+		d.Problem, d.Fix = fmt.Sprintf(config.GTM("%s is not a Steam ID"), config.PZ_SteamID), fix
+	}
+	return d
+}
+
+func diagnoseCredentials() Diagnosis {
+	d := Diagnosis{Check: config.GTM("Git credentials")}
+	if err := LoadGitAuth(); err == badger.ErrKeyNotFound {
+		d.Problem = config.GTM("not configured")
+		d.Fix = config.GTM("Run syncedpz config setup with your git username and a token that can push to the repositories")
+	} else if err != nil {
+		d.Problem = err.Error()
+		d.Fix = config.GTM("Run syncedpz config setup with your git username and a token that can push to the repositories")
+	}
+	return d
+}
+
+// diagnoseRemotes lists the references of every repository of the server, checking they're reachable and
+// the credentials are accepted
+func (ss SyncedServer) diagnoseRemotes(ctx context.Context) []Diagnosis {
+	diagnoses := []Diagnosis{}
+	for _, gitURL := range ss.GetRemoteURLs() {
+		d := Diagnosis{Check: fmt.Sprintf(config.GTM("Repository %s of %s"), gitURL, ss.Name)}
+
+		remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{Name: "doctor", URLs: []string{gitURL}})
+		listCtx, cancel := context.WithTimeout(ctx, remoteCheckTimeout)
+		_, err := remote.ListContext(listCtx, &git.ListOptions{Auth: config.GitAuth})
+		cancel()
+
+		switch {
+		case err == nil, errors.Is(err, transport.ErrEmptyRemoteRepository):
+		case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrInvalidAuthMethod):
+			d.Problem = err.Error()
+			d.Fix = config.GTM("The repository refused your git credentials, set a valid username and token with syncedpz config setup")
+		case errors.Is(err, transport.ErrAuthorizationFailed):
+			d.Problem = err.Error()
+			d.Fix = config.GTM("Your git user can't access the repository, ask its owner to give you access")
+		case errors.Is(err, transport.ErrRepositoryNotFound):
+			d.Problem = err.Error()
+			d.Fix = fmt.Sprintf(config.GTM("Check the URL, if the repository moved change it with syncedpz remote set-url -server \"%s\" URL"), ss.Name)
+		default:
+			d.Problem = err.Error()
+			d.Fix = config.GTM("The repository can't be reached, check your internet connection and if its host is up")
+			// The other repositories keep the server synced meanwhile
+			d.Warning = len(ss.Mirrors) > 0
+		}
+		diagnoses = append(diagnoses, d)
+	}
+	return diagnoses
+}
+
+// diagnoseRepository checks the integrity of the server repository, like git fsck
+func (ss SyncedServer) diagnoseRepository() Diagnosis {
+	d := Diagnosis{Check: fmt.Sprintf(config.GTM("Repository integrity of %s"), ss.Name)}
+	repo, err := git.PlainOpen(ss.GetServerPath())
+	if err == nil {
+		err = checkRepository(repo)
+	}
+	if err != nil {
+		d.Problem = err.Error()
+		d.Fix = fmt.Sprintf(config.GTM("Back up your world with syncedpz export -server \"%s\" -o world.tar.zst, then get a fresh copy with syncedpz delete -force and syncedpz clone"), ss.Name)
+	}
+	return d
+}
+
+// checkRepository checks that every object matches its hash and the last snapshot and its history have
+// every object they need
+func checkRepository(repo *git.Repository) error {
+	corrupted := 0
+	checkObject := func(hash plumbing.Hash) {
+		obj, err := repo.Storer.EncodedObject(plumbing.AnyObject, hash)
+		if err != nil {
+			corrupted++
+			return
+		}
+		reader, err := obj.Reader()
+		if err != nil {
+			corrupted++
+			return
+		}
+		defer reader.Close()
+
+		hasher := plumbing.NewHasher(obj.Type(), obj.Size())
+		if _, err := io.Copy(hasher, reader); err != nil || hasher.Sum() != hash {
+			corrupted++
+		}
+	}
+
+	// The hash of the loose objects is computed from their content when they're read, so they're checked
+	// against their file names
+	checked := make(map[plumbing.Hash]bool)
+	if loose, ok := repo.Storer.(interface {
+		ForEachObjectHash(func(plumbing.Hash) error) error
+	}); ok {
+		err := loose.ForEachObjectHash(func(hash plumbing.Hash) error {
+			checked[hash] = true
+			checkObject(hash)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	objects, err := repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+	err = objects.ForEach(func(obj plumbing.EncodedObject) error {
+		if !checked[obj.Hash()] {
+			checked[obj.Hash()] = true
+			checkObject(obj.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if corrupted > 0 {
+		return fmt.Errorf("%d corrupted objects", corrupted)
+	}
+
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil // nothing committed yet
+	} else if err != nil {
+		return err
+	}
+	commits, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return err
+	}
+	if err := commits.ForEach(func(*object.Commit) error { return nil }); err != nil {
+		return fmt.Errorf("broken history: %w", err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	if err := tree.Files().ForEach(func(*object.File) error { return nil }); err != nil {
+		return fmt.Errorf("incomplete last snapshot: %w", err)
+	}
+	return nil
+}
+
+func (ss SyncedServer) diagnoseMods() Diagnosis {
+	d := Diagnosis{Check: fmt.Sprintf(config.GTM("Mods of %s"), ss.Name)}
+	report, err := ss.VerifyMods()
+	switch {
+	case err != nil:
+		d.Problem = err.Error()
+		d.Fix = config.GTM("Sync the server with syncedpz sync to get its config")
+	case !report.OK():
+		d.Problem = fmt.Sprintf(config.GTM("%d workshop items and %d mods missing"), len(report.MissingWorkshopItems), len(report.MissingMods))
+		d.Fix = config.GTM("Subscribe to the missing workshop items and start the game once to download them")
+		for _, item := range report.MissingWorkshopItems {
+			d.Fix += "\n  https://steamcommunity.com/sharedfiles/filedetails/?id=" + item
+		}
+		if len(report.MissingMods) > 0 {
+			d.Fix += "\n  " + fmt.Sprintf(config.GTM("Mods not found: %s"), strings.Join(report.MissingMods, ", "))
+		}
+	case len(report.MismatchedMods) > 0:
+		d.Warning = true
+		d.Problem = fmt.Sprintf(config.GTM("%d mods are installed from other workshop items than the ones of the server"), len(report.MismatchedMods))
+		d.Fix = config.GTM("Their versions may differ from the ones of the other players, subscribe to the workshop items of the server")
+	}
+	return d
+}
+
+// dirSize returns the size of the files of the folder
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// diagnoseDiskSpace checks there's space for the copies and the backups of the largest world, on the
+// disks of the synced servers and of the game saves
+func diagnoseDiskSpace(servers []*SyncedServer) Diagnosis {
+	d := Diagnosis{Check: config.GTM("Disk space")}
+
+	var largest int64
+	for _, ss := range servers {
+		largest = max(largest, dirSize(filepath.Join(ss.GetServerPath(), "save")))
+	}
+	// A sync may keep a copy in the repository and a backup of the local save at the same time
+	needed := max(uint64(2*largest), minFreeDiskSpace)
+
+	paths := []string{config.DataPath}
+	if config.PZ_DataPath != "" {
+		paths = append(paths, config.PZ_DataPath)
+	}
+	for _, path := range paths {
+		free, err := utils.FreeDiskSpace(path)
+		if err != nil {
+			continue
+		}
+		if free < needed {
+			d.Problem = fmt.Sprintf(config.GTM("%.1f GB free on the disk of %s, %.1f GB are needed"), float64(free)/(1<<30), path, float64(needed)/(1<<30))
+			d.Fix = config.GTM("Free some space, older backups can be removed with syncedpz backups prune")
+		}
+	}
+	return d
+}
@@ -0,0 +1,250 @@
+package syncedpz
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/pzsave"
+	"syncedpz/pkg/utils"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ManifestFilename = "manifest.json"
+	// ExportFormatVersion is increased when the layout of the exported archives changes
+	ExportFormatVersion = 1
+)
+
+// exportEntries are the files and folders of the server repository stored in an export
+var exportEntries = []string{"config", "save", "players", "players.txt", "mods.json"}
+
+// ExportManifest describes the world stored in an exported archive
+type ExportManifest struct {
+	FormatVersion int              `json:"format_version"`
+	Name          string           `json:"name"`
+	ExportedAt    time.Time        `json:"exported_at"`
+	ExportedBy    string           `json:"exported_by"`
+	Commit        string           `json:"commit,omitempty"`
+	Players       []string         `json:"players"`
+	Mods          ModList          `json:"mods"`
+	Metadata      *pzsave.Metadata `json:"metadata,omitempty"`
+}
+
+// Export writes the latest snapshot of the server (saves, config files, players and mods) to a zstd
+// compressed tar archive, with a manifest describing it
+func (ss *SyncedServer) Export(ctx context.Context, archivePath string) (*ExportManifest, error) {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	// Exports the latest version of the server
+	if changes, err := ss.TryPull(ctx); err != nil {
+		return nil, err
+	} else if changes {
+		if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	ss.logger().Infof("Exporting %s to %s", ss.Name, archivePath)
+
+	manifest := &ExportManifest{
+		FormatVersion: ExportFormatVersion,
+		Name:          ss.Name,
+		ExportedAt:    time.Now(),
+		ExportedBy:    config.PZ_SteamID,
+	}
+	if manifest.Players, err = ss.GetPlayers(); err != nil {
+		return nil, err
+	}
+	history, err := ss.GetHistory(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		manifest.Commit = history[0].Hash
+	}
+	if mods, err := ss.GetRequiredMods(); err == nil {
+		manifest.Mods = mods
+	}
+	if metadata, err := ss.GetSaveMetadata(); err == nil {
+		manifest.Metadata = metadata
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []string{}
+	for _, entry := range exportEntries {
+		if _, err := os.Stat(filepath.Join(ss.GetServerPath(), entry)); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	zw, err := zstd.NewWriter(file)
+	if err == nil {
+		files := []utils.TarFile{{Name: ManifestFilename, Data: manifestData}}
+		err = utils.WriteTarWithFiles(zw, files, ss.GetServerPath(), entries)
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+
+	ss.logger().Info("Server exported")
+	return manifest, nil
+}
+
+// ReadExportManifest reads the manifest of an exported archive
+func ReadExportManifest(archivePath string) (*ExportManifest, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s has no %s, it isn't an exported server", filepath.Base(archivePath), ManifestFilename)
+		} else if err != nil {
+			return nil, err
+		}
+		if header.Name != ManifestFilename {
+			continue
+		}
+
+		manifest := &ExportManifest{}
+		if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ManifestFilename, err)
+		}
+		return manifest, manifest.validate()
+	}
+}
+
+func (m ExportManifest) validate() error {
+	if m.FormatVersion > ExportFormatVersion {
+		return fmt.Errorf("the archive was exported by a newer version of SyncedPZ (format %d), update it to import", m.FormatVersion)
+	}
+	if m.Name == "" || m.Name != filepath.Base(m.Name) || strings.ContainsAny(m.Name, `/\`) || m.Name == "." || m.Name == ".." {
+		return fmt.Errorf("invalid server name in the archive: %q", m.Name)
+	}
+	return nil
+}
+
+// Import installs an exported server in the local Project Zomboid files.
+// When gitURL isn't empty the server is also published to the repository as a new synced server,
+// otherwise it's installed as a local server only
+func Import(ctx context.Context, archivePath, gitURL string) (*SyncedServer, *ExportManifest, error) {
+	manifest, err := ReadExportManifest(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Infof("Importing %s from %s", manifest.Name, archivePath)
+
+	if _, err := GetSyncedServer(manifest.Name); err == nil {
+		return nil, nil, fmt.Errorf("a synced server named %q already exists", manifest.Name)
+	}
+	ss := NewSyncedServer(manifest.Name, gitURL)
+	if _, err := os.Stat(ss.GetServerPath()); err == nil {
+		return nil, nil, fmt.Errorf("%s already exists, remove it to import the server", ss.GetServerPath())
+	}
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lock.Unlock()
+
+	if gitURL != "" {
+		changes, err := ss.TryPull(ctx)
+		if err != nil || changes {
+			os.RemoveAll(ss.GetServerPath())
+		}
+		if err != nil {
+			return nil, nil, err
+		} else if changes {
+			return nil, nil, errors.New("the git repository already has content, use an empty one to publish the server")
+		}
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+
+	err = utils.ExtractTar(zr, ss.GetServerPath())
+	if err == nil {
+		err = os.Remove(filepath.Join(ss.GetServerPath(), ManifestFilename))
+	}
+	if err != nil {
+		os.RemoveAll(ss.GetServerPath())
+		return nil, nil, err
+	}
+
+	ss.EnsureDirs()
+	if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+		os.RemoveAll(ss.GetServerPath())
+		return nil, nil, err
+	}
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return nil, nil, err
+	}
+
+	if gitURL == "" {
+		// Installed as a local server only, it can be added as a synced server later
+		err = os.RemoveAll(ss.GetServerPath())
+		log.Info("Server imported")
+		return nil, manifest, err
+	}
+
+	err = ss.UpdatePlayersFile()
+	if err == nil {
+		err = ss.CommitAndPush(ctx)
+	}
+	if err != nil {
+		os.RemoveAll(ss.GetServerPath())
+		return nil, nil, err
+	}
+	if err := ss.Save(); err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("Server imported and published")
+	return ss, manifest, nil
+}
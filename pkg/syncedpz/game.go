@@ -0,0 +1,61 @@
+package syncedpz
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syncedpz/config"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// SyncInterval is how often the servers are synced while the game is running
+const SyncInterval = 5 * time.Minute
+
+// RunGame starts Project Zomboid and waits until it closes, calling onTick every interval meanwhile.
+// onTick isn't called anymore once the context is done, but the game keeps running until it's closed.
+// Only fails if the game can't be started
+func RunGame(ctx context.Context, interval time.Duration, onTick func()) error {
+	log.Infof("Starting Project Zomboid with bat path:\n%s", config.PZ_BatPath)
+	cmd := exec.Command(config.PZ_BatPath)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	log.Info("Project Zomboid started with PID: ", cmd.Process.Pid)
+	notify(WebhookEvent{
+		Event:   EventSessionStarted,
+		Message: fmt.Sprintf(config.GTM("%s started playing"), config.PZ_SteamID),
+	})
+
+	// When Project Zomboid closes, stop the syncing
+	closed := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		log.Info("Keep syncing mode")
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				onTick()
+			}
+		}
+	}()
+
+	cmd.Wait()
+	close(closed)
+	<-stopped
+	notify(WebhookEvent{
+		Event:   EventSessionEnded,
+		Message: fmt.Sprintf(config.GTM("%s finished playing"), config.PZ_SteamID),
+	})
+	return nil
+}
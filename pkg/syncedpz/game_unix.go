@@ -0,0 +1,65 @@
+//go:build !windows
+
+package syncedpz
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// gameExecutables are the names of the Project Zomboid launchers
+var gameExecutables = []string{"ProjectZomboid64", "ProjectZomboid32"}
+
+// gameMainClasses are the java classes of the game and the dedicated server, when they're run by java
+var gameMainClasses = []string{"zombie.gameStates.MainScreenState", "zombie.network.GameServer"}
+
+// isGameCommand returns true if the arguments of a process are the ones of the game or a dedicated
+// server. Only the executable is compared, so an editor or a shell in the install folder doesn't match
+func isGameCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	executable := filepath.Base(args[0])
+	if slices.Contains(gameExecutables, executable) {
+		return true
+	}
+	if executable != "java" {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if slices.Contains(gameMainClasses, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGameRunning returns true if a Project Zomboid process is running, the game or a dedicated server
+func IsGameRunning() bool {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil || len(cmdlines) == 0 {
+		// No procfs, like on macOS
+		for _, executable := range gameExecutables {
+			if exec.Command("pgrep", "-x", executable).Run() == nil {
+				return true
+			}
+		}
+		return exec.Command("pgrep", "-f", `(^|/)java .*zombie\.(gameStates\.MainScreenState|network\.GameServer)`).Run() == nil
+	}
+
+	for _, path := range cmdlines {
+		cmdline, err := os.ReadFile(path)
+		if err != nil {
+			continue // the process ended
+		}
+		args := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+		if isGameCommand(args) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package syncedpz
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// IsGameRunning returns true if a Project Zomboid process is running, the game or a dedicated server
+func IsGameRunning() bool {
+	out, err := exec.Command("tasklist", "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(out)), "projectzomboid")
+}
@@ -1,19 +1,21 @@
 package syncedpz
 
 import (
-	"syncedpz/pkg/utils"
-
 	"github.com/go-git/go-git/v5"
 )
 
-func removeUnstagedFiles(wt *git.Worktree) {
+func removeUnstagedFiles(wt *git.Worktree) error {
 	status, err := wt.Status()
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
 	for file, statusEntry := range status {
 		if statusEntry.Worktree == git.Untracked {
-			_, err := wt.Remove(file)
-			utils.HandleErr(err)
+			if _, err := wt.Remove(file); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,228 @@
+package syncedpz
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/pzconfig"
+)
+
+// PZ_AppID is the steam app id of Project Zomboid, used by the workshop content folder
+const PZ_AppID = "108600"
+
+// ModList is the set of mods required by a server, declared by the Mods= and WorkshopItems= lines of its .ini
+type ModList struct {
+	Mods          []string `json:"mods"`
+	WorkshopItems []string `json:"workshop_items"`
+}
+
+// ModReport is the result of comparing the mods required by a server with the installed ones
+type ModReport struct {
+	MissingWorkshopItems []string `json:"missing_workshop_items"`
+	MissingMods          []string `json:"missing_mods"`
+	// Required mods installed from somewhere else than the required workshop items, so their version may differ
+	MismatchedMods map[string]string `json:"mismatched_mods"`
+}
+
+// OK returns true if every required mod is installed
+func (r ModReport) OK() bool {
+	return len(r.MissingWorkshopItems) == 0 && len(r.MissingMods) == 0
+}
+
+// InstalledMods is the mod content found on this computer
+type InstalledMods struct {
+	ModIDs        map[string]string // mod id -> folder of the mod
+	WorkshopItems map[string]bool
+	// If the workshop content folder was found, when it's not (e.g. non steam versions of the game) the
+	// workshop items can't be checked
+	HasWorkshop bool
+}
+
+// splitModList splits the value of the Mods= and WorkshopItems= lines
+func splitModList(value string) []string {
+	list := []string{}
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// readModList reads the mod list of a server .ini file
+func readModList(iniPath string) (ModList, error) {
+	data, err := os.ReadFile(iniPath)
+	if err != nil {
+		return ModList{}, err
+	}
+	file, err := pzconfig.Parse(iniPath, data)
+	if err != nil {
+		return ModList{}, err
+	}
+
+	mods, _ := file.Get("Mods")
+	workshopItems, _ := file.Get("WorkshopItems")
+	return ModList{
+		Mods:          splitModList(mods),
+		WorkshopItems: splitModList(workshopItems),
+	}, nil
+}
+
+// getModsFilePath returns the path of the file with the required mods in the server repository
+func (ss SyncedServer) getModsFilePath() string {
+	return filepath.Join(ss.GetServerPath(), "mods.json")
+}
+
+// UpdateModsFile stores the mods required by the server in the server repository, reading them from the
+// synced .ini file
+func (ss *SyncedServer) UpdateModsFile() error {
+	ss.logger().Info("Updating mods file")
+
+	iniPath := filepath.Join(ss.GetServerPath(), "config", pzconfig.ServerINI.Filename(ss.Name))
+	modList, err := readModList(iniPath)
+	if err != nil {
+		ss.logger().Warnf("Could not read the mod list: %s", err)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(modList, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(ss.getModsFilePath(), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	ss.logger().Info("Mods file updated")
+	return nil
+}
+
+// GetRequiredMods returns the mods required by the server
+func (ss SyncedServer) GetRequiredMods() (ModList, error) {
+	data, err := os.ReadFile(ss.getModsFilePath())
+	if os.IsNotExist(err) {
+		// Servers synced before the mods file existed
+		return readModList(filepath.Join(ss.GetServerPath(), "config", pzconfig.ServerINI.Filename(ss.Name)))
+	} else if err != nil {
+		return ModList{}, err
+	}
+
+	modList := ModList{}
+	err = json.Unmarshal(data, &modList)
+	return modList, err
+}
+
+// getWorkshopContentPath returns the steam workshop content folder of Project Zomboid.
+// The bat file is at steamapps/common/ProjectZomboid, so the workshop is at steamapps/workshop/content/108600
+func getWorkshopContentPath() string {
+	steamappsPath := filepath.Dir(filepath.Dir(filepath.Dir(config.PZ_BatPath)))
+	return filepath.Join(steamappsPath, "workshop", "content", PZ_AppID)
+}
+
+// readModID reads the id of a mod from its mod.info file
+func readModID(modInfoPath string) string {
+	file, err := os.Open(modInfoPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found && strings.EqualFold(strings.TrimSpace(key), "id") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// GetInstalledMods returns the mods installed from the steam workshop, the mods folder of the game data
+// and the mods folder of the game installation
+func GetInstalledMods() InstalledMods {
+	installed := InstalledMods{
+		ModIDs:        make(map[string]string),
+		WorkshopItems: make(map[string]bool),
+	}
+
+	addModsFolder := func(modsPath string) {
+		entries, err := os.ReadDir(modsPath)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			modPath := filepath.Join(modsPath, entry.Name())
+			id := readModID(filepath.Join(modPath, "mod.info"))
+			if _, ok := installed.ModIDs[id]; id != "" && !ok {
+				installed.ModIDs[id] = modPath
+			}
+		}
+	}
+
+	workshopPath := getWorkshopContentPath()
+	if entries, err := os.ReadDir(workshopPath); err == nil {
+		installed.HasWorkshop = true
+		for _, entry := range entries {
+			installed.WorkshopItems[entry.Name()] = true
+			addModsFolder(filepath.Join(workshopPath, entry.Name(), "mods"))
+		}
+	}
+
+	addModsFolder(filepath.Join(config.PZ_DataPath, "mods"))
+	if entries, err := os.ReadDir(filepath.Join(config.PZ_DataPath, "Workshop")); err == nil {
+		for _, entry := range entries {
+			addModsFolder(filepath.Join(config.PZ_DataPath, "Workshop", entry.Name(), "Contents", "mods"))
+		}
+	}
+	addModsFolder(filepath.Join(filepath.Dir(config.PZ_BatPath), "mods"))
+
+	return installed
+}
+
+// VerifyMods compares the mods required by the server with the installed ones
+func (ss SyncedServer) VerifyMods() (ModReport, error) {
+	report := ModReport{MismatchedMods: make(map[string]string)}
+
+	required, err := ss.GetRequiredMods()
+	if os.IsNotExist(err) {
+		return report, nil // nothing synced yet
+	} else if err != nil {
+		return report, err
+	}
+	installed := GetInstalledMods()
+
+	requiredWorkshopPaths := []string{}
+	for _, item := range required.WorkshopItems {
+		if installed.HasWorkshop && !installed.WorkshopItems[item] {
+			report.MissingWorkshopItems = append(report.MissingWorkshopItems, item)
+		}
+		requiredWorkshopPaths = append(requiredWorkshopPaths, filepath.Join(getWorkshopContentPath(), item)+string(filepath.Separator))
+	}
+
+	for _, mod := range required.Mods {
+		modPath, ok := installed.ModIDs[mod]
+		if !ok {
+			report.MissingMods = append(report.MissingMods, mod)
+			continue
+		}
+
+		if installed.HasWorkshop && len(required.WorkshopItems) > 0 {
+			fromRequiredItem := false
+			for _, itemPath := range requiredWorkshopPaths {
+				fromRequiredItem = fromRequiredItem || strings.HasPrefix(modPath, itemPath)
+			}
+			if !fromRequiredItem {
+				report.MismatchedMods[mod] = modPath
+			}
+		}
+	}
+
+	sort.Strings(report.MissingWorkshopItems)
+	sort.Strings(report.MissingMods)
+	return report, nil
+}
@@ -0,0 +1,85 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syncedpz/config"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// RemoteError is a failure of a git repository that retrying won't fix, like wrong credentials or a
+// repository that doesn't exist
+type RemoteError struct {
+	URL    string
+	Reason string
+	Err    error
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.URL, e.Reason, e.Err)
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError returns a RemoteError if the error of an operation with the repository won't go away by
+// retrying, or nil if it may be transient
+func permanentError(gitURL string, err error) *RemoteError {
+	var remoteErr *RemoteError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &remoteErr):
+		return remoteErr
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrInvalidAuthMethod):
+		return &RemoteError{gitURL, "authentication failed, check your git credentials with syncedpz config setup", err}
+	case errors.Is(err, transport.ErrAuthorizationFailed):
+		return &RemoteError{gitURL, "access denied, check if your git user can access the repository", err}
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return &RemoteError{gitURL, "repository not found, check its URL", err}
+	case isRejected(err):
+		return &RemoteError{gitURL, "the repository has changes that aren't local", err}
+	case errors.Is(err, context.Canceled):
+		return &RemoteError{gitURL, "canceled", err}
+	}
+	return nil
+}
+
+// withRetry runs a network operation with the repository, with a timeout for each attempt and retrying
+// transient failures with an exponential backoff, logged with the logger of the context. Permanent failures are
+// returned as a RemoteError
+func withRetry(ctx context.Context, operation, gitURL string, fn func(ctx context.Context) error) error {
+	backoff := config.NetworkBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, config.NetworkTimeout)
+		err := fn(attemptCtx)
+		timedOut := attemptCtx.Err() == context.DeadlineExceeded
+		cancel()
+
+		if isRemoteOK(err) {
+			return err
+		}
+		if timedOut {
+			err = fmt.Errorf("%s timed out after %s: %w", operation, config.NetworkTimeout, err)
+		}
+		if remoteErr := permanentError(gitURL, err); remoteErr != nil {
+			return remoteErr
+		}
+		if attempt > config.NetworkRetries || ctx.Err() != nil {
+			return err
+		}
+
+		log.FromContext(ctx).Warnf("%s %s failed (attempt %d of %d), retrying in %s: %s", operation, gitURL, attempt, config.NetworkRetries+1, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,266 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syncedpz/pkg/pzconfig"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrOffline is returned when none of the git repositories of the server is reachable
+var ErrOffline = errors.New("no git repository of the server is reachable")
+
+// offlineRefPrefix is where the queued snapshots are kept when they can't be pushed because the server
+// changed in the meantime
+const offlineRefPrefix = "refs/offline/"
+
+// remoteCommits returns the commits of the current branch in every repository of the server but the
+// diverged mirrors, as they were last fetched
+func (ss *SyncedServer) remoteCommits() []*object.Commit {
+	commits := []*object.Commit{}
+	diverged := ss.divergedMirrors()
+	for _, gitURL := range ss.GetRemoteURLs() {
+		if diverged[ss.remoteName(gitURL)] {
+			continue
+		}
+		if commit := ss.remoteBranchCommit(ss.remoteName(gitURL)); commit != nil {
+			commits = append(commits, commit)
+		}
+	}
+	return commits
+}
+
+// GetQueuedSnapshots returns the snapshots committed locally that aren't in any repository of the server
+// yet, the most recent first
+func (ss *SyncedServer) GetQueuedSnapshots() []CommitInfo {
+	if err := ss.openRepo(); err != nil {
+		ss.logger().Error(err)
+		return []CommitInfo{}
+	}
+
+	queued := []CommitInfo{}
+	head, err := ss.repo.Head()
+	if err != nil {
+		return queued
+	}
+	commits, err := ss.repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return queued
+	}
+	defer commits.Close()
+
+	remoteCommits := ss.remoteCommits()
+	for {
+		commit, err := commits.Next()
+		if err != nil {
+			break
+		}
+		for _, remoteCommit := range remoteCommits {
+			if pushed, err := commit.IsAncestor(remoteCommit); err == nil && pushed {
+				return queued
+			}
+		}
+		queued = append(queued, newCommitInfo(commit))
+	}
+	return queued
+}
+
+// changedPaths returns the paths of the files changed between the commits
+func changedPaths(from, to *object.Commit) (map[string]bool, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, change := range changes {
+		if change.From.Name != "" {
+			paths[change.From.Name] = true
+		}
+		if change.To.Name != "" {
+			paths[change.To.Name] = true
+		}
+	}
+	return paths, nil
+}
+
+// keepQueuedSnapshots saves a reference to the queued snapshots, so they aren't lost when the branch is
+// moved
+func (ss *SyncedServer) keepQueuedSnapshots(head plumbing.Hash) plumbing.ReferenceName {
+	name := plumbing.ReferenceName(offlineRefPrefix + time.Now().Format("20060102-150405"))
+	if err := ss.repo.Storer.SetReference(plumbing.NewHashReference(name, head)); err != nil {
+		ss.logger().Error(err)
+	}
+	return name
+}
+
+// rebaseQueue moves the queued snapshots on top of the remote commit, when the files they changed weren't
+// changed by the remote ones. The config files changed by both are merged setting by setting, the remote
+// values winning the conflicts. Returns false if they conflict
+func (ss *SyncedServer) rebaseQueue(local, remote *object.Commit) (bool, error) {
+	bases, err := local.MergeBase(remote)
+	if err != nil || len(bases) == 0 {
+		return false, err
+	}
+	localPaths, err := changedPaths(bases[0], local)
+	if err != nil {
+		return false, err
+	}
+	remotePaths, err := changedPaths(bases[0], remote)
+	if err != nil {
+		return false, err
+	}
+	merged := make(map[string][]byte)
+	conflicts := make(map[string][]pzconfig.Conflict)
+	for path := range localPaths {
+		if !remotePaths[path] {
+			continue
+		}
+		data, fileConflicts, ok, err := ss.mergeCommitsConfig(path, bases[0], local, remote)
+		if err != nil || !ok {
+			return false, err
+		}
+		merged[path] = data
+		conflicts[path] = fileConflicts
+		delete(localPaths, path)
+	}
+
+	ss.logger().Info("Rebasing the queued snapshots on the new changes of the server")
+	ss.keepQueuedSnapshots(local.Hash)
+
+	localTree, err := local.Tree()
+	if err != nil {
+		return false, err
+	}
+	w, err := ss.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: remote.Hash, Mode: git.HardReset}); err != nil {
+		return false, err
+	}
+	if err := ss.checkoutPaths(localTree, localPaths); err != nil {
+		return false, err
+	}
+	for path, data := range merged {
+		if err := os.WriteFile(filepath.Join(ss.GetServerPath(), filepath.FromSlash(path)), data, 0644); err != nil {
+			return false, err
+		}
+		if err := ss.addConflicts(filepath.Base(path), conflicts[path]); err != nil {
+			return false, err
+		}
+	}
+
+	subject, _, _ := strings.Cut(local.Message, "\n")
+	if err := ss.CommitWithMessage(fmt.Sprintf("%s\n\nRebased on %s after being queued offline", subject, remote.Hash.String()[:8])); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkoutPaths writes the files at the paths as they are in the tree to the server repository, removing
+// the ones that aren't in it
+func (ss *SyncedServer) checkoutPaths(tree *object.Tree, paths map[string]bool) error {
+	for path := range paths {
+		fullPath := filepath.Join(ss.GetServerPath(), filepath.FromSlash(path))
+		file, err := tree.File(path)
+		if err == object.ErrFileNotFound {
+			if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := writeGitFile(file, fullPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGitFile writes the content of a file of a commit to the path
+func writeGitFile(file *object.File, path string) error {
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// flushQueue pushes the snapshots queued while offline. If the server changed in the meantime they're
+// rebased on top of the changes, or, when both changed the same files other than the config files, a
+// DivergenceError is returned and nothing is overwritten
+func (ss *SyncedServer) flushQueue(ctx context.Context) error {
+	queued := ss.GetQueuedSnapshots()
+	if len(queued) == 0 {
+		return nil
+	}
+
+	ss.logger().Infof("Flushing %d queued snapshots", len(queued))
+
+	reachable, err := ss.fetchRemotes(ctx)
+	if err != nil {
+		return err
+	}
+	head, err := ss.repo.Head()
+	if err != nil {
+		return err
+	}
+	local, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	remote := ss.remoteBranchCommit(ss.freshestRemote(reachable))
+	if remote != nil {
+		if upToDate, err := remote.IsAncestor(local); err != nil {
+			return err
+		} else if !upToDate {
+			ss.baseCommit = local.Hash
+
+			rebased, err := ss.rebaseQueue(local, remote)
+			if err != nil {
+				return err
+			}
+			if !rebased {
+				return ss.newDivergenceError(local, remote)
+			}
+			if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return ss.TryPush(ctx)
+}
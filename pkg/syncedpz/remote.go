@@ -0,0 +1,600 @@
+package syncedpz
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/utils"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// ErrMirrorDiverged is recorded in the health of a mirror whose branch has snapshots the primary repository
+// doesn't have, and misses some of its snapshots
+var ErrMirrorDiverged = errors.New("non fast-forward mirror")
+
+// migrationRefSpecs are the references pushed when migrating a server, its whole history
+var migrationRefSpecs = []gitconfig.RefSpec{
+	"refs/heads/*:refs/heads/*",
+	"refs/tags/*:refs/tags/*",
+}
+
+// SetURL changes the git repository of the server, without pushing anything to it.
+// Useful when the repository was moved by someone else
+func (ss *SyncedServer) SetURL(ctx context.Context, gitURL string) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return ss.setURL(gitURL)
+}
+
+func (ss *SyncedServer) setURL(gitURL string) error {
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+
+	ss.logger().Infof("Changing the repository of %s to %s", ss.Name, gitURL)
+
+	ss.GitURL = gitURL
+	// The new primary repository isn't a mirror anymore
+	mirrors := []string{}
+	for _, mirror := range ss.Mirrors {
+		if mirror != gitURL {
+			mirrors = append(mirrors, mirror)
+		}
+	}
+	ss.Mirrors = mirrors
+	if err := ss.ensureRemotes(); err != nil {
+		return err
+	}
+	return ss.Save()
+}
+
+// localRefs returns the branches and tags of the server repository
+func (ss *SyncedServer) localRefs() (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+
+	iter, err := ss.repo.References()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && (ref.Name().IsBranch() || ref.Name().IsTag()) {
+			refs[ref.Name()] = ref.Hash()
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// VerifyRemote checks if every branch and tag of the server repository is in the git repository, pointing
+// to the same commit
+func (ss *SyncedServer) VerifyRemote(ctx context.Context, gitURL string) error {
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+
+	local, err := ss.localRefs()
+	if err != nil {
+		return err
+	}
+
+	remote := git.NewRemote(ss.repo.Storer, &gitconfig.RemoteConfig{Name: "anonymous", URLs: []string{gitURL}})
+	var remoteRefs []*plumbing.Reference
+	err = withRetry(ctx, "List", gitURL, func(ctx context.Context) error {
+		remoteRefs, err = remote.ListContext(ctx, &git.ListOptions{Auth: config.GitAuth})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	remoteHashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, ref := range remoteRefs {
+		remoteHashes[ref.Name()] = ref.Hash()
+	}
+
+	mismatched := []string{}
+	for name, hash := range local {
+		if remoteHashes[name] != hash {
+			mismatched = append(mismatched, name.Short())
+		}
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("the repository %s doesn't match the local one at: %s", gitURL, strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+// Migrate moves the server to a new git repository: its whole history is pushed to it, it's verified and
+// then it replaces the current repository of the server.
+// The old repository is left untouched, the other players must change to the new one with SetURL
+func (ss *SyncedServer) Migrate(ctx context.Context, gitURL string) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Migrates the latest version of the server
+	if changes, err := ss.TryPull(ctx); err != nil {
+		return err
+	} else if changes {
+		if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+			return err
+		}
+	}
+
+	ss.logger().Infof("Migrating %s to %s", ss.Name, gitURL)
+
+	remote := git.NewRemote(ss.repo.Storer, &gitconfig.RemoteConfig{Name: "anonymous", URLs: []string{gitURL}})
+	err = withRetry(ctx, "Push", gitURL, func(ctx context.Context) error {
+		return remote.PushContext(ctx, &git.PushOptions{
+			RemoteName: "anonymous",
+			RefSpecs:   migrationRefSpecs,
+			Auth:       config.GitAuth,
+			Progress:   utils.Output,
+		})
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	ss.logger().Info("Verifying the new repository")
+	if err := ss.VerifyRemote(ctx, gitURL); err != nil {
+		return err
+	}
+
+	if err := ss.setURL(gitURL); err != nil {
+		return err
+	}
+	// Updates the remote branches of the new repository
+	if _, err := ss.TryFetch(ctx); err != nil {
+		ss.logger().Warnf("Could not fetch the new repository: %s", err)
+	}
+
+	ss.logger().Info("Server migrated")
+	return nil
+}
+
+// RemoteHealth is the result of the last operations with a git repository of the server
+type RemoteHealth struct {
+	URL                 string    `json:"url"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastError           string    `json:"last_error"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	// The last failure won't go away by retrying, like wrong credentials
+	Permanent bool `json:"permanent"`
+}
+
+// Healthy returns true if the last operation with the repository succeeded
+func (rh RemoteHealth) Healthy() bool {
+	return rh.ConsecutiveFailures == 0
+}
+
+// remoteName returns the name of the git remote of the repository, origin for the primary one
+func (ss SyncedServer) remoteName(gitURL string) string {
+	if gitURL == ss.GitURL {
+		return "origin"
+	}
+	hash := sha1.Sum([]byte(gitURL))
+	return "mirror-" + hex.EncodeToString(hash[:4])
+}
+
+// remoteURL returns the URL of the git remote of the server
+func (ss SyncedServer) remoteURL(remoteName string) string {
+	for _, gitURL := range ss.GetRemoteURLs() {
+		if ss.remoteName(gitURL) == remoteName {
+			return gitURL
+		}
+	}
+	return remoteName
+}
+
+// GetRemoteURLs returns the git repositories of the server, the primary one first
+func (ss SyncedServer) GetRemoteURLs() []string {
+	return append([]string{ss.GitURL}, ss.Mirrors...)
+}
+
+// ensureRemotes makes the git remotes of the server repository match its repositories
+func (ss *SyncedServer) ensureRemotes() error {
+	cfg, err := ss.repo.Config()
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]string)
+	for _, gitURL := range ss.GetRemoteURLs() {
+		wanted[ss.remoteName(gitURL)] = gitURL
+	}
+
+	changed := false
+	for name := range cfg.Remotes {
+		if _, ok := wanted[name]; !ok && strings.HasPrefix(name, "mirror-") {
+			delete(cfg.Remotes, name)
+			changed = true
+		}
+	}
+	for name, gitURL := range wanted {
+		remote, ok := cfg.Remotes[name]
+		if ok && len(remote.URLs) == 1 && remote.URLs[0] == gitURL {
+			continue
+		}
+		cfg.Remotes[name] = &gitconfig.RemoteConfig{
+			Name:  name,
+			URLs:  []string{gitURL},
+			Fetch: []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf(gitconfig.DefaultFetchRefSpec, name))},
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return ss.repo.SetConfig(cfg)
+}
+
+// AddMirror adds a git repository kept in sync with the primary one. The server is pushed to it
+func (ss *SyncedServer) AddMirror(ctx context.Context, gitURL string) error {
+	for _, existing := range ss.GetRemoteURLs() {
+		if existing == gitURL {
+			return fmt.Errorf("%s is already a repository of %s", gitURL, ss.Name)
+		}
+	}
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	ss.logger().Infof("Adding the mirror %s to %s", gitURL, ss.Name)
+
+	ss.Mirrors = append(ss.Mirrors, gitURL)
+	if err := ss.ensureRemotes(); err != nil {
+		return err
+	}
+	if err := ss.Save(); err != nil {
+		return err
+	}
+
+	return ss.TryPush(ctx)
+}
+
+// RemoveMirror removes a mirror of the server, the repository itself is left untouched
+func (ss *SyncedServer) RemoveMirror(ctx context.Context, gitURL string) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	mirrors := []string{}
+	for _, mirror := range ss.Mirrors {
+		if mirror != gitURL {
+			mirrors = append(mirrors, mirror)
+		}
+	}
+	if len(mirrors) == len(ss.Mirrors) {
+		return fmt.Errorf("%s isn't a mirror of %s", gitURL, ss.Name)
+	}
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+
+	ss.Mirrors = mirrors
+	if err := ss.ensureRemotes(); err != nil {
+		return err
+	}
+	if err := ss.Save(); err != nil {
+		return err
+	}
+
+	health := ss.GetRemotesHealth()
+	delete(health, gitURL)
+	return ss.saveRemotesHealth(health)
+}
+
+// getRemotesHealthKey returns the key of the health of the server repositories used in the database
+func (ss SyncedServer) getRemotesHealthKey() []byte {
+	return []byte("remotes_health_" + ss.Name)
+}
+
+// GetRemotesHealth returns the health of the server repositories, by URL
+func (ss SyncedServer) GetRemotesHealth() map[string]RemoteHealth {
+	health := make(map[string]RemoteHealth)
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ss.getRemotesHealthKey())
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			return gob.NewDecoder(bytes.NewReader(v)).Decode(&health)
+		})
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		ss.logger().Error(err)
+	}
+	return health
+}
+
+func (ss SyncedServer) saveRemotesHealth(health map[string]RemoteHealth) error {
+	var buff bytes.Buffer
+	if err := gob.NewEncoder(&buff).Encode(health); err != nil {
+		return err
+	}
+	return config.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(ss.getRemotesHealthKey(), buff.Bytes())
+	})
+}
+
+// recordRemoteResult updates the health of the repository with the result of an operation with it
+func (ss SyncedServer) recordRemoteResult(gitURL string, err error) {
+	health := ss.GetRemotesHealth()
+	rh := health[gitURL]
+	rh.URL = gitURL
+	if err == nil {
+		rh.LastSuccess = time.Now()
+		rh.ConsecutiveFailures = 0
+	} else {
+		rh.LastFailure = time.Now()
+		rh.LastError = err.Error()
+		rh.ConsecutiveFailures++
+		rh.Permanent = permanentError(gitURL, err) != nil
+		ss.logger().Warnf("Repository %s failed: %s", gitURL, err)
+	}
+	health[gitURL] = rh
+	if err := ss.saveRemotesHealth(health); err != nil {
+		ss.logger().Error(err)
+	}
+}
+
+// isRemoteOK returns true if the error of a git operation means it succeeded
+func isRemoteOK(err error) bool {
+	return err == nil || err == git.NoErrAlreadyUpToDate || err == transport.ErrEmptyRemoteRepository
+}
+
+// remotesFailed returns the error of an operation that failed in every repository of the server:
+// ErrOffline if any of them may be temporarily unreachable, otherwise their permanent errors
+func remotesFailed(errs []error) error {
+	permanent := []error{}
+	for _, err := range errs {
+		var remoteErr *RemoteError
+		if !errors.As(err, &remoteErr) {
+			return fmt.Errorf("%w: %w", ErrOffline, err)
+		}
+		permanent = append(permanent, err)
+	}
+	return errors.Join(permanent...)
+}
+
+// fetchRemotes fetches every repository of the server, returning the names of the reachable remotes, the
+// primary one first. It only fails if none of them is reachable
+func (ss *SyncedServer) fetchRemotes(ctx context.Context) ([]string, error) {
+	reachable := []string{}
+	errs := []error{}
+	for _, gitURL := range ss.GetRemoteURLs() {
+		name := ss.remoteName(gitURL)
+		err := withRetry(ctx, "Fetch", gitURL, func(ctx context.Context) error {
+			return ss.repo.FetchContext(ctx, &git.FetchOptions{
+				RemoteName: name,
+				Tags:       git.AllTags,
+				Auth:       config.GitAuth,
+			})
+		})
+		if ctx.Err() != nil {
+			// Interrupted, it says nothing about the repository
+			return nil, ctx.Err()
+		}
+		if isRemoteOK(err) {
+			ss.recordRemoteResult(gitURL, nil)
+			reachable = append(reachable, name)
+		} else {
+			ss.recordRemoteResult(gitURL, err)
+			errs = append(errs, err)
+		}
+	}
+
+	// Reachable, but they can't be used until they're fixed
+	diverged := ss.divergedMirrors()
+	for _, gitURL := range ss.Mirrors {
+		if diverged[ss.remoteName(gitURL)] {
+			ss.recordRemoteResult(gitURL, &RemoteError{gitURL, "diverged from the primary repository, push the missing snapshots to it by hand or remove the mirror", ErrMirrorDiverged})
+		}
+	}
+	if len(reachable) > 0 {
+		return reachable, nil
+	}
+	return nil, remotesFailed(errs)
+}
+
+// currentBranch returns the branch of the server, the one checked out in the server repository if it
+// isn't set
+func (ss *SyncedServer) currentBranch() (plumbing.ReferenceName, bool) {
+	if ss.Branch != "" {
+		return plumbing.NewBranchReferenceName(ss.Branch), true
+	}
+	head, err := ss.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil || head.Type() != plumbing.SymbolicReference {
+		return "", false
+	}
+	return head.Target(), true
+}
+
+// remoteBranchCommit returns the commit of the current branch in the remote, as it was last fetched
+func (ss *SyncedServer) remoteBranchCommit(remoteName string) *object.Commit {
+	branch, ok := ss.currentBranch()
+	if !ok {
+		return nil
+	}
+	ref, err := ss.repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch.Short()), true)
+	if err != nil {
+		return nil
+	}
+	commit, err := ss.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil
+	}
+	return commit
+}
+
+// isAncestor returns true if the commit is the other one or one of its ancestors
+func isAncestor(commit, other *object.Commit) bool {
+	ancestor, err := commit.IsAncestor(other)
+	return err == nil && ancestor
+}
+
+// divergedMirrors returns the mirrors whose branch diverged from the one of the primary repository, as they
+// were last fetched. Each one has commits the other doesn't, so they're left out of the pulls and the
+// pushes until the mirror is fixed by hand
+func (ss *SyncedServer) divergedMirrors() map[string]bool {
+	diverged := make(map[string]bool)
+	primary := ss.remoteBranchCommit("origin")
+	if primary == nil {
+		return diverged
+	}
+	for _, gitURL := range ss.Mirrors {
+		name := ss.remoteName(gitURL)
+		commit := ss.remoteBranchCommit(name)
+		if commit != nil && !isAncestor(commit, primary) && !isAncestor(primary, commit) {
+			diverged[name] = true
+		}
+	}
+	return diverged
+}
+
+// freshestRemote returns the remote to pull from: the one with the most recent version of the current
+// branch among the reachable ones that are a fast-forward of the local branch. The first one wins when
+// they have the same version, so the primary repository is preferred. The primary one is returned if
+// none is a fast-forward, the divergence with the local branch is then found by the sync
+func (ss *SyncedServer) freshestRemote(reachable []string) string {
+	var local *object.Commit
+	if head, err := ss.repo.Head(); err == nil {
+		local, _ = ss.repo.CommitObject(head.Hash())
+	}
+	diverged := ss.divergedMirrors()
+
+	best := reachable[0]
+	var bestCommit *object.Commit
+	for _, name := range reachable {
+		commit := ss.remoteBranchCommit(name)
+		if commit == nil || diverged[name] || (local != nil && !isAncestor(local, commit)) {
+			continue
+		}
+		if bestCommit == nil || (commit.Hash != bestCommit.Hash && isAncestor(bestCommit, commit)) {
+			best, bestCommit = name, commit
+		}
+	}
+	return best
+}
+
+// hasRemoteChanges returns true if any of the remotes has commits that aren't in the local branch. The
+// diverged mirrors are left out
+func (ss *SyncedServer) hasRemoteChanges(remoteNames []string) bool {
+	head, err := ss.repo.Head()
+	diverged := ss.divergedMirrors()
+	for _, name := range remoteNames {
+		commit := ss.remoteBranchCommit(name)
+		if commit == nil || diverged[name] {
+			continue
+		}
+		if err != nil {
+			return true // nothing local yet
+		}
+		if commit.Hash == head.Hash() {
+			continue
+		}
+		headCommit, err := ss.repo.CommitObject(head.Hash())
+		if err != nil {
+			return true
+		}
+		if inHead, err := commit.IsAncestor(headCommit); err != nil || !inHead {
+			return true
+		}
+	}
+	return false
+}
+
+// isRejected returns true if the push was rejected because the repository has commits that aren't local
+func isRejected(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if strings.HasPrefix(err.Error(), git.ErrNonFastForwardUpdate.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// branchRefSpecs returns the references to push the branch
+func branchRefSpecs(branch plumbing.ReferenceName) []gitconfig.RefSpec {
+	return []gitconfig.RefSpec{gitconfig.RefSpec(branch + ":" + branch)}
+}
+
+// pushRemotes pushes the references to every repository of the server, the default ones of git if empty.
+// The diverged mirrors are skipped. It fails if the primary repository rejects the push, so the mirrors
+// don't fork from it, or if none of them could be pushed
+func (ss *SyncedServer) pushRemotes(ctx context.Context, refSpecs []gitconfig.RefSpec) error {
+	pushed := 0
+	upToDate := true
+	errs := []error{}
+	var rejectedErr error
+	diverged := ss.divergedMirrors()
+	for _, gitURL := range ss.GetRemoteURLs() {
+		if diverged[ss.remoteName(gitURL)] {
+			continue
+		}
+		err := withRetry(ctx, "Push", gitURL, func(ctx context.Context) error {
+			return ss.repo.PushContext(ctx, &git.PushOptions{
+				RemoteName: ss.remoteName(gitURL),
+				RefSpecs:   refSpecs,
+				Auth:       config.GitAuth,
+				Progress:   utils.Output,
+			})
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isRemoteOK(err) {
+			ss.recordRemoteResult(gitURL, nil)
+			pushed++
+			upToDate = upToDate && err == git.NoErrAlreadyUpToDate
+		} else if isRejected(err) {
+			ss.recordRemoteResult(gitURL, nil) // reachable, just ahead of us
+			if gitURL == ss.GitURL {
+				return err
+			}
+			rejectedErr = err
+		} else {
+			ss.recordRemoteResult(gitURL, err)
+			errs = append(errs, err)
+		}
+	}
+
+	if pushed == 0 && rejectedErr != nil {
+		return rejectedErr
+	} else if pushed == 0 {
+		return remotesFailed(errs)
+	}
+	if upToDate {
+		return git.NoErrAlreadyUpToDate
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package syncedpz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syncedpz/config"
+
+	"github.com/dgraph-io/badger"
+	"github.com/go-git/go-git/v5"
+)
+
+// ServerInfoFilename is the file in the server repository with its name, used by the other players to
+// follow a rename
+const ServerInfoFilename = "server.json"
+
+// ServerInfo is the content of ServerInfoFilename
+type ServerInfo struct {
+	Name          string   `json:"name"`
+	PreviousNames []string `json:"previous_names"`
+}
+
+// readServerInfo reads ServerInfoFilename of the server repository, it only exists after the server is
+// renamed
+func readServerInfo(serverPath string) (*ServerInfo, error) {
+	data, err := os.ReadFile(filepath.Join(serverPath, ServerInfoFilename))
+	if err != nil {
+		return nil, err
+	}
+	info := &ServerInfo{}
+	return info, json.Unmarshal(data, info)
+}
+
+// isServerFile returns true if the filename is one of the files of the server in the PZ Server folder,
+// like <name>.ini or <name>_SandboxVars.lua
+func isServerFile(filename, name string) bool {
+	rest, ok := strings.CutPrefix(filename, name)
+	return ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "_"))
+}
+
+// renameServerFiles renames the files of the server in the folder from the old name to the new one
+func renameServerFiles(dir, oldName, newName string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if !isServerFile(entry.Name(), oldName) {
+			continue
+		}
+		newFilename := newName + strings.TrimPrefix(entry.Name(), oldName)
+		if err := os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(dir, newFilename)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renamePath renames the file or folder if it exists, failing if the new one already exists
+func renamePath(oldPath, newPath string) error {
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("%s already exists", newPath)
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// validateNewName checks if the server can be renamed to the name without overwriting anything
+func (ss SyncedServer) validateNewName(newName string) error {
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\:*?"<>|`) {
+		return fmt.Errorf("invalid server name: %q", newName)
+	}
+	if newName == ss.Name {
+		return errors.New("the server already has this name")
+	}
+	if _, err := GetSyncedServer(newName); err == nil {
+		return fmt.Errorf("a synced server named %q already exists", newName)
+	}
+
+	newSS := SyncedServer{Server: Server{Name: newName}}
+	if _, err := os.Stat(newSS.GetServerPath()); err == nil {
+		return fmt.Errorf("%s already exists", newSS.GetServerPath())
+	}
+	newNameWithUnderScore := strings.ReplaceAll(newName, " ", "_")
+	if _, err := os.Stat(filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer", newNameWithUnderScore)); err == nil {
+		return fmt.Errorf("a local save named %s already exists", newNameWithUnderScore)
+	}
+	return nil
+}
+
+// renameLocal renames the local files of the server: the config files, the save, the player save folders
+// and the server database (db/<name>.db)
+func (ss SyncedServer) renameLocal(newName string) error {
+	ss.logger().Info("Renaming local server files")
+
+	if err := renameServerFiles(filepath.Join(config.PZ_DataPath, "Server"), ss.Name, newName); err != nil {
+		return err
+	}
+	if err := renameServerFiles(filepath.Join(config.PZ_DataPath, "db"), ss.Name, newName); err != nil {
+		return err
+	}
+
+	pzSaveFilesPath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	oldNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
+	newNameWithUnderScore := strings.ReplaceAll(newName, " ", "_")
+
+	// Player folders are <name>_player or <host steam id>_<name>_player
+	playerFolders, err := ss.getLocalPlayerFolders()
+	if err != nil {
+		return err
+	}
+	for _, playerFolder := range playerFolders {
+		prefix, ok := strings.CutSuffix(playerFolder.Name(), oldNameWithUnderScore+"_player")
+		if !ok || (prefix != "" && !strings.HasSuffix(prefix, "_")) {
+			continue
+		}
+		err := renamePath(filepath.Join(pzSaveFilesPath, playerFolder.Name()), filepath.Join(pzSaveFilesPath, prefix+newNameWithUnderScore+"_player"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return renamePath(filepath.Join(pzSaveFilesPath, oldNameWithUnderScore), filepath.Join(pzSaveFilesPath, newNameWithUnderScore))
+}
+
+// relink moves everything kept by SyncedPZ under the server name to the new name: the local files, the
+// server repository, the backups, the database keys and the recorded syncs
+func (ss *SyncedServer) relink(newName string) error {
+	oldSS := *ss
+	newSS := *ss
+	newSS.Name = newName
+
+	if err := ss.renameLocal(newName); err != nil {
+		return err
+	}
+	if err := renamePath(oldSS.GetServerPath(), newSS.GetServerPath()); err != nil {
+		return err
+	}
+	if err := renamePath(oldSS.GetBackupsPath(), newSS.GetBackupsPath()); err != nil {
+		return err
+	}
+
+	conflicts := oldSS.GetConflicts()
+	for i := range conflicts {
+		if isServerFile(conflicts[i].File, oldSS.Name) {
+			conflicts[i].File = newName + strings.TrimPrefix(conflicts[i].File, oldSS.Name)
+		}
+	}
+
+	err := config.DB.Update(func(txn *badger.Txn) error {
+		// Keys whose value doesn't depend on the name are moved as they are
+		movedKeys := [][2][]byte{
+			{oldSS.getPlayerFoldersFingerprintKey(), newSS.getPlayerFoldersFingerprintKey()},
+			{oldSS.getRemotesHealthKey(), newSS.getRemotesHealthKey()},
+			{oldSS.getLastSyncKey(), newSS.getLastSyncKey()},
+		}
+		for _, keys := range movedKeys {
+			item, err := txn.Get(keys[0])
+			if err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(keys[1], value); err != nil {
+				return err
+			}
+			if err := txn.Delete(keys[0]); err != nil {
+				return err
+			}
+		}
+
+		if err := txn.Delete(oldSS.getConflictsKey()); err != nil {
+			return err
+		}
+		if err := txn.Delete(oldSS.GetKey()); err != nil {
+			return err
+		}
+		data, err := newSS.Serialize()
+		if err != nil {
+			return err
+		}
+		return txn.Set(newSS.GetKey(), data)
+	})
+	if err != nil {
+		return err
+	}
+	if err := renameSyncRuns(oldSS.Name, newName); err != nil {
+		return err
+	}
+
+	ss.Name = newName
+	if ss.run != nil {
+		ss.run.Server = newName
+	}
+	if err := ss.saveConflicts(conflicts); err != nil {
+		return err
+	}
+
+	// The repository moved with its folder
+	ss.repo, err = git.PlainOpen(ss.GetServerPath())
+	if err != nil {
+		return err
+	}
+
+	ss.logger().Infof("Server renamed from %s to %s", oldSS.Name, newName)
+	return nil
+}
+
+// Rename renames the server everywhere: the local files, the server repository and the database.
+// The rename is committed and pushed, and the other players follow it on their next pull
+func (ss *SyncedServer) Rename(ctx context.Context, newName string) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	newName = strings.TrimSpace(newName)
+	if err := ss.validateNewName(newName); err != nil {
+		return err
+	}
+
+	// Renames the latest version of the server
+	if changes, err := ss.TryPull(ctx); err != nil {
+		return err
+	} else if changes {
+		if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+			return err
+		}
+	}
+
+	ss.logger().Infof("Renaming %s to %s", ss.Name, newName)
+
+	info, err := readServerInfo(ss.GetServerPath())
+	if err != nil {
+		info = &ServerInfo{}
+	}
+	info.PreviousNames = append(info.PreviousNames, ss.Name)
+	info.Name = newName
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(ss.GetServerPath(), ServerInfoFilename), data, 0644); err != nil {
+		return err
+	}
+	if err := renameServerFiles(filepath.Join(ss.GetServerPath(), "config"), ss.Name, newName); err != nil {
+		return err
+	}
+
+	oldName := ss.Name
+	if err := ss.relink(newName); err != nil {
+		return err
+	}
+
+	if err := ss.CommitWithMessage(fmt.Sprintf("SyncedPZ: %s renamed %s to %s", config.PZ_SteamID, oldName, newName)); err != nil {
+		return err
+	}
+	return ss.TryPush(ctx)
+}
+
+// followRename renames the server if it was renamed by another player, after a pull
+func (ss *SyncedServer) followRename() error {
+	info, err := readServerInfo(ss.GetServerPath())
+	if err != nil || info.Name == ss.Name {
+		return nil
+	}
+
+	ss.logger().Infof("%s was renamed to %s by another player, following it", ss.Name, info.Name)
+	if err := ss.validateNewName(info.Name); err != nil {
+		return fmt.Errorf("could not follow the rename of %s to %s: %w", ss.Name, info.Name, err)
+	}
+	return ss.relink(info.Name)
+}
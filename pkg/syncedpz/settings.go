@@ -0,0 +1,166 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syncedpz/config"
+	"syncedpz/pkg/pzconfig"
+
+	cp "github.com/otiai10/copy"
+)
+
+// ServerSetting is a setting of the server config files (.ini and SandboxVars.lua)
+type ServerSetting struct {
+	pzconfig.Setting
+	Value string // value without the quotes of lua strings
+	Known bool   // if the setting is in the schema of known settings
+}
+
+// getSettingsFilePath returns the path of the local settings file
+func (ss SyncedServer) getSettingsFilePath(sf pzconfig.SettingsFile) string {
+	return filepath.Join(config.PZ_DataPath, "Server", sf.Filename(ss.Name))
+}
+
+func (ss SyncedServer) parseSettingsFile(sf pzconfig.SettingsFile) (*pzconfig.File, error) {
+	path := ss.getSettingsFilePath(sf)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return pzconfig.Parse(path, data)
+}
+
+func newServerSetting(sf pzconfig.SettingsFile, key, raw string) ServerSetting {
+	setting, known := pzconfig.LookupSetting(key)
+	if !known || setting.File != sf {
+		setting = pzconfig.Setting{
+			Key:  key,
+			File: sf,
+			Type: pzconfig.InferType(sf.Format(), raw),
+		}
+		known = false
+	}
+
+	return ServerSetting{
+		Setting: setting,
+		Value:   pzconfig.DisplayValue(sf.Format(), raw),
+		Known:   known,
+	}
+}
+
+// ListSettings returns every setting of the local server config files
+func (ss SyncedServer) ListSettings() ([]ServerSetting, error) {
+	settings := []ServerSetting{}
+	for _, sf := range []pzconfig.SettingsFile{pzconfig.ServerINI, pzconfig.SandboxVars} {
+		file, err := ss.parseSettingsFile(sf)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range file.Entries() {
+			settings = append(settings, newServerSetting(sf, e.Key, e.Value))
+		}
+	}
+	return settings, nil
+}
+
+// findSetting returns the file where the setting is, looking first at the schema of known settings
+// and then at the .ini and SandboxVars.lua files
+func (ss SyncedServer) findSetting(key string) (pzconfig.SettingsFile, *pzconfig.File, string, error) {
+	if setting, ok := pzconfig.LookupSetting(key); ok {
+		file, err := ss.parseSettingsFile(setting.File)
+		return setting.File, file, setting.Key, err
+	}
+
+	for _, sf := range []pzconfig.SettingsFile{pzconfig.ServerINI, pzconfig.SandboxVars} {
+		file, err := ss.parseSettingsFile(sf)
+		if err != nil {
+			return 0, nil, "", err
+		}
+		if _, ok := file.Get(key); ok {
+			return sf, file, key, nil
+		}
+	}
+	return 0, nil, "", fmt.Errorf("setting %s not found", key)
+}
+
+// GetSetting returns a setting of the local server config files
+func (ss SyncedServer) GetSetting(key string) (ServerSetting, error) {
+	sf, file, key, err := ss.findSetting(key)
+	if err != nil {
+		return ServerSetting{}, err
+	}
+
+	raw, ok := file.Get(key)
+	if !ok {
+		return ServerSetting{}, fmt.Errorf("setting %s is not set in %s", key, sf.Filename(ss.Name))
+	}
+	return newServerSetting(sf, key, raw), nil
+}
+
+// SetSetting changes a setting in the local server config files, keeping their comments and ordering,
+// and commits and pushes the change to the synced server. While offline the change is queued and pushed
+// on the next sync
+func (ss *SyncedServer) SetSetting(ctx context.Context, key, value string) error {
+	// Gets the latest version of the config files before changing them, pushing the local changes first
+	// so they aren't overwritten
+	if err := ss.Sync(ctx); err != nil && !errors.Is(err, ErrOffline) {
+		return err
+	}
+
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	sf, file, key, err := ss.findSetting(key)
+	if err != nil {
+		return err
+	}
+
+	oldRaw, exists := file.Get(key)
+	setting := newServerSetting(sf, key, oldRaw)
+	if !exists {
+		setting = newServerSetting(sf, key, value)
+	}
+	if err := setting.Validate(value); err != nil {
+		return err
+	}
+	if exists && setting.Value == value {
+		ss.logger().Infof("%s is already %s", key, value)
+		return nil
+	}
+
+	err = file.Set(key, pzconfig.RawValue(sf.Format(), value, setting.Type))
+	if err != nil {
+		return err
+	}
+	localPath := ss.getSettingsFilePath(sf)
+	if err := os.WriteFile(localPath, file.Bytes(), 0644); err != nil {
+		return err
+	}
+	ss.logger().Infof("%s set to %s", key, value)
+
+	ss.EnsureDirs()
+	syncedPath := filepath.Join(ss.GetServerPath(), "config", sf.Filename(ss.Name))
+	if err := cp.Copy(localPath, syncedPath); err != nil {
+		return err
+	}
+
+	commitMsg := fmt.Sprintf("SyncedPZ: %s set %s to %s", config.PZ_SteamID, key, value)
+	if exists {
+		commitMsg += fmt.Sprintf(" (was %s)", setting.Value)
+	}
+	if err := ss.CommitWithMessage(commitMsg); err != nil {
+		return err
+	}
+	if err := ss.TryPush(ctx); errors.Is(err, ErrOffline) {
+		ss.logger().Warn("No repository is reachable, the change was queued and will be pushed on the next sync")
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,13 +1,14 @@
 package syncedpz
 
 import (
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"syncedpz/config"
-	"syncedpz/pkg/utils"
+	"time"
 
-	"github.com/charmbracelet/log"
 	"github.com/dgraph-io/badger"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 )
@@ -48,12 +49,12 @@ func LoadPzDirs() error {
 	return nil
 }
 
-func SetupPzDirs(PZ_ExePath, PZ_DataPath string) {
+func SetupPzDirs(PZ_ExePath, PZ_DataPath string) error {
 	if _, err := os.Stat(PZ_ExePath); os.IsNotExist(err) {
-		log.Fatalf("%s dir does not exists\n", PZ_ExePath)
+		return fmt.Errorf("%s dir does not exists\n", PZ_ExePath)
 	}
 	if _, err := os.Stat(PZ_DataPath); os.IsNotExist(err) {
-		log.Fatalf("%s dir does not exists\n", PZ_DataPath)
+		return fmt.Errorf("%s dir does not exists\n", PZ_DataPath)
 	}
 
 	err := config.DB.Update(func(txn *badger.Txn) error {
@@ -64,9 +65,11 @@ func SetupPzDirs(PZ_ExePath, PZ_DataPath string) {
 		err = txn.Set([]byte("pz_data_path"), []byte(PZ_DataPath))
 		return err
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	utils.HandleErr(LoadPzDirs())
+	return LoadPzDirs()
 }
 
 func LoadSteamID() error {
@@ -91,18 +94,20 @@ func LoadSteamID() error {
 	return nil
 }
 
-func SetupSteamId(steamID string) {
+func SetupSteamId(steamID string) error {
 	if steamID == "" {
-		log.Fatal("Steam ID cannot be empty")
+		return fmt.Errorf("Steam ID cannot be empty")
 	}
 
 	err := config.DB.Update(func(txn *badger.Txn) error {
 		err := txn.Set([]byte("steam_id"), []byte(steamID))
 		return err
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	utils.HandleErr(LoadSteamID())
+	return LoadSteamID()
 }
 
 func LoadGitAuth() error {
@@ -143,9 +148,9 @@ func LoadGitAuth() error {
 	return nil
 }
 
-func SetupGitAuth(username, password string) {
+func SetupGitAuth(username, password string) error {
 	if username == "" || password == "" {
-		log.Fatal("Git username or password cannot be empty")
+		return fmt.Errorf("Git username or password cannot be empty")
 	}
 
 	err := config.DB.Update(func(txn *badger.Txn) error {
@@ -156,9 +161,11 @@ func SetupGitAuth(username, password string) {
 		err = txn.Set([]byte("git_password"), []byte(password))
 		return err
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	utils.HandleErr(LoadGitAuth())
+	return LoadGitAuth()
 }
 
 func LoadLanguage() error {
@@ -183,9 +190,9 @@ func LoadLanguage() error {
 	return nil
 }
 
-func SetupLanguage(lang int) {
+func SetupLanguage(lang int) error {
 	if !config.IsLanguageValid(lang) {
-		log.Fatal("Invalid language")
+		return fmt.Errorf("Invalid language")
 	}
 
 	err := config.DB.Update(func(txn *badger.Txn) error {
@@ -194,7 +201,153 @@ func SetupLanguage(lang int) {
 		err := txn.Set([]byte("language"), val)
 		return err
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
+
+	return LoadLanguage()
+}
+
+// LoadBackupPolicy loads the retention policy of the local backups, keeping the defaults if it was never set
+func LoadBackupPolicy() error {
+	err := config.DB.View(func(txn *badger.Txn) error {
+		values := map[string]*int{
+			"backup_max_count":    &config.BackupMaxCount,
+			"backup_max_age_days": &config.BackupMaxAgeDays,
+			"backup_max_size_mb":  &config.BackupMaxSizeMB,
+		}
+		for key, value := range values {
+			item, err := txn.Get([]byte(key))
+			if err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			err = item.Value(func(val []byte) error {
+				*value = int(binary.BigEndian.Uint32(val))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func SetupBackupPolicy(maxCount, maxAgeDays, maxSizeMB int) error {
+	if maxCount < 0 || maxAgeDays < 0 || maxSizeMB < 0 {
+		return fmt.Errorf("Backup retention values cannot be negative")
+	}
+
+	err := config.DB.Update(func(txn *badger.Txn) error {
+		values := map[string]int{
+			"backup_max_count":    maxCount,
+			"backup_max_age_days": maxAgeDays,
+			"backup_max_size_mb":  maxSizeMB,
+		}
+		for key, value := range values {
+			val := make([]byte, 4)
+			binary.BigEndian.PutUint32(val, uint32(value))
+			if err := txn.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return LoadBackupPolicy()
+}
+
+// LoadNetworkPolicy loads the timeout and retries of the network operations, keeping the defaults if they
+// were never set
+func LoadNetworkPolicy() error {
+	err := config.DB.View(func(txn *badger.Txn) error {
+		timeoutSeconds := int(config.NetworkTimeout / time.Second)
+		backoffSeconds := int(config.NetworkBackoff / time.Second)
+		values := map[string]*int{
+			"network_timeout_seconds": &timeoutSeconds,
+			"network_retries":         &config.NetworkRetries,
+			"network_backoff_seconds": &backoffSeconds,
+		}
+		for key, value := range values {
+			item, err := txn.Get([]byte(key))
+			if err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			err = item.Value(func(val []byte) error {
+				*value = int(binary.BigEndian.Uint32(val))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		config.NetworkTimeout = time.Duration(timeoutSeconds) * time.Second
+		config.NetworkBackoff = time.Duration(backoffSeconds) * time.Second
+		return nil
+	})
+	return err
+}
+
+func SetupNetworkPolicy(timeoutSeconds, retries, backoffSeconds int) error {
+	if timeoutSeconds <= 0 || retries < 0 || backoffSeconds < 0 {
+		return fmt.Errorf("The network timeout must be positive and the retries and backoff cannot be negative")
+	}
+
+	err := config.DB.Update(func(txn *badger.Txn) error {
+		values := map[string]int{
+			"network_timeout_seconds": timeoutSeconds,
+			"network_retries":         retries,
+			"network_backoff_seconds": backoffSeconds,
+		}
+		for key, value := range values {
+			val := make([]byte, 4)
+			binary.BigEndian.PutUint32(val, uint32(value))
+			if err := txn.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return LoadNetworkPolicy()
+}
+
+// LoadAPIToken loads the token of the local API, generating and saving a random one the first time
+func LoadAPIToken() error {
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("api_token"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			config.APIToken = string(val)
+			return nil
+		})
+	})
+	if err != badger.ErrKeyNotFound {
+		return err
+	}
 
-	utils.HandleErr(LoadLanguage())
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	config.APIToken = hex.EncodeToString(token)
+	return config.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("api_token"), []byte(config.APIToken))
+	})
 }
@@ -0,0 +1,140 @@
+package syncedpz
+
+import (
+	"path/filepath"
+	"strings"
+	"syncedpz/pkg/pzsave"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitInfo is a snapshot of the server in its repository history
+type CommitInfo struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	// Tags of the snapshot, set by GetHistory
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Subject returns the first line of the commit message
+func (ci CommitInfo) Subject() string {
+	subject, _, _ := strings.Cut(ci.Message, "\n")
+	return strings.TrimSpace(subject)
+}
+
+// Body returns the lines of the commit message after the subject, like the save metadata
+func (ci CommitInfo) Body() []string {
+	_, body, _ := strings.Cut(strings.TrimSpace(ci.Message), "\n")
+	lines := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func newCommitInfo(commit *object.Commit) CommitInfo {
+	return CommitInfo{
+		Hash:    commit.Hash.String(),
+		Author:  commit.Author.Name,
+		Time:    commit.Author.When,
+		Message: commit.Message,
+	}
+}
+
+// ServerStatus is a summary of the state of a synced server
+type ServerStatus struct {
+	Name       string           `json:"name"`
+	GitURL     string           `json:"git_url"`
+	Branch     string           `json:"branch"`
+	Players    []string         `json:"players"`
+	LastCommit *CommitInfo      `json:"last_commit"`
+	Metadata   *pzsave.Metadata `json:"metadata"`
+	Conflicts  int              `json:"conflicts"`
+	// Snapshots committed while offline, not pushed yet
+	Queued   int       `json:"queued"`
+	LastSync *LastSync `json:"last_sync"`
+	// Health of every repository of the server, the primary one first
+	Remotes []RemoteHealth `json:"remotes"`
+}
+
+// GetSaveMetadata reads the metadata of the synced save
+func (ss SyncedServer) GetSaveMetadata() (*pzsave.Metadata, error) {
+	return pzsave.ReadMetadata(filepath.Join(ss.GetServerPath(), "save"))
+}
+
+// GetStatus returns the status of the server, as it is in the server repository
+func (ss *SyncedServer) GetStatus() (ServerStatus, error) {
+	players, err := ss.GetPlayers()
+	if err != nil {
+		return ServerStatus{}, err
+	}
+	status := ServerStatus{
+		Name:      ss.Name,
+		GitURL:    ss.GitURL,
+		Players:   players,
+		Conflicts: len(ss.GetConflicts()),
+		Queued:    len(ss.GetQueuedSnapshots()),
+		LastSync:  ss.GetLastSync(),
+	}
+
+	if branch, ok := ss.currentBranch(); ok {
+		status.Branch = branch.Short()
+	}
+
+	health := ss.GetRemotesHealth()
+	for _, gitURL := range ss.GetRemoteURLs() {
+		rh := health[gitURL]
+		rh.URL = gitURL
+		status.Remotes = append(status.Remotes, rh)
+	}
+
+	history, err := ss.GetHistory(1)
+	if err != nil {
+		return ServerStatus{}, err
+	}
+	if len(history) > 0 {
+		status.LastCommit = &history[0]
+	}
+	if metadata, err := ss.GetSaveMetadata(); err == nil {
+		status.Metadata = metadata
+	}
+	return status, nil
+}
+
+// GetHistory returns the last snapshots of the server, the most recent first.
+// A limit <= 0 returns the whole history
+func (ss *SyncedServer) GetHistory(limit int) ([]CommitInfo, error) {
+	if err := ss.openRepo(); err != nil {
+		return nil, err
+	}
+
+	history := []CommitInfo{}
+	head, err := ss.repo.Head()
+	if err != nil {
+		return history, nil // no commits yet
+	}
+
+	commits, err := ss.repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+
+	tags := ss.getCommitTags()
+	for limit <= 0 || len(history) < limit {
+		commit, err := commits.Next()
+		if err != nil {
+			break
+		}
+		info := newCommitInfo(commit)
+		info.Tags = tags[commit.Hash]
+		history = append(history, info)
+	}
+	return history, nil
+}
@@ -0,0 +1,167 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syncedpz/config"
+	"syncedpz/pkg/utils"
+
+	"github.com/charmbracelet/log"
+)
+
+// getLockPath returns the path of the file locked while the server is synced
+func (ss SyncedServer) getLockPath() string {
+	return filepath.Join(config.LocksPath, ss.Name+".lock")
+}
+
+// lock waits until no other SyncedPZ process is syncing the server, then locks it until Unlock.
+// The lock is released by the operating system if the process dies
+func (ss SyncedServer) lock(ctx context.Context) (*utils.FileLock, error) {
+	lock, err := utils.TryLockFile(ss.getLockPath())
+	if err == utils.ErrLocked {
+		ss.logger().Infof("%s is being synced by another SyncedPZ process, waiting for it", ss.Name)
+		lock, err = utils.LockFile(ctx, ss.getLockPath())
+	}
+	return lock, err
+}
+
+// IsLocked returns true if the server is being synced by a SyncedPZ process
+func (ss SyncedServer) IsLocked() bool {
+	lock, err := utils.TryLockFile(ss.getLockPath())
+	if err != nil {
+		return err == utils.ErrLocked
+	}
+	lock.Unlock()
+	return false
+}
+
+// Sync syncs the server with its git repositories. When only one side changed since the last sync its
+// changes are copied to the other, when both changed a DivergenceError is returned and nothing is
+// overwritten.
+// When no repository is reachable the local changes are committed and queued, to be pushed on a later
+// sync, and ErrOffline is returned.
+// When the context is done the sync stops at the next safe point, rolling back any partial copy.
+// The lock of the server, the divergences and the failures are notified to the webhooks, and every run is
+// recorded
+func (ss *SyncedServer) Sync(ctx context.Context) (err error) {
+	defer func() {
+		ss.notifySyncError(err)
+	}()
+
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	notify(WebhookEvent{
+		Event:   EventLockAcquired,
+		Server:  ss.Name,
+		Message: fmt.Sprintf(config.GTM("%s is syncing %s"), config.PZ_SteamID, ss.Name),
+	})
+	defer func() {
+		lock.Unlock()
+		notify(WebhookEvent{
+			Event:   EventLockReleased,
+			Server:  ss.Name,
+			Message: fmt.Sprintf(config.GTM("%s finished syncing %s"), config.PZ_SteamID, ss.Name),
+		})
+	}()
+
+	if err := ss.openRepo(); err != nil {
+		return err
+	}
+	ss.startSyncRun()
+	defer func() {
+		ss.finishSyncRun(err)
+	}()
+	ctx = log.WithContext(ctx, ss.logger())
+
+	if len(ss.GetQueuedSnapshots()) > 0 {
+		// The local changes join the queue before flushing it
+		if err := ss.CopyLocalServerToSynced(ctx); err != nil {
+			return err
+		}
+		if err := ss.commitVerified(); err != nil {
+			return err
+		}
+		err = ss.flushQueue(ctx)
+	} else {
+		err = ss.syncOnline(ctx)
+	}
+
+	if errors.Is(err, ErrOffline) {
+		ss.logger().Warn("No repository is reachable, the local changes were queued and will be pushed on the next sync")
+	} else if err != nil {
+		return err
+	}
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return err
+	}
+	if err == nil {
+		ss.saveLastSync()
+	}
+	return err
+}
+
+// syncOnline pulls the changes of the server when there are no local ones, or pushes the local changes
+// when there are none in the server. When both changed and they can't be rebased the local changes are
+// committed without being pushed and a DivergenceError is returned.
+// The local save is compared with the last sync, so a pull that couldn't be copied to it isn't undone by
+// pushing the files it missed
+func (ss *SyncedServer) syncOnline(ctx context.Context) error {
+	changes, err := ss.TryFetch(ctx)
+	if errors.Is(err, ErrOffline) {
+		if err := ss.CopyLocalServerToSynced(ctx); err != nil {
+			return err
+		}
+		if err := ss.commitVerified(); err != nil {
+			return err
+		}
+		return ErrOffline
+	} else if err != nil {
+		return err
+	}
+
+	if err := ss.CopyLocalServerToSynced(ctx); err != nil {
+		return err
+	}
+	reapplied, err := ss.reapplyPull()
+	if err != nil {
+		var divergence *DivergenceError
+		if !errors.As(err, &divergence) {
+			return ss.restoreAfter(err)
+		}
+		return err
+	}
+	localChanges, err := ss.hasLocalChanges()
+	if err != nil {
+		return ss.restoreAfter(err)
+	}
+
+	switch {
+	case changes && !localChanges:
+		// Only the server changed
+		if _, err := ss.TryPull(ctx); err != nil {
+			return err
+		}
+		return ss.CopySyncedServerToLocal(ctx)
+	case changes:
+		// Both changed, the local changes are committed and rebased on the ones of the server when they
+		// changed different files, otherwise they wait until the player chooses what to do
+		ss.logger().Warn("The server and the local save both changed since the last sync")
+		if err := ss.commitVerified(); err != nil {
+			return err
+		}
+		return ss.flushQueue(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return ss.restoreAfter(err)
+	}
+	if err := ss.CommitAndPush(ctx); err != nil || !reapplied {
+		return err
+	}
+	// Copies the missed pull to the local server
+	return ss.CopySyncedServerToLocal(ctx)
+}
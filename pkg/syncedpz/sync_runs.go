@@ -0,0 +1,223 @@
+package syncedpz
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"syncedpz/config"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/dgraph-io/badger"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Directions of a sync run
+const (
+	DirectionNone = "none"
+	DirectionPull = "pull"
+	DirectionPush = "push"
+	DirectionBoth = "both"
+)
+
+// SyncRun is the record of a sync of a server
+type SyncRun struct {
+	// Added to every log of the sync, to find them in the log files
+	ID     string    `json:"id"`
+	Server string    `json:"server"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// none, pull, push or both
+	Direction string `json:"direction"`
+	// Files of the snapshot changed by the sync and their size
+	FilesChanged int    `json:"files_changed"`
+	Bytes        int64  `json:"bytes"`
+	Commit       string `json:"commit,omitempty"`
+	Error        string `json:"error,omitempty"`
+
+	before plumbing.Hash
+	pulled bool
+	pushed bool
+	// Logs of the sync, with the ID of the run
+	logger *log.Logger
+}
+
+// Duration returns how long the sync took
+func (run SyncRun) Duration() time.Duration {
+	return run.End.Sub(run.Start)
+}
+
+// syncRunKey returns the key of the run in the database, sorted by its start
+func syncRunKey(run SyncRun) []byte {
+	return []byte(fmt.Sprintf("sync_run_%020d_%s", run.Start.UnixNano(), run.Server))
+}
+
+// newRunID returns a random ID for a sync run
+func newRunID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// startSyncRun starts recording a sync of the server, the pulls and pushes are recorded until it's finished.
+// Meanwhile the logs of the server have the ID of the run
+func (ss *SyncedServer) startSyncRun() {
+	id := newRunID()
+	ss.run = &SyncRun{ID: id, Server: ss.Name, Start: time.Now(), logger: log.Default().With("run", id)}
+	ss.logger().Infof("Syncing %s", ss.Name)
+	if head, err := ss.repo.Head(); err == nil {
+		ss.run.before = head.Hash()
+	}
+}
+
+// finishSyncRun saves the run with the changes of the snapshot since it started and its error
+func (ss *SyncedServer) finishSyncRun(err error) {
+	run := ss.run
+	if run == nil {
+		return
+	}
+	defer func() {
+		ss.run = nil
+	}()
+
+	run.End = time.Now()
+	switch {
+	case run.pulled && run.pushed:
+		run.Direction = DirectionBoth
+	case run.pulled:
+		run.Direction = DirectionPull
+	case run.pushed:
+		run.Direction = DirectionPush
+	default:
+		run.Direction = DirectionNone
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	ss.logger().Infof("Sync of %s finished in %s, direction %s", ss.Name, run.Duration().Round(time.Millisecond), run.Direction)
+	if head, err := ss.repo.Head(); err == nil {
+		run.Commit = head.Hash().String()
+		if head.Hash() != run.before {
+			run.FilesChanged, run.Bytes = ss.diffStats(run.before, head.Hash())
+		}
+	}
+
+	var buff bytes.Buffer
+	if err := gob.NewEncoder(&buff).Encode(run); err != nil {
+		ss.logger().Errorf("Could not record the sync of %s: %s", ss.Name, err)
+		return
+	}
+	err = config.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(syncRunKey(*run), buff.Bytes())
+	})
+	if err != nil {
+		ss.logger().Errorf("Could not record the sync of %s: %s", ss.Name, err)
+	}
+}
+
+// logger returns the logger of the server, the one of its sync run while it's syncing
+func (ss SyncedServer) logger() *log.Logger {
+	if ss.run != nil {
+		return ss.run.logger
+	}
+	return log.Default()
+}
+
+// diffStats returns the number of files changed between two snapshots and the size of the new versions
+func (ss *SyncedServer) diffStats(from, to plumbing.Hash) (files int, size int64) {
+	toTree, err := ss.snapshotTree(to)
+	if err != nil {
+		return 0, 0
+	}
+	// The first snapshot is compared to an empty tree
+	fromTree := &object.Tree{}
+	if !from.IsZero() {
+		if fromTree, err = ss.snapshotTree(from); err != nil {
+			return 0, 0
+		}
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return 0, 0
+	}
+	for _, change := range changes {
+		files++
+		if change.To.Name == "" {
+			continue // deleted
+		}
+		if file, err := toTree.TreeEntryFile(&change.To.TreeEntry); err == nil {
+			size += file.Size
+		}
+	}
+	return files, size
+}
+
+func (ss *SyncedServer) snapshotTree(hash plumbing.Hash) (*object.Tree, error) {
+	commit, err := ss.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+// renameSyncRuns moves the recorded syncs of the server to its new name. The name is part of their keys
+func renameSyncRuns(oldName, newName string) error {
+	runs, err := GetSyncRuns(oldName, time.Time{})
+	if err != nil {
+		return err
+	}
+	// One transaction per run, a server synced for months has too many for a single one
+	for _, run := range runs {
+		oldKey := syncRunKey(run)
+		run.Server = newName
+
+		var buff bytes.Buffer
+		if err := gob.NewEncoder(&buff).Encode(run); err != nil {
+			return err
+		}
+		err := config.DB.Update(func(txn *badger.Txn) error {
+			if err := txn.Set(syncRunKey(run), buff.Bytes()); err != nil {
+				return err
+			}
+			return txn.Delete(oldKey)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSyncRuns returns the syncs started since the given time, of every server if the name is empty, from
+// the oldest to the newest
+func GetSyncRuns(serverName string, since time.Time) ([]SyncRun, error) {
+	runs := []SyncRun{}
+	err := config.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("sync_run_")
+		start := prefix
+		if !since.IsZero() {
+			start = syncRunKey(SyncRun{Start: since})
+		}
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			run := SyncRun{}
+			err := it.Item().Value(func(v []byte) error {
+				return gob.NewDecoder(bytes.NewReader(v)).Decode(&run)
+			})
+			if err != nil {
+				return err
+			}
+			if serverName == "" || run.Server == serverName {
+				runs = append(runs, run)
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
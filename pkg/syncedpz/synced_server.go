@@ -3,24 +3,38 @@ package syncedpz
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"syncedpz/config"
 	"syncedpz/pkg/utils"
 
-	"github.com/charmbracelet/log"
 	"github.com/dgraph-io/badger"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	cp "github.com/otiai10/copy"
 )
 
+// ErrUnpushedSnapshots is returned by Delete when deleting the server would lose snapshots that aren't in
+// any of its repositories
+var ErrUnpushedSnapshots = errors.New("the server has snapshots that couldn't be pushed")
+
 type SyncedServer struct {
 	Server
 	GitURL string
+	// Repositories kept in sync with GitURL, for redundancy
+	Mirrors []string
+	// Branch of the repositories synced, the one checked out when the server was added if empty
+	Branch string
 	repo   *git.Repository
+	// last synced commit before the latest pull, used as base for merging the config files
+	baseCommit plumbing.Hash
+	// Sync being recorded, nil outside Sync
+	run *SyncRun
 }
 
 // NewSyncedServer creates a new synced server object
@@ -37,74 +51,121 @@ func (ss SyncedServer) GetKey() []byte {
 }
 
 // Serialize serializes the server object
-func (ss SyncedServer) Serialize() []byte {
+func (ss SyncedServer) Serialize() ([]byte, error) {
 	var buff bytes.Buffer
 	enc := gob.NewEncoder(&buff)
-	err := enc.Encode(ss)
-	utils.HandleErr(err)
-	return buff.Bytes()
+	if err := enc.Encode(ss); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
 }
 
 // Save saves the server object to the database
-func (ss *SyncedServer) Save() {
-	err := config.DB.Update(func(txn *badger.Txn) error {
-		return txn.Set(ss.GetKey(), ss.Serialize())
+func (ss *SyncedServer) Save() error {
+	data, err := ss.Serialize()
+	if err != nil {
+		return err
+	}
+	err = config.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(ss.GetKey(), data)
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	log.Info("Server saved to database")
+	ss.logger().Info("Server saved to database")
+	return nil
 }
 
-// Delete deletes the server object from the database
-func (ss *SyncedServer) Delete() {
-	log.Info("Deleting server")
+// removePlayer removes the line with the steam id from players.txt
+func removePlayer(playersFilePath, steamID string) error {
+	file, err := os.Open(playersFilePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-	ss.Pull() // Avoid some conflicts
+	// Get all lines except the one with the steam id
+	scanner := bufio.NewScanner(file)
+	lines := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		line = strings.TrimSpace(line)
+		line = strings.Trim(line, "\n")
+		line = strings.Trim(line, "\r")
+		if line != steamID {
+			lines = append(lines, line)
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
 
-	// Remove line from players.txt where the steam id is
-	playersFilePath := filepath.Join(ss.GetServerPath(), "players.txt")
-	if _, err := os.Stat(playersFilePath); !os.IsNotExist(err) {
-		file, err := os.Open(playersFilePath)
-		utils.HandleErr(err)
+	// Rewrite the file with the new lines
+	var content strings.Builder
+	for _, line := range lines {
+		content.WriteString(line + "\n")
+	}
+	return os.WriteFile(playersFilePath, []byte(content.String()), 0644)
+}
 
-		// Get all lines except the one with the steam id
-		scanner := bufio.NewScanner(file)
-		lines := []string{}
-		for scanner.Scan() {
-			line := scanner.Text()
-			line = strings.TrimSpace(line)
-			line = strings.Trim(line, "\n")
-			line = strings.Trim(line, "\r")
-			if line != config.PZ_SteamID {
-				lines = append(lines, line)
-			}
-		}
-		utils.HandleErr(scanner.Err())
-		file.Close()
+// Delete removes the player from the server, pushes it and deletes the server repository and everything
+// kept about the server in the database. The local save is kept.
+// It refuses to delete the snapshots that aren't in any repository of the server, queued or because the
+// push failed, unless forced
+func (ss *SyncedServer) Delete(ctx context.Context, force bool) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
-		// Rewrite the file with the new lines
-		file, err = os.Create(playersFilePath)
-		utils.HandleErr(err)
+	ss.logger().Info("Deleting server")
 
-		for _, line := range lines {
-			_, err = file.WriteString(line + "\n")
-			utils.HandleErr(err)
-		}
-		file.Close()
+	if queued := ss.GetQueuedSnapshots(); len(queued) > 0 && !force {
+		return fmt.Errorf("%w: %d snapshots of %s aren't in any of its repositories yet", ErrUnpushedSnapshots, len(queued), ss.Name)
+	}
+
+	// Avoid some conflicts
+	if _, err := ss.TryPull(ctx); err != nil && !force {
+		return fmt.Errorf("%w: %w", ErrUnpushedSnapshots, err)
 	}
 
 	// Save the changes in repository for tracking purposes
-	ss.CommitAndPush()
+	if err := removePlayer(filepath.Join(ss.GetServerPath(), "players.txt"), config.PZ_SteamID); err != nil {
+		return err
+	}
+	if err := ss.CommitAndPush(ctx); err != nil && !force {
+		return fmt.Errorf("%w: %w", ErrUnpushedSnapshots, err)
+	}
 
-	err := os.RemoveAll(ss.GetServerPath())
-	utils.HandleErr(err)
+	if err := os.RemoveAll(ss.GetServerPath()); err != nil {
+		return err
+	}
 
 	err = config.DB.Update(func(txn *badger.Txn) error {
-		return txn.Delete(ss.GetKey())
+		keys := [][]byte{
+			ss.GetKey(),
+			ss.getLastSyncKey(),
+			ss.getRemotesHealthKey(),
+			ss.getPlayerFoldersFingerprintKey(),
+			ss.getConflictsKey(),
+		}
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	log.Info("Server deleted from database")
+	ss.logger().Info("Server deleted from database")
+	return nil
 }
 
 // Delete deletes the server object from the database
@@ -113,6 +174,7 @@ func (ss *SyncedServer) EnsureDirs() {
 	utils.EnsureDir(serverPath)
 	utils.EnsureDir(filepath.Join(serverPath, "config"))
 	utils.EnsureDir(filepath.Join(serverPath, "save"))
+	utils.EnsureDir(filepath.Join(serverPath, "players"))
 }
 
 // GetServerPath returns the path of the server repository
@@ -120,10 +182,21 @@ func (ss SyncedServer) GetServerPath() string {
 	return filepath.Join(config.ServersPath, ss.Name)
 }
 
-// CopyLocalServerToSynced copies the local server files to the synced server repository
-func (ss *SyncedServer) CopyLocalServerToSynced() {
-	log.Info("Copying local server to synced server")
+// CopyLocalServerToSynced copies the local server files to the synced server repository.
+// If the copy is interrupted the synced server is restored to its last commit
+func (ss *SyncedServer) CopyLocalServerToSynced(ctx context.Context) error {
+	ss.logger().Info("Copying local server to synced server")
 
+	if err := ss.copyLocalServerToSynced(ctx); err != nil {
+		ss.logger().Warnf("Copy to synced server stopped, rolling it back: %s", err)
+		return ss.restoreAfter(err)
+	}
+
+	ss.logger().Info("Local server copied to synced server")
+	return nil
+}
+
+func (ss *SyncedServer) copyLocalServerToSynced(ctx context.Context) error {
 	ss.EnsureDirs()
 
 	// copy config files
@@ -143,11 +216,13 @@ func (ss *SyncedServer) CopyLocalServerToSynced() {
 			if err != nil && !os.IsNotExist(err) {
 				return err
 			}
-			return cp.Copy(path, newConfigFilename)
+			return utils.CopyContext(ctx, path, newConfigFilename)
 		}
 		return nil
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
 	// copy save files
 	savePath := filepath.Join(ss.GetServerPath(), "save")
@@ -157,28 +232,78 @@ func (ss *SyncedServer) CopyLocalServerToSynced() {
 	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
 	fullLocalServerPath := filepath.Join(pzSaveFilesPath, ssNameWithUnderScore)
 
-	log.Info("Removing old save files at synced server")
-	err = os.RemoveAll(savePath)
-	utils.HandleErr(err)
+	ss.logger().Info("Removing old save files at synced server")
+	if err := os.RemoveAll(savePath); err != nil {
+		return err
+	}
 
-	log.Info("Copying new save files to synced server")
+	ss.logger().Info("Copying new save files to synced server")
 	utils.EnsureDir(savePath)
-	err = cp.Copy(fullLocalServerPath, savePath)
-	utils.HandleErr(err)
+	if err := utils.CopyContext(ctx, fullLocalServerPath, savePath); err != nil {
+		return err
+	}
 
-	log.Info("Local server copied to synced server")
+	if err := ss.CopyLocalPlayerToSynced(ctx); err != nil {
+		return err
+	}
+	return ss.UpdateModsFile()
 }
 
-func (ss *SyncedServer) CopySyncedServerToLocal() {
-	log.Info("Copying synced server to local server")
+// CopySyncedServerToLocal copies the synced server files to the local server. The local save is backed up
+// before being overwritten, and restored from the backup if the copy is interrupted
+func (ss *SyncedServer) CopySyncedServerToLocal(ctx context.Context) error {
+	ss.logger().Info("Copying synced server to local server")
 
-	// copy config files
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// copy save files
+	savePath := filepath.Join(ss.GetServerPath(), "save")
+	pzSaveFilesPath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	utils.EnsureDir(savePath)
+	utils.EnsureDir(pzSaveFilesPath)
+
+	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
+	fullLocalServerPath := filepath.Join(pzSaveFilesPath, ssNameWithUnderScore)
+
+	backup, err := ss.backupLocalOrFail("sync", true)
+	if err != nil {
+		return err
+	}
+
+	ss.logger().Info("Removing old save files at local server")
+	err = os.RemoveAll(fullLocalServerPath)
+	if err == nil {
+		ss.logger().Info("Copying new save files to local server")
+		utils.EnsureDir(fullLocalServerPath)
+		err = utils.CopyContext(ctx, savePath, fullLocalServerPath)
+	}
+	if err == nil {
+		err = ss.CopySyncedPlayerToLocal(ctx)
+	}
+	if err != nil {
+		ss.logger().Warnf("Copy to local server stopped, rolling it back: %s", err)
+		var rollbackErr error
+		if backup != nil {
+			rollbackErr = ss.RestoreBackup(backup.ID)
+		} else {
+			// There was no local save before the copy
+			rollbackErr = os.RemoveAll(fullLocalServerPath)
+		}
+		if rollbackErr != nil {
+			return fmt.Errorf("%w, and it couldn't be rolled back: %w", err, rollbackErr)
+		}
+		return err
+	}
+
+	// copy config files, after the save so an interrupted copy doesn't leave them ahead of it
 	configPath := filepath.Join(ss.GetServerPath(), "config")
 	pzConfigFilesPath := filepath.Join(config.PZ_DataPath, "Server")
 	utils.EnsureDir(configPath)
 	utils.EnsureDir(pzConfigFilesPath)
 
-	err := filepath.Walk(configPath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(configPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -186,69 +311,55 @@ func (ss *SyncedServer) CopySyncedServerToLocal() {
 		// Checks if the filename starts with the server name
 		if strings.HasPrefix(filepath.Base(path), ss.Name) {
 			newConfigFilename := filepath.Join(pzConfigFilesPath, filepath.Base(path))
+			if merged, err := ss.mergeConfigFile(path, newConfigFilename); merged || err != nil {
+				return err
+			}
 			err = os.Remove(newConfigFilename)
 			if err != nil && !os.IsNotExist(err) {
 				return err
 			}
-			return cp.Copy(path, newConfigFilename)
+			return utils.CopyContext(ctx, path, newConfigFilename)
 		}
 		return nil
 	})
-	utils.HandleErr(err)
-
-	// copy save files
-	savePath := filepath.Join(ss.GetServerPath(), "save")
-	pzSaveFilesPath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
-	utils.EnsureDir(savePath)
-	utils.EnsureDir(pzSaveFilesPath)
-
-	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
-	fullLocalServerPath := filepath.Join(pzSaveFilesPath, ssNameWithUnderScore)
-
-	log.Info("Removing old save files at local server")
-	err = os.RemoveAll(fullLocalServerPath)
-	utils.HandleErr(err)
-
-	log.Info("Copying new save files to local server")
-	utils.EnsureDir(fullLocalServerPath)
-	err = cp.Copy(savePath, fullLocalServerPath)
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	log.Info("Synced server copied to local server")
+	ss.logger().Info("Synced server copied to local server")
+	if ss.run != nil {
+		ss.run.pulled = true
+	}
+	return nil
 }
 
 // EnsureUpdatedPlayerSaveFolders ensures that the player save folders are updated for each possible host of the server.
 // In Project Zomboid, when player X is hosting, player Y's game will create a new player save folder having <SteamIDPlayerX> as suffix.
 // So this function ensures that every player save folders for this server are updated.
-func (ss *SyncedServer) EnsureUpdatedPlayerSaveFolders() {
-	log.Info("Ensuring updated player save folders")
+func (ss *SyncedServer) EnsureUpdatedPlayerSaveFolders() error {
+	ss.logger().Info("Ensuring updated player save folders")
 
 	playerSavePath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
 	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
 
-	entries, err := os.ReadDir(playerSavePath)
-	utils.HandleErr(err)
+	playerFolders, err := ss.getLocalPlayerFolders()
+	if err != nil || len(playerFolders) == 0 {
+		return err
+	}
+	mostRecentPlayerFolderName := playerFolders[0].Name()
 
-	playerFolders := []os.FileInfo{}
-	for _, entry := range entries {
-		hasNameInIt := strings.Contains(entry.Name(), ssNameWithUnderScore)
-		if hasNameInIt && strings.HasSuffix(entry.Name(), "_player") {
-			info, err := entry.Info()
-			utils.HandleErr(err)
-			playerFolders = append(playerFolders, info)
+	if ss.playerFoldersChanged() {
+		if _, err := ss.backupLocalOrFail("players", false); err != nil {
+			return err
 		}
 	}
-	if len(playerFolders) == 0 {
-		return
-	}
-
-	sort.Slice(playerFolders, func(i, j int) bool {
-		return playerFolders[i].ModTime().After(playerFolders[j].ModTime())
-	})
-	mostRecentPlayerFolderName := playerFolders[0].Name()
 
+	players, err := ss.GetPlayers()
+	if err != nil {
+		return err
+	}
 	// Ensures that a folder exist for every possible host
-	for _, player := range ss.GetPlayers() {
+	for _, player := range players {
 		var playerFolderName string
 		if player == config.PZ_SteamID {
 			playerFolderName = ssNameWithUnderScore + "_player"
@@ -260,8 +371,10 @@ func (ss *SyncedServer) EnsureUpdatedPlayerSaveFolders() {
 	}
 
 	// Ensures that the most recent player folder is the most recent for every possible host
-	entries, err = os.ReadDir(playerSavePath) // read again to get the updated list (if a new player folder was created)
-	utils.HandleErr(err)
+	entries, err := os.ReadDir(playerSavePath) // read again to get the updated list (if a new player folder was created)
+	if err != nil {
+		return err
+	}
 
 	for _, entry := range entries {
 		hasNameInIt := strings.Contains(entry.Name(), ssNameWithUnderScore)
@@ -269,27 +382,36 @@ func (ss *SyncedServer) EnsureUpdatedPlayerSaveFolders() {
 			if entry.Name() == mostRecentPlayerFolderName {
 				continue
 			}
-			err := os.RemoveAll(filepath.Join(playerSavePath, entry.Name()))
-			utils.HandleErr(err)
+			if err := os.RemoveAll(filepath.Join(playerSavePath, entry.Name())); err != nil {
+				return err
+			}
 
 			fullPathMostRecent := filepath.Join(playerSavePath, mostRecentPlayerFolderName)
 			fullPathCurrent := filepath.Join(playerSavePath, entry.Name())
-			err = cp.Copy(fullPathMostRecent, fullPathCurrent)
-			utils.HandleErr(err)
+			if err := cp.Copy(fullPathMostRecent, fullPathCurrent); err != nil {
+				return err
+			}
 		}
 	}
 
-	log.Info("Updated player save folders ensured")
+	if err := ss.savePlayerFoldersFingerprint(); err != nil {
+		return err
+	}
+
+	ss.logger().Info("Updated player save folders ensured")
+	return nil
 }
 
 // GetPlayers returns the list of players in the server
-func (ss SyncedServer) GetPlayers() []string {
+func (ss SyncedServer) GetPlayers() ([]string, error) {
 	playersFilePath := filepath.Join(ss.GetServerPath(), "players.txt")
 	players := []string{}
 
 	if _, err := os.Stat(playersFilePath); !os.IsNotExist(err) {
 		file, err := os.Open(playersFilePath)
-		utils.HandleErr(err)
+		if err != nil {
+			return nil, err
+		}
 		defer file.Close()
 
 		scanner := bufio.NewScanner(file)
@@ -300,22 +422,26 @@ func (ss SyncedServer) GetPlayers() []string {
 			line = strings.Trim(line, "\r")
 			players = append(players, line)
 		}
-		utils.HandleErr(scanner.Err())
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
 	}
 
-	return players
+	return players, nil
 }
 
 // UpdatePlayersFile updates the players file of the server.
 // It creates the file if it doesn't exist, otherwise ensures your steam id is in the file
-func (ss *SyncedServer) UpdatePlayersFile() {
-	log.Info("Updating players file")
+func (ss *SyncedServer) UpdatePlayersFile() error {
+	ss.logger().Info("Updating players file")
 
 	playersFilePath := filepath.Join(ss.GetServerPath(), "players.txt")
 	// if the file exists, ensure your steam id is in the file
 	if _, err := os.Stat(playersFilePath); !os.IsNotExist(err) {
 		file, err := os.Open(playersFilePath)
-		utils.HandleErr(err)
+		if err != nil {
+			return err
+		}
 		defer file.Close()
 
 		scanner := bufio.NewScanner(file)
@@ -330,26 +456,58 @@ func (ss *SyncedServer) UpdatePlayersFile() {
 				break
 			}
 		}
-		utils.HandleErr(scanner.Err())
+		if err := scanner.Err(); err != nil {
+			return err
+		}
 
 		if !found {
 			file, err := os.OpenFile(playersFilePath, os.O_APPEND|os.O_WRONLY, 0600)
-			utils.HandleErr(err)
+			if err != nil {
+				return err
+			}
 			defer file.Close()
 
-			_, err = file.WriteString(config.PZ_SteamID + "\n")
-			utils.HandleErr(err)
+			if _, err := file.WriteString(config.PZ_SteamID + "\n"); err != nil {
+				return err
+			}
 		}
 	} else { // otherwise create the file and write your steam id
 		file, err := os.Create(playersFilePath)
-		utils.HandleErr(err)
+		if err != nil {
+			return err
+		}
 		defer file.Close()
 
-		_, err = file.WriteString(config.PZ_SteamID + "\n")
-		utils.HandleErr(err)
+		if _, err := file.WriteString(config.PZ_SteamID + "\n"); err != nil {
+			return err
+		}
+	}
+
+	ss.logger().Info("Players file updated")
+	return nil
+}
+
+// GetSyncedServer returns the synced server with the given name
+func GetSyncedServer(name string) (*SyncedServer, error) {
+	ss := &SyncedServer{Server: Server{Name: name}}
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ss.GetKey())
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			dec := gob.NewDecoder(bytes.NewReader(v))
+			return dec.Decode(&ss)
+		})
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, fmt.Errorf("synced server %q not found", name)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	log.Info("Players file updated")
+	return ss, nil
 }
 
 // GetSyncedServers returns all synced servers
@@ -386,3 +544,59 @@ func GetSyncedServers() []*SyncedServer {
 
 	return servers
 }
+
+// Publish copies the local server to its new repository, then commits, pushes and saves it. Used when the
+// server is added, the repository should be empty
+func (ss *SyncedServer) Publish(ctx context.Context) error {
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := ss.CopyLocalServerToSynced(ctx); err != nil {
+		return err
+	}
+	if err := ss.UpdatePlayersFile(); err != nil {
+		return err
+	}
+	err = ss.CommitAndPush(ctx)
+	if saveErr := ss.Save(); saveErr != nil {
+		return saveErr
+	}
+	if errors.Is(err, ErrOffline) {
+		return nil
+	}
+	return err
+}
+
+// CloneServer clones the server of the repository, installs it in the local servers and saves it
+func CloneServer(ctx context.Context, gitURL string) (*SyncedServer, error) {
+	ss := &SyncedServer{GitURL: gitURL}
+	if err := ss.Clone(ctx); err != nil {
+		return nil, err
+	}
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+		return nil, err
+	}
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return nil, err
+	}
+	if err := ss.UpdatePlayersFile(); err != nil {
+		return nil, err
+	}
+	err = ss.CommitAndPush(ctx)
+	if saveErr := ss.Save(); saveErr != nil {
+		return nil, saveErr
+	}
+	if errors.Is(err, ErrOffline) {
+		return ss, nil
+	}
+	return ss, err
+}
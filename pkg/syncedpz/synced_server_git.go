@@ -1,6 +1,7 @@
 package syncedpz
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -9,49 +10,82 @@ import (
 	"syncedpz/config"
 	"syncedpz/pkg/utils"
 
-	"github.com/charmbracelet/log"
 	"github.com/go-git/go-git/v5"
 	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
 // InitGit initializes the git repository for the synced server
-func (ss *SyncedServer) InitGit() {
-	log.Info("Initializing git repository")
+func (ss *SyncedServer) InitGit() error {
+	ss.logger().Info("Initializing git repository")
 
 	utils.EnsureDir(ss.GetServerPath())
 
 	repo, err := git.PlainOpen(ss.GetServerPath())
 	if err == git.ErrRepositoryNotExists {
 		repo, err = git.PlainInit(ss.GetServerPath(), false)
-		utils.HandleErr(err)
+		if err != nil {
+			return err
+		}
 		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
 			Name: "origin",
 			URLs: []string{ss.GitURL},
 		})
-		utils.HandleErr(err)
+		if err != nil {
+			return err
+		}
 	} else if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	ss.repo = repo
+	if err := ss.ensureRemotes(); err != nil {
+		return err
+	}
 
-	log.Info("Git repository initialized")
+	ss.logger().Info("Git repository initialized")
+	return nil
 }
 
-func (ss *SyncedServer) Clone() {
-	log.Info("Starting to clone server")
+// openRepo initializes the git repository of the server unless it's already open
+func (ss *SyncedServer) openRepo() error {
+	if ss.repo != nil {
+		return nil
+	}
+	return ss.InitGit()
+}
 
-	gitRepoName := filepath.Base(ss.GitURL)
-	tempDirName := filepath.Join(config.ServersPath, gitRepoName)
+// Clone clones the repository of the server in a temporary folder, moved to the server path once the name
+// of the server is known. Refuses to replace a server that already exists
+func (ss *SyncedServer) Clone(ctx context.Context) error {
+	ss.logger().Info("Starting to clone server")
 
 	utils.EnsureDir(config.ServersPath)
-	utils.EnsureDir(tempDirName)
-	repo, err := git.PlainClone(tempDirName, false, &git.CloneOptions{
-		URL:  ss.GitURL,
-		Auth: config.GitAuth,
+	// In the servers folder, so it's moved without copying
+	tempDirName, err := os.MkdirTemp(config.ServersPath, ".clone-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDirName)
+
+	var repo *git.Repository
+	err = withRetry(ctx, "Clone", ss.GitURL, func(ctx context.Context) error {
+		// Starts from scratch after a failed attempt
+		if err := os.RemoveAll(tempDirName); err != nil {
+			return err
+		}
+		utils.EnsureDir(tempDirName)
+
+		var err error
+		repo, err = git.PlainCloneContext(ctx, tempDirName, false, &git.CloneOptions{
+			URL:  ss.GitURL,
+			Auth: config.GitAuth,
+		})
+		return err
 	})
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
 	ss.repo = repo
 
@@ -69,138 +103,271 @@ func (ss *SyncedServer) Clone() {
 		return nil
 	})
 	if err != nil && err.Error() != "stop" {
-		log.Fatal(err)
+		return err
+	}
+	// Renamed servers have their name in the server info
+	if info, err := readServerInfo(tempDirName); err == nil && info.Name != "" {
+		ss.Name = info.Name
+	}
+	if ss.Name == "" {
+		return errors.New("the repository has no server config, config/<name>.ini is missing")
 	}
 
-	// Renames the directory to the server name
+	// The existing server may have snapshots that aren't in its repositories
+	if _, err := GetSyncedServer(ss.Name); err == nil {
+		return fmt.Errorf("a synced server named %q already exists", ss.Name)
+	}
 	newDirName := ss.GetServerPath()
-	err = os.Rename(tempDirName, newDirName)
-	utils.HandleErr(err)
+	if _, err := os.Stat(newDirName); err == nil {
+		return fmt.Errorf("%s already exists", newDirName)
+	}
+
+	// Renames the directory to the server name
+	if err := os.Rename(tempDirName, newDirName); err != nil {
+		return err
+	}
 
 	// Recreates repo with the new directory
 	ss.repo, err = git.PlainOpen(newDirName)
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	ss.Save()
+	if err := ss.Save(); err != nil {
+		return err
+	}
 
-	log.Info("Server cloned successfully")
+	ss.logger().Info("Server cloned successfully")
+	return nil
 }
 
 // Restore restores the server to the last commit, useful to undo changes in case of a syncronization during
 // an IO operation like copying files
-func (ss *SyncedServer) Restore() {
-	if ss.repo == nil {
-		ss.InitGit()
+func (ss *SyncedServer) Restore() error {
+	if err := ss.openRepo(); err != nil {
+		return err
 	}
 
-	log.Info("Starting to restore server")
+	ss.logger().Info("Starting to restore server")
 
 	w, err := ss.repo.Worktree()
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
 	err = w.Reset(&git.ResetOptions{
 		Mode: git.HardReset,
 	})
-	utils.HandleErr(err)
-	removeUnstagedFiles(w)
+	if err != nil {
+		return err
+	}
+	if err := removeUnstagedFiles(w); err != nil {
+		return err
+	}
+
+	ss.logger().Info("Server restored")
+	return nil
+}
 
-	log.Info("Server restored")
+// restoreAfter restores the server after the error stopped an operation, returning both if it couldn't
+// be restored
+func (ss *SyncedServer) restoreAfter(err error) error {
+	if restoreErr := ss.Restore(); restoreErr != nil {
+		return fmt.Errorf("%w, and it couldn't be rolled back: %w", err, restoreErr)
+	}
+	return err
 }
 
 // Fetch fetches the latest changes from the git repository
 // Useful to check if anything was pushed when doing IO operations like
 // copying local files to the synced server
-func (ss *SyncedServer) Fetch() bool {
-	if ss.repo == nil {
-		ss.InitGit()
+func (ss *SyncedServer) Fetch(ctx context.Context) bool {
+	changes, err := ss.TryFetch(ctx)
+	utils.HandleErr(err)
+	return changes
+}
+
+// TryFetch is Fetch returning the error, ErrOffline if no repository is reachable
+func (ss *SyncedServer) TryFetch(ctx context.Context) (bool, error) {
+	if err := ss.openRepo(); err != nil {
+		return false, err
 	}
 
-	log.Info("Trying to fetch changes")
+	ss.logger().Info("Trying to fetch changes")
 
-	err := ss.repo.Fetch(&git.FetchOptions{
-		RemoteName: "origin",
-		Auth:       config.GitAuth,
-	})
-	if err == git.NoErrAlreadyUpToDate {
-		log.Info("Already up to date")
-		return false
-	} else {
-		utils.HandleErr(err)
+	reachable, err := ss.fetchRemotes(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !ss.hasRemoteChanges(reachable) {
+		ss.logger().Info("Already up to date")
+		return false, nil
 	}
-	return true
+	return true, nil
 }
 
-// Pull pulls the latest changes from the git repository
+// Pull pulls the latest changes from the freshest of the server git repositories
 // Returns true if there are new changes
-func (ss *SyncedServer) Pull() bool {
-	if ss.repo == nil {
-		ss.InitGit()
+func (ss *SyncedServer) Pull(ctx context.Context) bool {
+	changes, err := ss.TryPull(ctx)
+	utils.HandleErr(err)
+	return changes
+}
+
+// TryPull is Pull returning the error, ErrOffline if no repository is reachable
+func (ss *SyncedServer) TryPull(ctx context.Context) (bool, error) {
+	if err := ss.openRepo(); err != nil {
+		return false, err
 	}
 
-	log.Info("Starting to pull changes")
+	ss.logger().Info("Starting to pull changes")
 
 	w, err := ss.repo.Worktree()
-	utils.HandleErr(err)
+	if err != nil {
+		return false, err
+	}
+
+	if head, err := ss.repo.Head(); err == nil {
+		ss.baseCommit = head.Hash()
+	}
+
+	reachable, err := ss.fetchRemotes(ctx)
+	if err != nil {
+		return false, err
+	}
+	remoteName := ss.freshestRemote(reachable)
+	if remoteName != "origin" {
+		ss.logger().Infof("Pulling from %s", remoteName)
+	}
 
-	err = w.Pull(&git.PullOptions{
-		RemoteName: "origin",
+	pullOptions := &git.PullOptions{
+		RemoteName: remoteName,
 		Auth:       config.GitAuth,
+	}
+	if branch, ok := ss.currentBranch(); ok && ss.remoteBranchCommit(remoteName) != nil {
+		pullOptions.ReferenceName = branch
+	}
+	err = withRetry(ctx, "Pull", ss.remoteURL(remoteName), func(ctx context.Context) error {
+		return w.PullContext(ctx, pullOptions)
 	})
 	if err == git.NoErrAlreadyUpToDate || err == transport.ErrEmptyRemoteRepository {
-		log.Info("Already up to date")
-		return false
-	} else {
-		utils.HandleErr(err)
+		ss.logger().Info("Already up to date")
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := ss.followRename(); err != nil {
+		return false, err
 	}
 
-	log.Info("Pulled changes")
-	return true
+	ss.logger().Info("Pulled changes")
+	return true, nil
+}
+
+// Commit commits every change in the server repository, describing the save in the commit message
+func (ss *SyncedServer) Commit() error {
+	commitMsg := fmt.Sprintf("SyncedPZ: synced by %s", config.PZ_SteamID)
+	if metadata, err := ss.GetSaveMetadata(); err == nil && len(metadata.Lines()) > 0 {
+		commitMsg += "\n\n" + strings.Join(metadata.Lines(), "\n")
+	}
+	return ss.CommitWithMessage(commitMsg)
 }
 
-func (ss *SyncedServer) Commit() {
-	if ss.repo == nil {
-		ss.InitGit()
+// CommitWithMessage commits every change in the server repository with the given message
+func (ss *SyncedServer) CommitWithMessage(commitMsg string) error {
+	if err := ss.openRepo(); err != nil {
+		return err
 	}
 
-	log.Info("Starting to commit changes")
+	ss.logger().Info("Starting to commit changes")
 
 	w, err := ss.repo.Worktree()
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
 	_, err = w.Add(".")
-	utils.HandleErr(err)
+	if err != nil {
+		return err
+	}
 
-	commitMsg := fmt.Sprintf("SyncedPZ: synced by %s", config.PZ_SteamID)
 	_, err = w.Commit(commitMsg, &git.CommitOptions{})
-	if err != git.ErrEmptyCommit {
-		utils.HandleErr(err)
-		log.Info("Changes committed")
-	} else {
-		log.Info("No changes to commit")
+	if err == git.ErrEmptyCommit {
+		ss.logger().Info("No changes to commit")
+		return nil
+	} else if err != nil {
+		return err
 	}
+	ss.logger().Info("Changes committed")
+	return nil
+}
+
+func (ss *SyncedServer) Push(ctx context.Context) {
+	utils.HandleErr(ss.TryPush(ctx))
 }
 
-func (ss *SyncedServer) Push() {
-	if ss.repo == nil {
-		ss.InitGit()
+// TryPush is Push returning the error, ErrOffline if no repository is reachable.
+// The commits that couldn't be pushed stay queued in the server repository
+func (ss *SyncedServer) TryPush(ctx context.Context) error {
+	if err := ss.openRepo(); err != nil {
+		return err
 	}
 
-	log.Info("Starting to push changes")
+	ss.logger().Info("Starting to push changes")
 
-	err := ss.repo.Push(&git.PushOptions{
-		RemoteName: "origin",
-		Auth:       config.GitAuth,
-		Progress:   os.Stdout,
-	})
-	if err != git.NoErrAlreadyUpToDate {
-		utils.HandleErr(err)
-		log.Info("Changes pushed")
-	} else {
-		log.Info("Already up to date")
+	var refSpecs []gitconfig.RefSpec
+	if branch, ok := ss.currentBranch(); ok {
+		refSpecs = append(branchRefSpecs(branch), tagsRefSpec)
+	}
+	err := ss.pushRemotes(ctx, refSpecs)
+	if err == git.NoErrAlreadyUpToDate {
+		ss.logger().Info("Already up to date")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	ss.logger().Info("Changes pushed")
+	if ss.run != nil {
+		ss.run.pushed = true
 	}
+
+	event := WebhookEvent{Event: EventSnapshotPushed, Server: ss.Name}
+	if head, err := ss.repo.Head(); err == nil {
+		event.Commit = head.Hash().String()
+	}
+	event.Message = fmt.Sprintf(config.GTM("%s pushed a new snapshot of %s"), config.PZ_SteamID, ss.Name)
+	if metadata, err := ss.GetSaveMetadata(); err == nil && len(metadata.Lines()) > 0 {
+		event.Message += "\n" + strings.Join(metadata.Lines(), "\n")
+	}
+	notify(event)
+	return nil
 }
 
-func (ss *SyncedServer) CommitAndPush() {
-	ss.Commit()
-	ss.Push()
+// commitVerified verifies the save and, if it's healthy, commits it.
+// When the verification fails the changes are discarded, unless config.SkipVerify is set
+func (ss *SyncedServer) commitVerified() error {
+	if err := ss.Verify(); err != nil {
+		if !config.SkipVerify {
+			ss.logger().Error(err)
+			ss.logger().Error("Refusing to push the save, use -force to push it anyway")
+			return ss.restoreAfter(err)
+		}
+		ss.logger().Warn(err)
+	}
+
+	return ss.Commit()
+}
+
+// CommitAndPush verifies the save and, if it's healthy, commits and pushes it.
+// When no repository is reachable the commit stays queued and ErrOffline is returned
+func (ss *SyncedServer) CommitAndPush(ctx context.Context) error {
+	if err := ss.commitVerified(); err != nil {
+		return err
+	}
+
+	err := ss.TryPush(ctx)
+	if errors.Is(err, ErrOffline) {
+		ss.logger().Warn("No repository is reachable, the snapshot was queued and will be pushed on the next sync")
+	}
+	return err
 }
@@ -0,0 +1,107 @@
+package syncedpz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/utils"
+)
+
+// GetPlayersPath returns the path where the player save folders are stored inside the server repository.
+// Each player has its own folder named after its steam id
+func (ss SyncedServer) GetPlayersPath() string {
+	return filepath.Join(ss.GetServerPath(), "players")
+}
+
+// getLocalPlayerFolders returns the local player save folders of the server, sorted from the most recent
+// to the oldest one
+func (ss SyncedServer) getLocalPlayerFolders() ([]os.FileInfo, error) {
+	playerSavePath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
+	utils.EnsureDir(playerSavePath)
+
+	entries, err := os.ReadDir(playerSavePath)
+	if err != nil {
+		return nil, err
+	}
+
+	playerFolders := []os.FileInfo{}
+	for _, entry := range entries {
+		hasNameInIt := strings.Contains(entry.Name(), ssNameWithUnderScore)
+		if hasNameInIt && strings.HasSuffix(entry.Name(), "_player") {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			playerFolders = append(playerFolders, info)
+		}
+	}
+
+	sort.Slice(playerFolders, func(i, j int) bool {
+		return playerFolders[i].ModTime().After(playerFolders[j].ModTime())
+	})
+	return playerFolders, nil
+}
+
+// CopyLocalPlayerToSynced copies your most recent local player save folder to the synced server repository.
+// Only the folder of your steam id is replaced, the folders of the other players are left untouched
+func (ss *SyncedServer) CopyLocalPlayerToSynced(ctx context.Context) error {
+	playerFolders, err := ss.getLocalPlayerFolders()
+	if err != nil {
+		return err
+	}
+	if len(playerFolders) == 0 {
+		ss.logger().Info("No local player save folder to copy")
+		return nil
+	}
+
+	ss.logger().Info("Copying local player save folder to synced server")
+
+	playerSavePath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	mostRecentPlayerFolder := filepath.Join(playerSavePath, playerFolders[0].Name())
+	syncedPlayerFolder := filepath.Join(ss.GetPlayersPath(), config.PZ_SteamID)
+
+	if err := os.RemoveAll(syncedPlayerFolder); err != nil {
+		return err
+	}
+
+	utils.EnsureDir(ss.GetPlayersPath())
+	if err := utils.CopyContext(ctx, mostRecentPlayerFolder, syncedPlayerFolder); err != nil {
+		return err
+	}
+
+	ss.logger().Info("Local player save folder copied to synced server")
+	return nil
+}
+
+// CopySyncedPlayerToLocal copies your player save folder from the synced server repository to the local
+// player save folder of the server. It's written to the folder used when you are the host, which becomes
+// the most recent one, so EnsureUpdatedPlayerSaveFolders spreads it to the folders of every other host
+func (ss *SyncedServer) CopySyncedPlayerToLocal(ctx context.Context) error {
+	syncedPlayerFolder := filepath.Join(ss.GetPlayersPath(), config.PZ_SteamID)
+	if _, err := os.Stat(syncedPlayerFolder); os.IsNotExist(err) {
+		ss.logger().Info("No synced player save folder for your steam id")
+		return nil
+	}
+
+	ss.logger().Info("Copying synced player save folder to local server")
+
+	playerSavePath := filepath.Join(config.PZ_DataPath, "Saves", "Multiplayer")
+	ssNameWithUnderScore := strings.ReplaceAll(ss.Name, " ", "_")
+	localPlayerFolder := filepath.Join(playerSavePath, ssNameWithUnderScore+"_player")
+
+	if err := os.RemoveAll(localPlayerFolder); err != nil {
+		return err
+	}
+
+	utils.EnsureDir(localPlayerFolder)
+	if err := utils.CopyContext(ctx, syncedPlayerFolder, localPlayerFolder); err != nil {
+		return err
+	}
+
+	ss.logger().Info("Synced player save folder copied to local server")
+	return nil
+}
@@ -0,0 +1,178 @@
+package syncedpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syncedpz/config"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// tagsRefSpec pushes every tag of the server repository
+const tagsRefSpec = gitconfig.RefSpec("refs/tags/*:refs/tags/*")
+
+// TagInfo is a milestone of the server, a named snapshot
+type TagInfo struct {
+	Name    string     `json:"name"`
+	Tagger  string     `json:"tagger"`
+	Time    time.Time  `json:"time"`
+	Message string     `json:"message"`
+	Commit  CommitInfo `json:"commit"`
+}
+
+// validateTagName checks if the name can be used for a tag
+func validateTagName(name string) error {
+	if name == "" || strings.HasPrefix(name, "-") || plumbing.NewTagReferenceName(name).Validate() != nil {
+		return fmt.Errorf("invalid tag name: %q, use letters, numbers, - and _", name)
+	}
+	return nil
+}
+
+// Tag syncs the server and tags its snapshot with an annotated tag describing the save, then pushes it
+func (ss *SyncedServer) Tag(ctx context.Context, name string) error {
+	if err := validateTagName(name); err != nil {
+		return err
+	}
+
+	// Tags the latest progress
+	if err := ss.Sync(ctx); err != nil && !errors.Is(err, ErrOffline) {
+		return err
+	}
+	if _, err := ss.repo.Tag(name); err == nil {
+		return fmt.Errorf("the tag %s already exists", name)
+	}
+
+	head, err := ss.repo.Head()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("%s\n\nTagged by %s", name, config.PZ_SteamID)
+	if metadata, err := ss.GetSaveMetadata(); err == nil && len(metadata.Lines()) > 0 {
+		message += "\n" + strings.Join(metadata.Lines(), "\n")
+	}
+	if _, err := ss.repo.CreateTag(name, head.Hash(), &git.CreateTagOptions{Message: message}); err != nil {
+		return err
+	}
+	ss.logger().Infof("Snapshot %s tagged as %s", head.Hash().String()[:8], name)
+
+	err = ss.TryPush(ctx)
+	if errors.Is(err, ErrOffline) {
+		ss.logger().Warn("No repository is reachable, the tag will be pushed on the next sync")
+		return nil
+	}
+	return err
+}
+
+// getCommitTags returns the names of the tags of each commit
+func (ss *SyncedServer) getCommitTags() map[plumbing.Hash][]string {
+	tags := make(map[plumbing.Hash][]string)
+	for _, tag := range ss.GetTags() {
+		hash := plumbing.NewHash(tag.Commit.Hash)
+		tags[hash] = append(tags[hash], tag.Name)
+	}
+	return tags
+}
+
+// GetTags returns the tags of the server, the most recent first
+func (ss *SyncedServer) GetTags() []TagInfo {
+	if err := ss.openRepo(); err != nil {
+		ss.logger().Error(err)
+		return []TagInfo{}
+	}
+
+	tags := []TagInfo{}
+	refs, err := ss.repo.Tags()
+	if err != nil {
+		ss.logger().Error(err)
+		return tags
+	}
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		info := TagInfo{Name: ref.Name().Short()}
+		var commit *object.Commit
+		if tag, err := ss.repo.TagObject(ref.Hash()); err == nil {
+			info.Tagger = tag.Tagger.Name
+			info.Time = tag.Tagger.When
+			info.Message = tag.Message
+			commit, err = tag.Commit()
+			if err != nil {
+				return nil
+			}
+		} else if commit, err = ss.repo.CommitObject(ref.Hash()); err != nil {
+			return nil // tags of something else than a snapshot
+		} else {
+			// Lightweight tags, like the ones created by hand, have no metadata of their own
+			info.Time = commit.Author.When
+		}
+		info.Commit = newCommitInfo(commit)
+		tags = append(tags, info)
+		return nil
+	})
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Time.After(tags[j].Time)
+	})
+	return tags
+}
+
+// RestoreSnapshot makes an older snapshot of the server, given by a tag or a commit hash, its current
+// snapshot. It's committed on top of the history, so nothing is lost, and pushed.
+// The server is synced before, and the local save is backed up before being replaced
+func (ss *SyncedServer) RestoreSnapshot(ctx context.Context, target string) error {
+	if err := ss.Sync(ctx); err != nil {
+		return err
+	}
+
+	lock, err := ss.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	hash, err := ss.repo.ResolveRevision(plumbing.Revision(target))
+	if err != nil {
+		return fmt.Errorf("no tag or snapshot %s: %w", target, err)
+	}
+	source, err := ss.repo.CommitObject(*hash)
+	if err != nil {
+		return err
+	}
+	head, err := ss.repo.Head()
+	if err != nil {
+		return err
+	}
+	onto, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	if source.Hash == onto.Hash {
+		ss.logger().Infof("%s is already the current snapshot", target)
+		return nil
+	}
+
+	ss.logger().Infof("Restoring %s to %s (%s)", ss.Name, target, source.Hash.String()[:8])
+
+	commitMsg := fmt.Sprintf("SyncedPZ: %s restored %s (%s)", config.PZ_SteamID, target, source.Hash.String()[:8])
+	if err := ss.adoptSnapshot(onto, source, commitMsg); err != nil {
+		return err
+	}
+	if err := ss.TryPush(ctx); err != nil {
+		return err
+	}
+	if err := ss.CopySyncedServerToLocal(ctx); err != nil {
+		return err
+	}
+	if err := ss.EnsureUpdatedPlayerSaveFolders(); err != nil {
+		return err
+	}
+	ss.saveLastSync()
+
+	ss.logger().Infof("%s restored to %s", ss.Name, target)
+	return nil
+}
@@ -0,0 +1,82 @@
+package syncedpz
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"syncedpz/pkg/pzsave"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrVerificationFailed = errors.New("save verification failed")
+
+// MinFileCountRatio is the minimum ratio between the number of files of the save and the number of files
+// of the previous snapshot. Below it the save is considered collapsed (e.g. truncated by a crash)
+const MinFileCountRatio = 0.5
+
+// countSaveFiles returns the number of files of the synced save
+func (ss SyncedServer) countSaveFiles() int {
+	count := 0
+	filepath.WalkDir(filepath.Join(ss.GetServerPath(), "save"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// countSnapshotSaveFiles returns the number of save files in the last snapshot, -1 if there isn't one
+func (ss *SyncedServer) countSnapshotSaveFiles() int {
+	if err := ss.openRepo(); err != nil {
+		ss.logger().Error(err)
+		return -1
+	}
+
+	head, err := ss.repo.Head()
+	if err != nil {
+		return -1
+	}
+	commit, err := ss.repo.CommitObject(head.Hash())
+	if err != nil {
+		return -1
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return -1
+	}
+
+	count := 0
+	tree.Files().ForEach(func(f *object.File) error {
+		if strings.HasPrefix(f.Name, "save/") {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// Verify checks the synced save before it's pushed, so a corrupted or truncated save isn't spread to the
+// other players: the required files must exist, the databases must pass the integrity check, the binary
+// headers must be valid and the number of files can't collapse compared to the last snapshot
+func (ss *SyncedServer) Verify() error {
+	ss.logger().Info("Verifying save")
+
+	problems := pzsave.Verify(filepath.Join(ss.GetServerPath(), "save"))
+
+	current := ss.countSaveFiles()
+	previous := ss.countSnapshotSaveFiles()
+	if previous > 0 && float64(current) < float64(previous)*MinFileCountRatio {
+		problems = append(problems, fmt.Errorf("the save has %d files, the last snapshot had %d", current, previous))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %w", ErrVerificationFailed, errors.Join(problems...))
+	}
+
+	ss.logger().Info("Save verified")
+	return nil
+}
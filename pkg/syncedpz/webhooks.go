@@ -0,0 +1,279 @@
+package syncedpz
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syncedpz/config"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/dgraph-io/badger"
+)
+
+// Events the webhooks can be notified of
+const (
+	EventSessionStarted   = "session_started"
+	EventSessionEnded     = "session_ended"
+	EventLockAcquired     = "lock_acquired"
+	EventLockReleased     = "lock_released"
+	EventSnapshotPushed   = "snapshot_pushed"
+	EventConflictDetected = "conflict_detected"
+	EventSyncFailed       = "sync_failed"
+	EventTest             = "test"
+)
+
+// WebhookEvents are the events a webhook can subscribe to
+var WebhookEvents = []string{
+	EventSessionStarted,
+	EventSessionEnded,
+	EventLockAcquired,
+	EventLockReleased,
+	EventSnapshotPushed,
+	EventConflictDetected,
+	EventSyncFailed,
+}
+
+// DefaultWebhookEvents are the events of a webhook added without choosing them. The locks are taken on
+// every sync, so they're left out
+var DefaultWebhookEvents = []string{
+	EventSessionStarted,
+	EventSessionEnded,
+	EventSnapshotPushed,
+	EventConflictDetected,
+	EventSyncFailed,
+}
+
+// Payload formats of the webhooks
+const (
+	WebhookJSON    = "json"
+	WebhookDiscord = "discord"
+	WebhookSlack   = "slack"
+)
+
+// webhookTimeout is how long a webhook has to answer, the sync waits for it
+const webhookTimeout = 5 * time.Second
+
+// Webhook is an URL notified with a POST when the events it subscribed to happen
+type Webhook struct {
+	URL string
+	// json, discord or slack
+	Format string
+	Events []string
+}
+
+// WebhookEvent is the payload of the json webhooks
+type WebhookEvent struct {
+	Event string `json:"event"`
+	// Steam ID of the player whose SyncedPZ fired the event
+	Player  string    `json:"player"`
+	Server  string    `json:"server,omitempty"`
+	Commit  string    `json:"commit,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// payload returns the body of the request notifying the event to the webhook
+func (w Webhook) payload(event WebhookEvent) ([]byte, error) {
+	switch w.Format {
+	case WebhookDiscord:
+		return json.Marshal(map[string]string{"username": "SyncedPZ", "content": event.Message})
+	case WebhookSlack:
+		return json.Marshal(map[string]string{"text": event.Message})
+	}
+	return json.Marshal(event)
+}
+
+// send posts the event to the webhook
+func (w Webhook) send(ctx context.Context, event WebhookEvent) error {
+	body, err := w.payload(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SyncedPZ")
+
+	// The errors leave the URL out, the ones of Discord and Slack have a token and end up in the logs
+	res, err := http.DefaultClient.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", req.URL.Host, urlErr.Err)
+	} else if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, res.Status)
+	}
+	return nil
+}
+
+// GetWebhooks returns the webhooks notified of the events
+func GetWebhooks() ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := config.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("webhooks"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			return gob.NewDecoder(bytes.NewReader(v)).Decode(&webhooks)
+		})
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func saveWebhooks(webhooks []Webhook) error {
+	return config.DB.Update(func(txn *badger.Txn) error {
+		if len(webhooks) == 0 {
+			return txn.Delete([]byte("webhooks"))
+		}
+
+		var buff bytes.Buffer
+		if err := gob.NewEncoder(&buff).Encode(webhooks); err != nil {
+			return err
+		}
+		return txn.Set([]byte("webhooks"), buff.Bytes())
+	})
+}
+
+// AddWebhook validates and saves the webhook, replacing the one with the same URL. Without events it
+// subscribes to DefaultWebhookEvents
+func AddWebhook(webhook Webhook) error {
+	if !strings.HasPrefix(webhook.URL, "http://") && !strings.HasPrefix(webhook.URL, "https://") {
+		return errors.New("the webhook URL must start with http:// or https://")
+	}
+	if webhook.Format == "" {
+		webhook.Format = WebhookJSON
+	}
+	if !slices.Contains([]string{WebhookJSON, WebhookDiscord, WebhookSlack}, webhook.Format) {
+		return fmt.Errorf("unknown webhook format %s, use json, discord or slack", webhook.Format)
+	}
+	if len(webhook.Events) == 0 {
+		webhook.Events = DefaultWebhookEvents
+	}
+	for _, event := range webhook.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			return fmt.Errorf("unknown event %s, use %s", event, strings.Join(WebhookEvents, ", "))
+		}
+	}
+
+	webhooks, err := GetWebhooks()
+	if err != nil {
+		return err
+	}
+	webhooks = slices.DeleteFunc(webhooks, func(w Webhook) bool {
+		return w.URL == webhook.URL
+	})
+	return saveWebhooks(append(webhooks, webhook))
+}
+
+// RemoveWebhook stops notifying the webhook with the URL
+func RemoveWebhook(webhookURL string) error {
+	webhooks, err := GetWebhooks()
+	if err != nil {
+		return err
+	}
+	remaining := slices.DeleteFunc(slices.Clone(webhooks), func(w Webhook) bool {
+		return w.URL == webhookURL
+	})
+	if len(remaining) == len(webhooks) {
+		return errors.New("no webhook with this URL")
+	}
+	return saveWebhooks(remaining)
+}
+
+// TestWebhook sends a test event to the webhook, returning why it failed
+func TestWebhook(ctx context.Context, webhook Webhook) error {
+	return webhook.send(ctx, WebhookEvent{
+		Event:   EventTest,
+		Player:  config.PZ_SteamID,
+		Message: fmt.Sprintf(config.GTM("Test notification from %s"), config.PZ_SteamID),
+		Time:    time.Now(),
+	})
+}
+
+// notify sends the event to every webhook subscribed to it. Failures are only logged, they never stop
+// the operation that fired the event
+func notify(event WebhookEvent) {
+	event.Player = config.PZ_SteamID
+	event.Time = time.Now()
+
+	// The events of the game sessions are sent while the database is closed. Waits a bit for another
+	// SyncedPZ process using it, the notifications don't hold the operation any longer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := config.OpenDB(ctx); err != nil {
+		log.Warnf("Could not notify the webhooks of %s: %s", event.Event, err)
+		return
+	}
+	webhooks, err := GetWebhooks()
+	config.CloseDB()
+	if err != nil {
+		log.Warnf("Could not notify the webhooks of %s: %s", event.Event, err)
+		return
+	}
+	notifyWebhooks(webhooks, event)
+}
+
+// notifyWebhooks sends the event to the webhooks subscribed to it, waiting for every one to answer
+func notifyWebhooks(webhooks []Webhook, event WebhookEvent) {
+	var wg sync.WaitGroup
+	for _, webhook := range webhooks {
+		if !slices.Contains(webhook.Events, event.Event) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Not cancelled with the operation, the event may be its interruption
+			if err := webhook.send(context.Background(), event); err != nil {
+				log.Warnf("Could not notify the webhook of %s: %s", event.Event, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// notifySyncError notifies the divergences and the failures of a sync. Being offline or interrupted
+// isn't a failure
+func (ss SyncedServer) notifySyncError(err error) {
+	var divergence *DivergenceError
+	switch {
+	case err == nil, errors.Is(err, ErrOffline), errors.Is(err, context.Canceled):
+	case errors.As(err, &divergence):
+		notify(WebhookEvent{
+			Event:   EventConflictDetected,
+			Server:  ss.Name,
+			Commit:  divergence.Theirs.Hash,
+			Error:   err.Error(),
+			Message: fmt.Sprintf(config.GTM("%s and the server changed %s at the same time, someone has to choose which world to keep"), config.PZ_SteamID, ss.Name),
+		})
+	default:
+		notify(WebhookEvent{
+			Event:   EventSyncFailed,
+			Server:  ss.Name,
+			Error:   err.Error(),
+			Message: fmt.Sprintf(config.GTM("The sync of %s by %s failed: %s"), ss.Name, config.PZ_SteamID, err),
+		})
+	}
+}
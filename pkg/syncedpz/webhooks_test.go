@@ -0,0 +1,182 @@
+package syncedpz
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syncedpz/config"
+	"testing"
+	"time"
+)
+
+// TestMain removes the data folder the config creates in the package folder
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.RemoveAll(config.DataPath)
+	os.Exit(code)
+}
+
+// webhookRecorder is a webhook endpoint recording the body posted to each path
+type webhookRecorder struct {
+	mu     sync.Mutex
+	bodies map[string][]byte
+}
+
+func newWebhookServer(t *testing.T) (*httptest.Server, *webhookRecorder) {
+	rec := &webhookRecorder{bodies: make(map[string][]byte)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.bodies[r.URL.Path] = body
+		rec.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, rec
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	srv, rec := newWebhookServer(t)
+	webhooks := []Webhook{
+		{URL: srv.URL + "/json", Format: WebhookJSON, Events: []string{EventSnapshotPushed, EventSyncFailed}},
+		{URL: srv.URL + "/discord", Format: WebhookDiscord, Events: DefaultWebhookEvents},
+		{URL: srv.URL + "/slack", Format: WebhookSlack, Events: []string{EventSnapshotPushed}},
+		{URL: srv.URL + "/locks", Format: WebhookJSON, Events: []string{EventLockAcquired, EventLockReleased}},
+	}
+	event := WebhookEvent{
+		Event:   EventSnapshotPushed,
+		Player:  "76561198000000000",
+		Server:  "servertest",
+		Commit:  "0123abcd",
+		Message: "76561198000000000 pushed a snapshot of servertest",
+		Time:    time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	notifyWebhooks(webhooks, event)
+
+	var got WebhookEvent
+	if err := json.Unmarshal(rec.bodies["/json"], &got); err != nil {
+		t.Fatalf("json payload: %s", err)
+	}
+	if got != event {
+		t.Errorf("json payload = %+v, want %+v", got, event)
+	}
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"/discord", map[string]string{"username": "SyncedPZ", "content": event.Message}},
+		{"/slack", map[string]string{"text": event.Message}},
+	}
+	for _, tt := range tests {
+		var payload map[string]string
+		if err := json.Unmarshal(rec.bodies[tt.path], &payload); err != nil {
+			t.Fatalf("%s payload: %s", tt.path, err)
+		}
+		if len(payload) != len(tt.want) {
+			t.Errorf("%s payload = %v, want %v", tt.path, payload, tt.want)
+		}
+		for key, value := range tt.want {
+			if payload[key] != value {
+				t.Errorf("%s payload[%q] = %q, want %q", tt.path, key, payload[key], value)
+			}
+		}
+	}
+
+	if _, ok := rec.bodies["/locks"]; ok {
+		t.Error("the webhook not subscribed to the event was notified")
+	}
+}
+
+func TestNotifyWebhooksFiltersEvents(t *testing.T) {
+	tests := []struct {
+		event string
+		want  []string
+	}{
+		{EventSessionStarted, []string{"/default"}},
+		{EventLockAcquired, []string{"/locks"}},
+		{EventSyncFailed, []string{"/default", "/failures"}},
+		{EventTest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			srv, rec := newWebhookServer(t)
+			webhooks := []Webhook{
+				{URL: srv.URL + "/default", Format: WebhookJSON, Events: DefaultWebhookEvents},
+				{URL: srv.URL + "/locks", Format: WebhookSlack, Events: []string{EventLockAcquired}},
+				{URL: srv.URL + "/failures", Format: WebhookDiscord, Events: []string{EventSyncFailed}},
+			}
+
+			notifyWebhooks(webhooks, WebhookEvent{Event: tt.event, Message: "message"})
+
+			if len(rec.bodies) != len(tt.want) {
+				t.Errorf("%d webhooks notified, want %v", len(rec.bodies), tt.want)
+			}
+			for _, path := range tt.want {
+				if _, ok := rec.bodies[path]; !ok {
+					t.Errorf("%s wasn't notified", path)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookSendErrorsHideURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	token := "/api/webhooks/123/secret-token"
+
+	err := Webhook{URL: srv.URL + token, Format: WebhookDiscord}.send(context.Background(), WebhookEvent{Event: EventTest})
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error of a failed status = %v, want one without the path", err)
+	}
+
+	srv.Close()
+	err = Webhook{URL: srv.URL + token, Format: WebhookDiscord}.send(context.Background(), WebhookEvent{Event: EventTest})
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error of an unreachable webhook = %v, want one without the path", err)
+	}
+}
+
+func TestLockEventsOnlyFromSync(t *testing.T) {
+	ctx := context.Background()
+	remote, a, b := newTestClients(t)
+	ssA, _ := syncTestServer(t, remote, a, b, "PVP=true\nMaxPlayers=8\n")
+	a.use(t)
+
+	var mu sync.Mutex
+	events := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event.Event)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	if err := AddWebhook(Webhook{URL: srv.URL, Events: []string{EventLockAcquired, EventLockReleased}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Syncs before changing the setting, the change itself isn't a sync
+	if err := ssA.SetSetting(ctx, "MaxPlayers", "12"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{EventLockAcquired, EventLockReleased}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
@@ -0,0 +1,226 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/syncedpz"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// field is a text input of a form, or a choice between options if it has any
+type field struct {
+	label    string
+	input    textinput.Model
+	options  []string
+	selected int
+}
+
+func (f field) value() string {
+	if len(f.options) > 0 {
+		return f.options[f.selected]
+	}
+	return strings.TrimSpace(f.input.Value())
+}
+
+// form is shown in the details pane until it's submitted or cancelled
+type form struct {
+	title  string
+	fields []field
+	focus  int
+	err    string
+	// Validates the values and returns the command to run, or an error to show in the form
+	submit func(values []string) (tea.Cmd, error)
+}
+
+func newTextField(label, value string) field {
+	input := textinput.New()
+	input.SetValue(value)
+	input.CharLimit = 512
+	return field{label: label, input: input}
+}
+
+func newPasswordField(label string) field {
+	f := newTextField(label, "")
+	f.input.EchoMode = textinput.EchoPassword
+	return f
+}
+
+func newChoiceField(label string, options []string) field {
+	return field{label: label, input: textinput.New(), options: options}
+}
+
+func (f *form) focusField(i int) {
+	f.fields[f.focus].input.Blur()
+	f.focus = (i + len(f.fields)) % len(f.fields)
+	f.fields[f.focus].input.Focus()
+}
+
+// update handles the keys of the form. Returns true when the form is closed
+func (f *form) update(msg tea.KeyMsg) (tea.Cmd, bool) {
+	current := &f.fields[f.focus]
+	switch msg.String() {
+	case "esc":
+		return nil, true
+	case "tab", "down":
+		f.focusField(f.focus + 1)
+		return nil, false
+	case "shift+tab", "up":
+		f.focusField(f.focus - 1)
+		return nil, false
+	case "left", "right":
+		if len(current.options) > 0 {
+			step := 1
+			if msg.String() == "left" {
+				step = -1
+			}
+			current.selected = (current.selected + step + len(current.options)) % len(current.options)
+			return nil, false
+		}
+	case "enter":
+		if f.focus < len(f.fields)-1 {
+			f.focusField(f.focus + 1)
+			return nil, false
+		}
+		values := make([]string, len(f.fields))
+		for i, field := range f.fields {
+			values[i] = field.value()
+		}
+		cmd, err := f.submit(values)
+		if err != nil {
+			f.err = err.Error()
+			return nil, false
+		}
+		return cmd, true
+	}
+
+	if len(current.options) > 0 {
+		return nil, false
+	}
+	var cmd tea.Cmd
+	current.input, cmd = current.input.Update(msg)
+	return cmd, false
+}
+
+func (f *form) view(width int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(f.title) + "\n\n")
+	for i, field := range f.fields {
+		label := field.label
+		if i == f.focus {
+			label = selectedStyle.Render(label)
+		}
+		b.WriteString(label + "\n")
+		if len(field.options) > 0 {
+			b.WriteString(fmt.Sprintf("  ‹ %s ›\n", field.options[field.selected]))
+		} else {
+			field.input.Width = max(width-4, 10)
+			b.WriteString("  " + field.input.View() + "\n")
+		}
+	}
+	if f.err != "" {
+		b.WriteString("\n" + errorStyle.Render(f.err) + "\n")
+	}
+	b.WriteString("\n" + helpStyle.Render(config.GTM("tab next field • ←/→ change option • enter confirm • esc cancel")))
+	return b.String()
+}
+
+// setupForm changes the paths, the Steam ID and the git credentials, like syncedpz config setup
+func (m *model) setupForm() *form {
+	f := &form{
+		title: config.GTM("Setup config"),
+		fields: []field{
+			newTextField(config.GTM("Path to the pz executable (.bat file)"), config.PZ_BatPath),
+			newTextField(config.GTM("Path to the pz data directory"), config.PZ_DataPath),
+			newTextField(config.GTM("Steam ID"), config.PZ_SteamID),
+			newTextField(config.GTM("Git username (empty keeps the current credentials)"), ""),
+			newPasswordField(config.GTM("Git password or token")),
+		},
+	}
+	f.submit = func(values []string) (tea.Cmd, error) {
+		batPath, dataPath, steamID, gitUser, gitPass := values[0], values[1], values[2], values[3], values[4]
+		for _, path := range []string{batPath, dataPath} {
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf(config.GTM("%q does not exist"), path)
+			}
+		}
+		if steamID == "" {
+			return nil, errors.New(config.GTM("Steam ID cannot be empty"))
+		}
+		if (gitUser == "") != (gitPass == "") {
+			return nil, errors.New(config.GTM("Enter both the git username and password, or none to keep the current ones"))
+		}
+
+		if err := syncedpz.SetupPzDirs(batPath, dataPath); err != nil {
+			return nil, err
+		}
+		if err := syncedpz.SetupSteamId(steamID); err != nil {
+			return nil, err
+		}
+		if gitUser != "" {
+			if err := syncedpz.SetupGitAuth(gitUser, gitPass); err != nil {
+				return nil, err
+			}
+		}
+		m.message = config.GTM("Config saved")
+		return nil, nil
+	}
+	f.focusField(0)
+	return f
+}
+
+// addForm adds a local server to a new git repository
+func (m *model) addForm() *form {
+	synced := make(map[string]bool)
+	for _, ss := range m.servers {
+		synced[ss.Name] = true
+	}
+	names := []string{}
+	for _, server := range syncedpz.GetLocalServers() {
+		if !synced[server.Name] {
+			names = append(names, server.Name)
+		}
+	}
+	if len(names) == 0 {
+		m.message = config.GTM("Every local server is already synced")
+		return nil
+	}
+
+	f := &form{
+		title: config.GTM("Add synced server"),
+		fields: []field{
+			newChoiceField(config.GTM("Local server"), names),
+			newTextField(config.GTM("Git repository link"), ""),
+		},
+	}
+	f.submit = func(values []string) (tea.Cmd, error) {
+		if values[1] == "" {
+			return nil, errors.New(config.GTM("The git repository link cannot be empty"))
+		}
+		return m.checkRepository(values[0], values[1]), nil
+	}
+	f.focusField(0)
+	return f
+}
+
+// cloneForm installs a server from its git repository
+func (m *model) cloneForm() *form {
+	f := &form{
+		title: config.GTM("Clone synced server"),
+		fields: []field{
+			newTextField(config.GTM("Git repository link"), ""),
+		},
+	}
+	f.submit = func(values []string) (tea.Cmd, error) {
+		if values[0] == "" {
+			return nil, errors.New(config.GTM("The git repository link cannot be empty"))
+		}
+		return m.cloneServer(values[0]), nil
+	}
+	f.focusField(0)
+	return f
+}
@@ -0,0 +1,77 @@
+package tui
+
+import (
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Lines kept in the log pane
+const maxLogLines = 500
+
+// logMsg tells the model that new lines were logged
+type logMsg struct{}
+
+// logBuffer receives the logs and the progress of the git operations while the TUI runs, keeping the
+// last lines for the log pane. Carriage returns replace the current line, like the git progress does
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	current string
+	notify  chan struct{}
+}
+
+func newLogBuffer() *logBuffer {
+	return &logBuffer{notify: make(chan struct{}, 1)}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, r := range string(p) {
+		switch r {
+		case '\n':
+			b.lines = append(b.lines, b.current)
+			b.current = ""
+		case '\r':
+			b.current = ""
+		default:
+			b.current += string(r)
+		}
+	}
+	if len(b.lines) > maxLogLines {
+		b.lines = b.lines[len(b.lines)-maxLogLines:]
+	}
+
+	// Never blocks, the model reads every line on the next notification
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Tail returns the last n lines, including the one being written
+func (b *logBuffer) Tail(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := b.lines
+	if strings.TrimSpace(b.current) != "" {
+		lines = append(lines[:len(lines):len(lines)], b.current)
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// wait returns a command that waits for new lines
+func (b *logBuffer) wait() tea.Cmd {
+	return func() tea.Msg {
+		<-b.notify
+		return logMsg{}
+	}
+}
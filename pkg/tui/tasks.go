@@ -0,0 +1,286 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syncedpz/config"
+	"syncedpz/pkg/syncedpz"
+	"syncedpz/pkg/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+)
+
+// taskDoneMsg is sent when the running task finishes, with its result
+type taskDoneMsg struct {
+	result tea.Msg
+}
+
+// resultMsg is the result of a task, shown above the log pane
+type resultMsg struct {
+	text string
+	err  error
+}
+
+// divergence is a server that changed locally and in its repository since the last sync
+type divergence struct {
+	ss  *syncedpz.SyncedServer
+	err *syncedpz.DivergenceError
+}
+
+// divergencesMsg asks the player how to resolve the divergences found when syncing, one by one
+type divergencesMsg struct {
+	divergences []divergence
+	text        string
+}
+
+// repositoryCheckedMsg asks the player to confirm adding a server to a repository that has content
+type repositoryCheckedMsg struct {
+	ss      *syncedpz.SyncedServer
+	changes bool
+}
+
+// prompt asks the player to choose an option with a key
+type prompt struct {
+	text    string
+	options []option
+}
+
+type option struct {
+	key   string
+	label string
+	run   func() tea.Cmd
+}
+
+// startTask runs the task in the background. Only one task runs at a time, ctrl+c cancels it
+func (m *model) startTask(name string, task func(ctx context.Context) tea.Msg) tea.Cmd {
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.task = name
+	m.cancelTask = cancel
+	m.message = ""
+	return func() tea.Msg {
+		defer cancel()
+		return taskDoneMsg{result: task(ctx)}
+	}
+}
+
+// syncAll syncs every server, returning the divergences to resolve. Divergences are resolved without
+// asking if a resolution is configured, unless resolve is false while the game is running
+func syncAll(ctx context.Context, resolve bool) (online bool, divergences []divergence) {
+	online = true
+	for _, ss := range syncedpz.GetSyncedServers() {
+		err := ss.Sync(ctx)
+		var divergenceErr *syncedpz.DivergenceError
+		if errors.As(err, &divergenceErr) {
+			if config.ConflictResolution == "" || !resolve {
+				divergences = append(divergences, divergence{ss, divergenceErr})
+				continue
+			}
+			var resolution syncedpz.Resolution
+			if resolution, err = syncedpz.ParseResolution(config.ConflictResolution); err == nil {
+				err = ss.ResolveDivergence(ctx, resolution)
+			}
+		}
+		if errors.Is(err, syncedpz.ErrOffline) {
+			online = false
+		} else if ctx.Err() != nil {
+			log.Warnf("Sync of %s interrupted, the remaining servers were skipped", ss.Name)
+			return online, divergences
+		} else if err != nil {
+			log.Errorf("Could not sync %s: %s", ss.Name, err)
+		}
+	}
+	return online, divergences
+}
+
+func (m *model) syncServers() tea.Cmd {
+	return m.startTask(config.GTM("Syncing servers"), func(ctx context.Context) tea.Msg {
+		online, divergences := syncAll(ctx, !syncedpz.IsGameRunning())
+		text := config.GTM("Servers synced")
+		if !online {
+			text = config.GTM("You are offline, your progress will be pushed when the connection is back")
+		}
+		return divergencesMsg{divergences: divergences, text: text}
+	})
+}
+
+func (m *model) syncServer(ss *syncedpz.SyncedServer) tea.Cmd {
+	return m.startTask(fmt.Sprintf(config.GTM("Syncing %s"), ss.Name), func(ctx context.Context) tea.Msg {
+		err := ss.Sync(ctx)
+		var divergenceErr *syncedpz.DivergenceError
+		switch {
+		case errors.As(err, &divergenceErr):
+			return divergencesMsg{divergences: []divergence{{ss, divergenceErr}}}
+		case errors.Is(err, syncedpz.ErrOffline):
+			return resultMsg{text: config.GTM("You are offline, your progress will be pushed when the connection is back")}
+		case err != nil:
+			return resultMsg{err: err}
+		}
+		return resultMsg{text: fmt.Sprintf(config.GTM("%s synced"), ss.Name)}
+	})
+}
+
+// divergencePrompt asks how to resolve the first divergence, then the next ones
+func (m *model) divergencePrompt(divergences []divergence) *prompt {
+	if len(divergences) == 0 {
+		return nil
+	}
+	d, rest := divergences[0], divergences[1:]
+	next := func() tea.Cmd {
+		m.prompt = m.divergencePrompt(rest)
+		return nil
+	}
+	resolve := func(resolution syncedpz.Resolution) func() tea.Cmd {
+		return func() tea.Cmd {
+			return m.startTask(fmt.Sprintf(config.GTM("Resolving %s"), d.ss.Name), func(ctx context.Context) tea.Msg {
+				if err := d.ss.ResolveDivergence(ctx, resolution); err != nil {
+					return resultMsg{err: err}
+				}
+				return divergencesMsg{divergences: rest, text: fmt.Sprintf(config.GTM("%s resolved"), d.ss.Name)}
+			})
+		}
+	}
+
+	text := fmt.Sprintf(config.GTM("%s changed locally and in the server since the last sync:\n"), d.ss.Name)
+	if d.err.Base != nil {
+		text += fmt.Sprintln(config.GTM("  Last sync:"), commitLine(*d.err.Base))
+	}
+	text += fmt.Sprintln(config.GTM("  Mine:     "), commitLine(d.err.Mine))
+	text += fmt.Sprintln(config.GTM("  Theirs:   "), commitLine(d.err.Theirs))
+	return &prompt{
+		text: text,
+		options: []option{
+			{"1", config.GTM("  [1] Keep mine, replacing theirs"), resolve(syncedpz.KeepMine)},
+			{"2", config.GTM("  [2] Keep theirs, mine is kept in the local backups"), resolve(syncedpz.KeepTheirs)},
+			{"3", config.GTM("  [3] Fork mine into a new branch and keep theirs"), resolve(syncedpz.Fork)},
+			{"4", config.GTM("  [4] Decide on the next sync"), next},
+		},
+	}
+}
+
+// checkRepository checks if the repository of a server being added already has content
+func (m *model) checkRepository(name, gitURL string) tea.Cmd {
+	return m.startTask(config.GTM("Checking the git repository"), func(ctx context.Context) tea.Msg {
+		ss := syncedpz.NewSyncedServer(name, gitURL)
+		changes, err := ss.TryPull(ctx)
+		if err != nil {
+			return resultMsg{err: err}
+		}
+		return repositoryCheckedMsg{ss: ss, changes: changes}
+	})
+}
+
+// publishServer copies the server being added to its repository
+func (m *model) publishServer(ss *syncedpz.SyncedServer) tea.Cmd {
+	return m.startTask(config.GTM("WARNING: Commiting and pushing can take a while, please wait..."), func(ctx context.Context) tea.Msg {
+		if err := ss.Publish(ctx); err != nil {
+			return resultMsg{err: err}
+		}
+		return resultMsg{text: config.GTM("Server added successfully")}
+	})
+}
+
+// repositoryPrompt asks to confirm adding the server to a repository that already has content
+func (m *model) repositoryPrompt(ss *syncedpz.SyncedServer) *prompt {
+	return &prompt{
+		text: config.GTM("Warning! Apparently a server using this git repository already exists") + "\n" +
+			config.GTM("and it already has some content.") + "\n" +
+			config.GTM("Do you want to continue copying your local content to it?"),
+		options: []option{
+			{"y", config.GTM("  [y] Yes"), func() tea.Cmd { return m.publishServer(ss) }},
+			{"n", config.GTM("  [n] No"), func() tea.Cmd {
+				m.message = config.GTM("Aborting.")
+				return nil
+			}},
+		},
+	}
+}
+
+func (m *model) cloneServer(gitURL string) tea.Cmd {
+	return m.startTask(config.GTM("Cloning server"), func(ctx context.Context) tea.Msg {
+		if _, err := syncedpz.CloneServer(ctx, gitURL); err != nil {
+			return resultMsg{err: err}
+		}
+		return resultMsg{text: config.GTM("Server cloned successfully")}
+	})
+}
+
+// deletePrompt asks to confirm deleting the server
+func (m *model) deletePrompt(ss *syncedpz.SyncedServer) *prompt {
+	return &prompt{
+		text: fmt.Sprintf(config.GTM("Delete %s from the synced servers? Your local save is kept"), ss.Name),
+		options: []option{
+			{"y", config.GTM("  [y] Yes"), func() tea.Cmd {
+				return m.startTask(fmt.Sprintf(config.GTM("Deleting %s"), ss.Name), func(ctx context.Context) tea.Msg {
+					if err := ss.Delete(ctx, false); err != nil {
+						return resultMsg{err: err}
+					}
+					return resultMsg{text: fmt.Sprintf(config.GTM("%s deleted"), ss.Name)}
+				})
+			}},
+			{"n", config.GTM("  [n] No"), func() tea.Cmd { return nil }},
+		},
+	}
+}
+
+// missingMods logs the mods missing to play the servers, returns false if any
+func missingMods() bool {
+	ok := true
+	for _, ss := range syncedpz.GetSyncedServers() {
+		report, err := ss.VerifyMods()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for mod, path := range report.MismatchedMods {
+			log.Warnf("Mod %s of %s is installed at %s, not from the server workshop items, its version may differ", mod, ss.Name, path)
+		}
+		for _, item := range report.MissingWorkshopItems {
+			ok = false
+			log.Errorf("%s needs the workshop item %s: https://steamcommunity.com/sharedfiles/filedetails/?id=%s", ss.Name, item, item)
+		}
+		for _, mod := range report.MissingMods {
+			ok = false
+			log.Errorf("%s needs the mod %s", ss.Name, mod)
+		}
+	}
+	return ok
+}
+
+// play syncs every server, starts the game and keeps syncing them until it closes, like syncedpz play.
+// The divergences found while playing are left for the end
+func (m *model) play() tea.Cmd {
+	return m.startTask(config.GTM("Playing"), func(ctx context.Context) tea.Msg {
+		if online, _ := syncAll(ctx, true); !online {
+			log.Warn("You are offline, your progress will be pushed when the connection is back")
+		}
+		if ctx.Err() != nil {
+			return resultMsg{err: ctx.Err()}
+		}
+		if !missingMods() {
+			return resultMsg{err: errors.New(config.GTM("Missing mods, install them before playing"))}
+		}
+
+		// The database is only open during the syncs while the game runs, so the other commands can use it
+		config.CloseDB()
+		err := syncedpz.RunGame(ctx, syncedpz.SyncInterval, func() {
+			if err := config.OpenDB(ctx); err != nil {
+				log.Errorf("Could not sync the servers: %s", err)
+				return
+			}
+			defer config.CloseDB()
+			syncAll(ctx, false)
+		})
+		// The screen reads it again once the task is done
+		utils.HandleErr(config.OpenDB(m.ctx))
+		if err != nil {
+			return resultMsg{err: err}
+		}
+		if ctx.Err() != nil {
+			return resultMsg{err: errors.New(config.GTM("Interrupted, the final sync was skipped. Run syncedpz sync to push your progress"))}
+		}
+		_, divergences := syncAll(ctx, true)
+		return divergencesMsg{divergences: divergences, text: config.GTM("Game closed and servers synced")}
+	})
+}
@@ -0,0 +1,398 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syncedpz/config"
+	"syncedpz/pkg/syncedpz"
+	"syncedpz/pkg/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	listWidth = 30
+	logHeight = 10
+)
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9"))
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+	mutedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	helpStyle     = mutedStyle
+	paneStyle     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+)
+
+type model struct {
+	// Done when the program is interrupted
+	ctx    context.Context
+	width  int
+	height int
+
+	servers []*syncedpz.SyncedServer
+	status  *syncedpz.ServerStatus
+	history []syncedpz.CommitInfo
+	cursor  int
+
+	// Name of the running task, empty when idle
+	task       string
+	cancelTask context.CancelFunc
+
+	form    *form
+	prompt  *prompt
+	message string
+	err     string
+	logs    *logBuffer
+	// The program was interrupted, it quits once the running task stops
+	quitting bool
+}
+
+// interruptedMsg is sent when the program is interrupted
+type interruptedMsg struct{}
+
+// Run shows the full-screen interface until the player quits. The logs are shown in its log pane meanwhile
+func Run(ctx context.Context) error {
+	// The log file keeps receiving them
+	logs := newLogBuffer()
+	output := utils.Output
+	log.SetOutput(io.MultiWriter(logs, utils.LogFile))
+	utils.Output = io.MultiWriter(logs, utils.NewLineWriter(utils.LogFile))
+	defer func() {
+		log.SetOutput(io.MultiWriter(os.Stderr, utils.LogFile))
+		utils.Output = output
+	}()
+
+	m := &model{ctx: ctx, logs: logs}
+	m.refresh()
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	// A fatal error exits without stopping the program, the terminal is restored first so the error is
+	// shown in it
+	utils.OnFatal(func() {
+		p.ReleaseTerminal()
+		log.SetOutput(io.MultiWriter(os.Stderr, utils.LogFile))
+	})
+	defer utils.OnFatal(nil)
+	_, err := p.Run()
+	return err
+}
+
+func (m *model) Init() tea.Cmd {
+	interrupted := func() tea.Msg {
+		<-m.ctx.Done()
+		return interruptedMsg{}
+	}
+	return tea.Batch(m.logs.wait(), interrupted)
+}
+
+// refresh reloads the servers and the status of the selected one
+func (m *model) refresh() {
+	m.servers = syncedpz.GetSyncedServers()
+	m.cursor = max(min(m.cursor, len(m.servers)-1), 0)
+	m.loadDetails()
+}
+
+func (m *model) selected() *syncedpz.SyncedServer {
+	if len(m.servers) == 0 {
+		return nil
+	}
+	return m.servers[m.cursor]
+}
+
+func (m *model) loadDetails() {
+	m.status, m.history = nil, nil
+	if ss := m.selected(); ss != nil {
+		status, err := ss.GetStatus()
+		if err == nil {
+			m.status = &status
+			m.history, err = ss.GetHistory(5)
+		}
+		if err != nil {
+			m.message, m.err = "", err.Error()
+		}
+	}
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+	case logMsg:
+		return m, m.logs.wait()
+	case interruptedMsg:
+		// The running task was cancelled with the context, it stops at the next safe point
+		m.quitting = true
+		if m.task == "" {
+			return m, tea.Quit
+		}
+		return m, nil
+	case taskDoneMsg:
+		m.task = ""
+		m.cancelTask = nil
+		if m.quitting {
+			return m, tea.Quit
+		}
+		m.refresh()
+		return m.Update(msg.result)
+	case resultMsg:
+		m.message, m.err = msg.text, ""
+		if msg.err != nil {
+			m.message, m.err = "", msg.err.Error()
+		}
+		return m, nil
+	case divergencesMsg:
+		m.message, m.err = msg.text, ""
+		m.prompt = m.divergencePrompt(msg.divergences)
+		return m, nil
+	case repositoryCheckedMsg:
+		if msg.changes {
+			m.prompt = m.repositoryPrompt(msg.ss)
+			return m, nil
+		}
+		return m, m.publishServer(msg.ss)
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	key := msg.String()
+	if key == "ctrl+c" {
+		if m.task != "" {
+			log.Warn("Stopping at the next safe point...")
+			m.cancelTask()
+			return nil
+		}
+		return tea.Quit
+	}
+	if m.task != "" {
+		// Only the running task can be stopped meanwhile
+		return nil
+	}
+
+	if m.prompt != nil {
+		for _, option := range m.prompt.options {
+			if option.key == key {
+				m.prompt = nil
+				return option.run()
+			}
+		}
+		return nil
+	}
+	if m.form != nil {
+		cmd, closed := m.form.update(msg)
+		if closed {
+			m.form = nil
+			m.refresh()
+		}
+		return cmd
+	}
+
+	ss := m.selected()
+	switch key {
+	case "q", "esc":
+		return tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+			m.loadDetails()
+		}
+	case "down", "j":
+		if m.cursor < len(m.servers)-1 {
+			m.cursor++
+			m.loadDetails()
+		}
+	case "r":
+		m.refresh()
+	case "s":
+		if ss != nil {
+			return m.syncServer(ss)
+		}
+	case "S":
+		return m.syncServers()
+	case "p":
+		return m.play()
+	case "a":
+		m.form = m.addForm()
+	case "c":
+		m.form = m.cloneForm()
+	case "x":
+		if ss != nil {
+			m.prompt = m.deletePrompt(ss)
+		}
+	case "e":
+		m.form = m.setupForm()
+	case "l":
+		// Switches to the next language
+		lang := config.Launguage + 1
+		if !config.IsLanguageValid(lang) {
+			lang = config.LANG_START + 1
+		}
+		if err := syncedpz.SetupLanguage(lang); err != nil {
+			m.message, m.err = "", err.Error()
+		}
+	}
+	return nil
+}
+
+func commitLine(ci syncedpz.CommitInfo) string {
+	return fmt.Sprintf("%s - %s - %s", ci.Time.Format("2006-01-02 15:04"), ci.Author, ci.Subject())
+}
+
+func remoteLine(rh syncedpz.RemoteHealth) string {
+	switch {
+	case rh.LastSuccess.IsZero() && rh.LastFailure.IsZero():
+		return rh.URL + ": " + config.GTM("not used yet")
+	case rh.Permanent:
+		return rh.URL + ": " + errorStyle.Render(strings.TrimSpace(fmt.Sprintf(config.GTM("failing, retrying won't help: %s\n"), rh.LastError)))
+	case rh.Healthy():
+		return rh.URL + ": " + strings.TrimSpace(fmt.Sprintf(config.GTM("ok (last success %s)\n"), rh.LastSuccess.Format("2006-01-02 15:04")))
+	}
+	return rh.URL + ": " + errorStyle.Render(strings.TrimSpace(fmt.Sprintf(config.GTM("failed %d times in a row, last at %s: %s\n"),
+		rh.ConsecutiveFailures, rh.LastFailure.Format("2006-01-02 15:04"), rh.LastError)))
+}
+
+func (m *model) listView() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(config.GTM("Synced servers")) + "\n\n")
+	if len(m.servers) == 0 {
+		b.WriteString(mutedStyle.Width(listWidth - 2).Render(config.GTM("No synced servers, press a to add one or c to clone one")))
+	}
+	for i, ss := range m.servers {
+		if i == m.cursor {
+			b.WriteString(selectedStyle.Render("› "+ss.Name) + "\n")
+		} else {
+			b.WriteString("  " + ss.Name + "\n")
+		}
+	}
+	return b.String()
+}
+
+func (m *model) detailsView() string {
+	if m.status == nil {
+		return ""
+	}
+	status := m.status
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(status.Name) + "\n\n")
+	line := func(label, value string) {
+		b.WriteString(mutedStyle.Render(strings.TrimSpace(label)) + " " + value + "\n")
+	}
+	if status.Branch != "" {
+		line(config.GTM("  Branch:"), status.Branch)
+	}
+	line(config.GTM("  Players:"), strings.Join(status.Players, ", "))
+	if status.LastCommit != nil {
+		line(config.GTM("  Last snapshot:"), commitLine(*status.LastCommit))
+	}
+	if status.LastSync != nil {
+		line(config.GTM("  Last sync:"), status.LastSync.Time.Format("2006-01-02 15:04"))
+	}
+	if status.Metadata != nil {
+		for _, metadata := range status.Metadata.Lines() {
+			b.WriteString(metadata + "\n")
+		}
+	}
+	if status.Queued > 0 {
+		b.WriteString(strings.TrimSpace(fmt.Sprintf(config.GTM("  %d snapshots waiting to be pushed\n"), status.Queued)) + "\n")
+	}
+	if status.Conflicts > 0 {
+		b.WriteString(errorStyle.Render(strings.TrimSpace(fmt.Sprintf(config.GTM("  %d config conflicts, use syncedpz resolve to solve them\n"), status.Conflicts))) + "\n")
+	}
+
+	b.WriteString("\n" + mutedStyle.Render(strings.TrimSpace(config.GTM("  Repositories:"))) + "\n")
+	for _, rh := range status.Remotes {
+		b.WriteString(remoteLine(rh) + "\n")
+	}
+
+	if len(m.history) > 0 {
+		b.WriteString("\n" + mutedStyle.Render(config.GTM("History")) + "\n")
+		for _, ci := range m.history {
+			tags := ""
+			if len(ci.Tags) > 0 {
+				tags = selectedStyle.Render(" (" + strings.Join(ci.Tags, ", ") + ")")
+			}
+			b.WriteString(ci.Hash[:8] + " " + commitLine(ci) + tags + "\n")
+		}
+	}
+	return b.String()
+}
+
+func (m *model) promptView() string {
+	var b strings.Builder
+	b.WriteString(m.prompt.text + "\n\n")
+	for _, option := range m.prompt.options {
+		b.WriteString(option.label + "\n")
+	}
+	return b.String()
+}
+
+func (m *model) statusLine() string {
+	switch {
+	case m.task != "":
+		return selectedStyle.Render(m.task+"...") + " " + helpStyle.Render(config.GTM("ctrl+c stops at the next safe point"))
+	case m.err != "":
+		return errorStyle.Render(m.err)
+	}
+	return m.message
+}
+
+func (m *model) helpLine() string {
+	if m.form != nil || m.prompt != nil || m.task != "" {
+		return ""
+	}
+	return config.GTM("↑/↓ select • s sync • S sync all • p play • a add • c clone • x delete • e setup • l language • r refresh • q quit")
+}
+
+func (m *model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	// The borders of the panes take two rows and columns, the status and help lines one row each
+	bodyHeight := max(m.height-(logHeight+2)-2-2, 5)
+	detailsWidth := max(m.width-(listWidth+2)-2, 20)
+
+	var details string
+	switch {
+	case m.prompt != nil:
+		details = m.promptView()
+	case m.form != nil:
+		details = m.form.view(detailsWidth - 2)
+	default:
+		details = m.detailsView()
+	}
+
+	fit := func(s string, width, height int) string {
+		lines := strings.Split(s, "\n")
+		if len(lines) > height {
+			lines = lines[:height]
+		}
+		for i, line := range lines {
+			lines[i] = lipgloss.NewStyle().MaxWidth(width).Render(line)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	// The padding of the panes takes two columns
+	list := paneStyle.Width(listWidth).Height(bodyHeight).Render(fit(m.listView(), listWidth-2, bodyHeight))
+	right := paneStyle.Width(detailsWidth).Height(bodyHeight).Render(fit(details, detailsWidth-2, bodyHeight))
+	body := lipgloss.JoinHorizontal(lipgloss.Top, list, right)
+
+	logWidth := max(m.width-2, 20)
+	logs := paneStyle.Width(logWidth).Height(logHeight).Render(fit(strings.Join(m.logs.Tail(logHeight), "\n"), logWidth-2, logHeight))
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		body,
+		fit(m.statusLine(), m.width, 1),
+		logs,
+		fit(helpStyle.Render(m.helpLine()), m.width, 1),
+	)
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned when the file is locked by another process
+var ErrLocked = errors.New("locked by another process")
+
+// FileLock is an exclusive lock on a file, shared between processes. The operating system releases it
+// if the process dies without unlocking it
+type FileLock struct {
+	file *os.File
+}
+
+// TryLockFile locks the file, creating it if needed. Returns ErrLocked if it's locked by another process
+func TryLockFile(path string) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileLock{file: file}, nil
+}
+
+// LockFile waits until the file can be locked or the context is done
+func LockFile(ctx context.Context, path string) (*FileLock, error) {
+	for {
+		lock, err := TryLockFile(path)
+		if err != ErrLocked {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Unlock releases the lock
+func (l *FileLock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
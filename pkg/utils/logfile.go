@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LogFile receives a copy of the logs and of Output once the file logging is set up
+var LogFile io.Writer = io.Discard
+
+// RotatingFile is a log file that is rotated when it reaches its maximum size. The rotated files are
+// numbered from the newest, name.1.log, to the oldest, and only the last ones are kept
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// OpenRotatingFile opens the log file for appending, creating it and its directory if needed
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotatedPath returns the path of the nth rotated file
+func (f *RotatingFile) rotatedPath(n int) string {
+	ext := filepath.Ext(f.path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(f.path, ext), n, ext)
+}
+
+// rotate renames the current file to name.1.log, shifting the older ones and removing the last one
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(f.rotatedPath(f.maxFiles))
+	for n := f.maxFiles - 1; n >= 1; n-- {
+		os.Rename(f.rotatedPath(n), f.rotatedPath(n+1))
+	}
+	if err := os.Rename(f.path, f.rotatedPath(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file, the next writes fail
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Files returns the path of the current file and of the rotated ones that exist, from the newest
+func (f *RotatingFile) Files() []string {
+	files := []string{f.path}
+	for n := 1; n <= f.maxFiles; n++ {
+		if _, err := os.Stat(f.rotatedPath(n)); err == nil {
+			files = append(files, f.rotatedPath(n))
+		}
+	}
+	return files
+}
+
+// lineWriter writes complete lines only. A carriage return replaces the current line, like the progress
+// of the git operations does, so only its final state is written
+type lineWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	current []byte
+}
+
+// NewLineWriter returns a writer that writes to w the final state of each line
+func NewLineWriter(w io.Writer) io.Writer {
+	return &lineWriter{w: w}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, b := range p {
+		switch b {
+		case '\n':
+			if len(bytes.TrimSpace(l.current)) > 0 {
+				if _, err := l.w.Write(append(l.current, '\n')); err != nil {
+					return 0, err
+				}
+			}
+			l.current = l.current[:0]
+		case '\r':
+			l.current = l.current[:0]
+		default:
+			l.current = append(l.current, b)
+		}
+	}
+	return len(p), nil
+}
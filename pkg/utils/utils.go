@@ -1,13 +1,20 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"runtime"
 
 	"github.com/charmbracelet/log"
+	cp "github.com/otiai10/copy"
 )
 
+// Output receives the progress printed by the commands and the git operations, the console by default
+var Output io.Writer = os.Stdout
+
 // return true if the directory already exists, false if it was created
 func EnsureDir(dirName string) bool {
 	if _, err := os.Stat(dirName); !os.IsNotExist(err) {
@@ -21,11 +28,11 @@ func EnsureDir(dirName string) bool {
 
 // Runs command on directory
 func RunCommandOnDir(dir string, command string, args ...string) error {
-	fmt.Printf("Running command: %s", command)
+	fmt.Fprintf(Output, "Running command: %s", command)
 	for _, arg := range args {
-		fmt.Printf(" %s", arg)
+		fmt.Fprintf(Output, " %s", arg)
 	}
-	fmt.Println()
+	fmt.Fprintln(Output)
 
 	cmd := exec.Command(command, args...)
 	cmd.Dir = dir
@@ -33,19 +40,54 @@ func RunCommandOnDir(dir string, command string, args ...string) error {
 }
 
 func RunCommandOnDirOutput(dir string, command string, args ...string) ([]byte, error) {
-	fmt.Printf("Running command: %s", command)
+	fmt.Fprintf(Output, "Running command: %s", command)
 	for _, arg := range args {
-		fmt.Printf(" %s", arg)
+		fmt.Fprintf(Output, " %s", arg)
 	}
-	fmt.Println()
+	fmt.Fprintln(Output)
 
 	cmd := exec.Command(command, args...)
 	cmd.Dir = dir
 	return cmd.Output()
 }
 
+// beforeFatal is run by HandleErr before exiting, see OnFatal
+var beforeFatal func()
+
+// OnFatal sets the function run by HandleErr before exiting the process, to undo what can't be left
+// behind, like the state of the terminal. Nil removes it
+func OnFatal(f func()) {
+	beforeFatal = f
+}
+
 func HandleErr(err error) {
 	if err != nil {
+		if beforeFatal != nil {
+			beforeFatal()
+		}
 		log.Fatal(err)
 	}
 }
+
+// CopyContext copies the file or directory, stopping before the next file when the context is done
+func CopyContext(ctx context.Context, src, dest string) error {
+	return cp.Copy(src, dest, cp.Options{
+		Skip: func(srcinfo os.FileInfo, src, dest string) (bool, error) {
+			return false, ctx.Err()
+		},
+	})
+}
+
+// OpenBrowser opens the URL in the default browser
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}